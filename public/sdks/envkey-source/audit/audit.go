@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// an append-only log of every env delivered to a local process. each record
+// includes the hash of the record before it, so editing, deleting, or
+// reordering records in the middle of the log breaks the chain and is caught
+// by Verify. the chain isn't keyed or anchored anywhere outside the log, so
+// it doesn't catch records truncated from the end, or a log rewritten with
+// the hashes recomputed--keep the log somewhere only trusted users can write.
+
+const FILE_MODE = 0600
+
+const (
+	SOURCE_DAEMON        = "daemon"
+	SOURCE_ENVKEY_SOURCE = "envkey-source"
+)
+
+type Record struct {
+	Seq           int      `json:"seq"`
+	Timestamp     string   `json:"timestamp"`
+	EnvkeyIdPart  string   `json:"envkeyIdPart"`
+	Source        string   `json:"source"`
+	ClientName    string   `json:"clientName"`
+	ClientVersion string   `json:"clientVersion"`
+	Pid           int      `json:"pid"`
+	Exe           string   `json:"exe,omitempty"`
+	PidVerified   bool     `json:"pidVerified"`
+	Keys          []string `json:"keys"`
+	FromCache     bool     `json:"fromCache"`
+	FromBundle    bool     `json:"fromBundle,omitempty"`
+	PrevHash      string   `json:"prevHash"`
+	Hash          string   `json:"hash"`
+}
+
+// Keys returns the sorted var names in env
+func Keys(env parser.EnvMap) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Append sets the record's timestamp, sequence number and hashes, and
+// appends it to the log at path. the log is locked while appending, so the
+// daemon and one-shot processes can share a log.
+func Append(path string, rec Record) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = lockFile(f)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	line, err := lastLine(f)
+	if err != nil {
+		return err
+	}
+
+	var prev Record
+	if len(line) > 0 {
+		err = json.Unmarshal(line, &prev)
+		if err != nil {
+			return errors.New("couldn't parse last audit log record: " + err.Error())
+		}
+	}
+
+	if rec.Timestamp == "" {
+		rec.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if rec.Keys == nil {
+		rec.Keys = []string{}
+	}
+	rec.Seq = prev.Seq + 1
+	rec.PrevHash = prev.Hash
+	rec.Hash, err = hash(rec)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Verify checks every record's hash and link to the record before it,
+// returning the number of valid records
+func Verify(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var prev Record
+	n := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+
+		if len(line) > 0 {
+			var rec Record
+			parseErr := json.Unmarshal(line, &rec)
+			if parseErr != nil {
+				return n, recordError(n+1, "couldn't be parsed: "+parseErr.Error())
+			}
+
+			if rec.Seq != prev.Seq+1 {
+				return n, recordError(n+1, "has sequence number "+strconv.Itoa(rec.Seq)+", expected "+strconv.Itoa(prev.Seq+1))
+			}
+			if rec.PrevHash != prev.Hash {
+				return n, recordError(n+1, "doesn't link to the previous record")
+			}
+
+			expected, hashErr := hash(rec)
+			if hashErr != nil {
+				return n, hashErr
+			}
+			if rec.Hash != expected {
+				return n, recordError(n+1, "hash doesn't match its contents")
+			}
+
+			prev = rec
+			n++
+		}
+
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+func recordError(n int, msg string) error {
+	return errors.New("audit log record " + strconv.Itoa(n) + " " + msg)
+}
+
+func hash(rec Record) (string, error) {
+	rec.Hash = ""
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastLine returns the last non-empty line in f, reading backwards from the end
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 4096
+	end := info.Size()
+	var buf []byte
+
+	for end > 0 {
+		start := end - chunkSize
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := make([]byte, end-start)
+		_, err = f.ReadAt(chunk, start)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+		end = start
+
+		trimmed := bytes.TrimRight(buf, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+	}
+
+	return bytes.TrimRight(buf, "\n"), nil
+}
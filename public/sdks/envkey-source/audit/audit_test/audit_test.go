@@ -0,0 +1,83 @@
+package audit_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/audit"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendAndVerify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-audit")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	for i := 0; i < 3; i++ {
+		err := audit.Append(path, audit.Record{
+			EnvkeyIdPart: "abc",
+			Source:       audit.SOURCE_DAEMON,
+			Pid:          100 + i,
+			Keys:         audit.Keys(parser.EnvMap{"B": "2", "A": "1"}),
+		})
+		assert.Nil(t, err)
+	}
+
+	n, err := audit.Verify(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(contents), `"keys":["A","B"]`)
+	assert.NotContains(t, string(contents), `"1"`)
+
+	// tampering with a record breaks the chain at that record
+	tampered := strings.Replace(string(contents), `"pid":101`, `"pid":999`, 1)
+	ioutil.WriteFile(path, []byte(tampered), audit.FILE_MODE)
+
+	n, err = audit.Verify(path)
+	assert.Equal(t, 1, n)
+	assert.EqualError(t, err, "audit log record 2 hash doesn't match its contents")
+
+	// so does deleting one
+	lines := strings.SplitAfter(string(contents), "\n")
+	ioutil.WriteFile(path, []byte(lines[0]+lines[2]), audit.FILE_MODE)
+
+	n, err = audit.Verify(path)
+	assert.Equal(t, 1, n)
+	assert.EqualError(t, err, "audit log record 2 has sequence number 3, expected 2")
+}
+
+func TestPeerPid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only available on linux")
+	}
+
+	dir, _ := ioutil.TempDir("", "envkey-audit")
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "test.sock"))
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("unix", filepath.Join(dir, "test.sock"))
+	assert.Nil(t, err)
+	defer client.Close()
+
+	server, err := listener.Accept()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	pid, ok := audit.PeerPid(server)
+	assert.True(t, ok)
+	assert.Equal(t, os.Getpid(), pid)
+
+	exe, _ := os.Executable()
+	assert.Equal(t, exe, audit.PidExe(pid))
+}
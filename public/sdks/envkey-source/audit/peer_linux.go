@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// PeerPid returns the pid of the process on the other end of a unix socket
+// connection, using SO_PEERCRED
+func PeerPid(conn net.Conn) (int, bool) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, false
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return 0, false
+	}
+
+	return int(cred.Pid), true
+}
+
+func PidExe(pid int) string {
+	exe, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+	if err != nil {
+		return ""
+	}
+	return exe
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package audit
+
+import "net"
+
+// peer credentials are only available on linux
+
+func PeerPid(conn net.Conn) (int, bool) {
+	return 0, false
+}
+
+func PidExe(pid int) string {
+	return ""
+}
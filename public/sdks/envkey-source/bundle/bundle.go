@@ -0,0 +1,205 @@
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/sink"
+)
+
+// an offline bundle is an encrypted fetch response saved to a file, so
+// hosts with no route to the EnvKey host can load their env with the
+// ENVKEY. the response is only decrypted when the bundle is loaded, going
+// through the same key decryption, trust chain verification, and
+// decryption as an online fetch.
+//
+// the metadata (including the expiry) is signed with the ENVKEY's private
+// key, so it can't be changed without the ENVKEY. the expiry is advisory: it
+// can't be extended without the ENVKEY, but a holder of the ENVKEY can
+// re-sign the bundle with a new expiry or roll the clock back.
+
+const FORMAT_VERSION = 1
+
+type Meta struct {
+	Version      int    `json:"version"`
+	OrgId        string `json:"orgId"`
+	EnvkeyIdPart string `json:"envkeyIdPart"`
+	FetchedAt    string `json:"fetchedAt"`
+	ExpiresAt    string `json:"expiresAt,omitempty"`
+
+	// sha256 of the payload
+	PayloadHash string `json:"payloadHash"`
+}
+
+type Bundle struct {
+	Meta    Meta            `json:"meta"`
+	Payload json.RawMessage `json:"payload"`
+
+	// detached signature of Meta by the ENVKEY's private key
+	Signature string `json:"signature"`
+}
+
+// New bundles an encrypted response. privkey is the ENVKEY's decrypted
+// private key, which is only used to sign the metadata. an expiresIn of 0
+// means the bundle doesn't expire.
+func New(envkeyIdPart string, response *parser.FetchResponse, privkey *crypto.Privkey, fetchedAt time.Time, expiresIn time.Duration) (*Bundle, error) {
+	if privkey == nil {
+		return nil, errors.New("can't sign bundle without a private key")
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := Meta{
+		Version:      FORMAT_VERSION,
+		OrgId:        response.OrgId,
+		EnvkeyIdPart: envkeyIdPart,
+		FetchedAt:    fetchedAt.UTC().Format(time.RFC3339),
+		PayloadHash:  hash(payload),
+	}
+	if expiresIn > 0 {
+		meta.ExpiresAt = fetchedAt.Add(expiresIn).UTC().Format(time.RFC3339)
+	}
+
+	sig, err := crypto.SignJsonDetached(meta, privkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bundle{Meta: meta, Payload: payload, Signature: sig}, nil
+}
+
+func Read(path string) (*Bundle, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Bundle
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, errors.New("invalid bundle: " + err.Error())
+	}
+
+	if res.Meta.Version != FORMAT_VERSION {
+		return nil, errors.New("unsupported bundle version: " + strconv.Itoa(res.Meta.Version))
+	}
+
+	return &res, nil
+}
+
+// Write saves the bundle with 0600 permissions, replacing any existing file atomically
+func (b *Bundle) Write(path string) error {
+	contents, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return sink.WriteFile(path, contents)
+}
+
+// Parse checks that the bundle belongs to the ENVKEY and hasn't expired,
+// then decrypts and verifies it exactly as an online fetch would
+func (b *Bundle) Parse(ctx context.Context, envkey string, now time.Time) (parser.EnvMap, error) {
+	split := strings.Split(envkey, "-")
+	if len(split) < 2 {
+		return nil, errors.New("ENVKEY invalid")
+	}
+	envkeyIdPart, pw := split[0], split[1]
+
+	if envkeyIdPart != b.Meta.EnvkeyIdPart {
+		return nil, errors.New("bundle is for a different ENVKEY")
+	}
+
+	if b.Meta.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, b.Meta.ExpiresAt)
+		if err != nil {
+			return nil, errors.New("invalid bundle expiry: " + b.Meta.ExpiresAt)
+		}
+		if !now.Before(expiresAt) {
+			return nil, errors.New("bundle expired at " + b.Meta.ExpiresAt)
+		}
+	}
+
+	if hash(b.Payload) != b.Meta.PayloadHash {
+		return nil, errors.New("bundle payload doesn't match its signed hash")
+	}
+
+	response := new(parser.FetchResponse)
+	err := json.Unmarshal(b.Payload, response)
+	if err != nil {
+		return nil, errors.New("invalid bundle payload: " + err.Error())
+	}
+
+	// verifies the response's pubkey against the decrypted private key,
+	// so the pubkey can be trusted to check the signature below
+	res, _, _, _, err := response.ParseWithV1Upgrade(ctx, pw, nil)
+	var keyErr *parser.KeyError
+	if errors.As(err, &keyErr) {
+		return nil, errors.New("ENVKEY invalid")
+	} else if err != nil {
+		return nil, errors.New("bundle verification failed: " + err.Error())
+	}
+
+	if response.Pubkey == nil {
+		return nil, errors.New("bundle signature can't be verified")
+	}
+
+	err = b.verify(response.Pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (b *Bundle) verify(pubkey *crypto.Pubkey) error {
+	msg, err := json.Marshal(b.Meta)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil {
+		return errors.New("invalid bundle signature")
+	}
+
+	err = crypto.VerifyDetached(msg, sig, pubkey)
+	if err != nil {
+		return errors.New("invalid bundle signature")
+	}
+
+	return nil
+}
+
+// ParseExpiry parses a Go duration like 72h, or a number of days like 30d
+func ParseExpiry(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err == nil && days >= 0 {
+			return time.Duration(days * float64(24*time.Hour)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("invalid expiry: " + s + " (use a duration like 72h or 30d)")
+	}
+	return d, nil
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
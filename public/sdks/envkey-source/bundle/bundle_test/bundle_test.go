@@ -0,0 +1,99 @@
+package bundle_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/bundle"
+	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/sign"
+)
+
+func signingPrivkey() *crypto.Privkey {
+	_, priv, _ := sign.GenerateKey(rand.Reader)
+	return &crypto.Privkey{
+		Keys: crypto.EncryptionAndSigningKeys{
+			SigningKey: base64.StdEncoding.EncodeToString(priv[:]),
+		},
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-bundle")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.ekb")
+
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b, err := bundle.New("envkeyId", &parser.FetchResponse{OrgId: "orgId"}, signingPrivkey(), fetchedAt, 72*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, "orgId", b.Meta.OrgId)
+	assert.Equal(t, "2024-01-04T00:00:00Z", b.Meta.ExpiresAt)
+
+	assert.Nil(t, b.Write(path))
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	read, err := bundle.Read(path)
+	assert.Nil(t, err)
+	assert.Equal(t, b.Meta, read.Meta)
+	assert.Equal(t, b.Signature, read.Signature)
+
+	_, err = bundle.New("envkeyId", &parser.FetchResponse{}, nil, fetchedAt, 0)
+	assert.NotNil(t, err)
+}
+
+func TestParseChecks(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b, _ := bundle.New("envkeyId", &parser.FetchResponse{OrgId: "orgId"}, signingPrivkey(), fetchedAt, time.Hour)
+	ctx := context.Background()
+
+	_, err := b.Parse(ctx, "otherId-pw-host", fetchedAt)
+	assert.Equal(t, "bundle is for a different ENVKEY", err.Error())
+
+	_, err = b.Parse(ctx, "invalid", fetchedAt)
+	assert.Equal(t, "ENVKEY invalid", err.Error())
+
+	_, err = b.Parse(ctx, "envkeyId-pw", fetchedAt.Add(time.Hour))
+	assert.Equal(t, "bundle expired at 2024-01-01T01:00:00Z", err.Error())
+
+	// a payload that fails verification for reasons other than the key
+	_, err = b.Parse(ctx, "envkeyId-pw", fetchedAt)
+	assert.Equal(t, "bundle verification failed: Required fields are empty.", err.Error())
+
+	b.Payload = []byte(`{"orgId":"otherOrgId"}`)
+	_, err = b.Parse(ctx, "envkeyId-pw", fetchedAt)
+	assert.Equal(t, "bundle payload doesn't match its signed hash", err.Error())
+
+	// a private key that the ENVKEY can't decrypt
+	b, _ = bundle.New("envkeyId", &parser.FetchResponse{
+		EncryptedPrivkey:  &crypto.EncryptedData{Data: "AAAA", Nonce: "AAAA"},
+		Pubkey:            &crypto.Pubkey{},
+		SignedTrustedRoot: &crypto.SignedData{},
+	}, signingPrivkey(), fetchedAt, 0)
+	_, err = b.Parse(ctx, "envkeyId-pw", fetchedAt)
+	assert.Equal(t, "ENVKEY invalid", err.Error())
+}
+
+func TestParseExpiry(t *testing.T) {
+	d, err := bundle.ParseExpiry("30d")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*24*time.Hour, d)
+
+	d, err = bundle.ParseExpiry("1.5h")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+
+	_, err = bundle.ParseExpiry("soon")
+	assert.NotNil(t, err)
+
+	_, err = bundle.ParseExpiry("-1h")
+	assert.NotNil(t, err)
+}
@@ -41,6 +41,13 @@ func NewCache(dir string) (*Cache, error) {
 }
 
 func (cache *Cache) Write(envkeyParam string, body []byte) error {
+	return cache.WriteWithValidator(envkeyParam, body, "")
+}
+
+// WriteWithValidator writes body along with its validator (its ETag or
+// content hash), so a later fetch can ask the server whether the cached body
+// is still current. an empty validator removes any existing one.
+func (cache *Cache) WriteWithValidator(envkeyParam string, body []byte, validator string) error {
 	var err error
 
 	// ensure dir exists
@@ -53,8 +60,20 @@ func (cache *Cache) Write(envkeyParam string, body []byte) error {
 		return err
 	}
 
-	dir := filepath.Join(cache.Dir, envkeyParam)
-	err = ioutil.WriteFile(dir, body, 0600)
+	// remove the old validator first so it never describes the wrong body
+	err = os.Remove(cache.validatorPath(envkeyParam))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	if err == nil {
+		dir := filepath.Join(cache.Dir, envkeyParam)
+		err = ioutil.WriteFile(dir, body, 0600)
+	}
+
+	if err == nil && validator != "" {
+		err = ioutil.WriteFile(cache.validatorPath(envkeyParam), []byte(validator), 0600)
+	}
 
 	select {
 	case cache.Done <- err:
@@ -73,7 +92,16 @@ func (cache *Cache) Read(envkeyParam string) ([]byte, error) {
 	return b, err
 }
 
+// ReadValidator returns the validator written with the cached body. unlike
+// Read, it doesn't send to Done.
+func (cache *Cache) ReadValidator(envkeyParam string) (string, error) {
+	b, err := ioutil.ReadFile(cache.validatorPath(envkeyParam))
+	return string(b), err
+}
+
 func (cache *Cache) Delete(envkeyParam string) error {
+	os.Remove(cache.validatorPath(envkeyParam))
+
 	path := filepath.Join(cache.Dir, envkeyParam)
 	err := os.Remove(path)
 	select {
@@ -82,3 +110,7 @@ func (cache *Cache) Delete(envkeyParam string) error {
 	}
 	return err
 }
+
+func (cache *Cache) validatorPath(envkeyParam string) string {
+	return filepath.Join(cache.Dir, envkeyParam+".validator")
+}
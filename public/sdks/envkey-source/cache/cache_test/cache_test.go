@@ -76,3 +76,32 @@ func TestDelete(t *testing.T) {
 	assert.NotNil(t, err, "Should have removed the cache file.")
 
 }
+
+func TestWriteWithValidator(t *testing.T) {
+	c, _ := cache.NewCache(testPath)
+	defer c.Delete("some-envkey")
+
+	err := c.WriteWithValidator("some-envkey", []byte("test data"), `"etag"`)
+	assert.Nil(t, err, "Should not return an error.")
+	assert.Equal(t, 1, len(c.Done), "Should add to done channel")
+	<-c.Done
+
+	validator, err := c.ReadValidator("some-envkey")
+	assert.Nil(t, err, "Should not return an error.")
+	assert.Equal(t, `"etag"`, validator, "Should read the validator.")
+	assert.Equal(t, 0, len(c.Done), "Should not add to done channel")
+
+	// a write without a validator removes the old one
+	c.Write("some-envkey", []byte("new data"))
+	<-c.Done
+	_, err = c.ReadValidator("some-envkey")
+	assert.NotNil(t, err, "Should have removed the validator.")
+
+	// as does a delete
+	c.WriteWithValidator("some-envkey", []byte("test data"), `"etag"`)
+	<-c.Done
+	c.Delete("some-envkey")
+	<-c.Done
+	_, err = c.ReadValidator("some-envkey")
+	assert.NotNil(t, err, "Should have removed the validator.")
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/audit"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Work with the audit log of delivered environments",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [path]",
+	Short: "Check that no audit log records have been edited, removed, or reordered",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := auditLogPath()
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if path == "" {
+			utils.Fatal("audit log path required--pass it as an argument or set --audit-log or $ENVKEY_AUDIT_LOG", true)
+		}
+
+		n, err := audit.Verify(path)
+		utils.CheckError(err, true)
+
+		fmt.Printf("%s: %d records verified\n", path, n)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+}
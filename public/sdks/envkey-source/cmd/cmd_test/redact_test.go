@@ -0,0 +1,59 @@
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/cmd"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureStdout runs fn with os.Stdout redirected to a file, returning what
+// was written
+func captureStdout(t *testing.T, fn func()) string {
+	f, err := ioutil.TempFile(t.TempDir(), "stdout")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	stdout := os.Stdout
+	os.Stdout = f
+	fn()
+	os.Stdout = stdout
+
+	out, err := ioutil.ReadFile(f.Name())
+	assert.Nil(t, err)
+	return string(out)
+}
+
+func TestExecRedactedOutput(t *testing.T) {
+	server, err := mockserver.New(mockserver.Options{})
+	assert.Nil(t, err)
+	defer server.Close()
+	defer server.Install()()
+
+	secret := "s3cr3t-value"
+	envkey, err := server.AddEnv(parser.EnvMap{"SECRET": secret})
+	assert.Nil(t, err)
+
+	os.Setenv("HOME", t.TempDir())
+	os.Setenv("ENVKEY", envkey)
+	defer os.Unsetenv("ENVKEY")
+
+	// enough output that copying is still running when the command exits,
+	// ending with a secret the redactor holds back until it's flushed
+	script := `i=0; while [ $i -lt 2000 ]; do echo "line $i $SECRET"; i=$((i+1)); done; printf "last $SECRET"`
+
+	out := captureStdout(t, func() {
+		cmd.RootCmd.SetArgs([]string{"--redact", "--", script})
+		assert.Nil(t, cmd.RootCmd.Execute())
+	})
+
+	assert.NotContains(t, out, secret)
+	assert.Contains(t, out, "line 0 ***SECRET***\n")
+	assert.Contains(t, out, "line 1999 ***SECRET***\n")
+	assert.True(t, strings.HasSuffix(out, "\nlast ***SECRET***"))
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
 	"github.com/envkey/envkey/public/sdks/envkey-source/shell"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 	"github.com/google/uuid"
 	"github.com/goware/prefixer"
@@ -44,7 +45,7 @@ var killingWatchCommandsById = map[uuid.UUID]*exec.Cmd{}
 var mutex sync.Mutex
 
 func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVersion string) {
-	if execCmdArg == "" && onChangeCmdArg == "" {
+	if execCmdArg == "" && onChangeCmdArg == "" && hooksPath == "" {
 		var res string
 		var err error
 
@@ -58,18 +59,19 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 			res, err = shell.Source(env, force, pamCompatible, dotEnvCompatible)
 		}
 
-		utils.CheckError(err, execCmdArg != "")
+		utils.CheckError(err, toStderr())
 		stdoutLogger.Println(res)
 
+		tracing.Wait(tracing.EXIT_TIMEOUT)
 		os.Exit(0)
 	}
 
 	execFn := func(latestEnv parser.EnvMap, previousEnv parser.EnvMap, onFinish func()) {
-		env := shell.ToPairs(latestEnv, previousEnv, true, force)
+		env := envPairs(latestEnv, previousEnv)
 		c := execute(execCmdArg, env, "attach", true, "")
 
 		mutex.Lock()
-		watchCommand = c
+		watchCommand = c.Cmd
 		mutex.Unlock()
 
 		c.Wait()
@@ -79,7 +81,9 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 		}
 	}
 
-	if onChangeCmdArg != "" || (execCmdArg != "" && watch) {
+	loadChangeHooks()
+
+	if onChangeCmdArg != "" || hooksPath != "" || (execCmdArg != "" && watch) {
 		go execFn(
 			env,
 			nil,
@@ -101,36 +105,12 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 		return
 	}
 
-	var onChange func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap)
-	onChange = func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
-		if isThrottlingChanges() {
-			setChangeQueued([]parser.EnvMap{updatedEnv, previousEnv})
-			return
-		}
+	onChange := throttleChanges(withRedaction(withSecretFiles(func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		// hooks match on their own key patterns, so they run regardless of --only
+		hookRestart := runChangeHooks(updatedEnv, previousEnv)
 
-		setIsThrottlingChanges(true)
-		go func() {
-			time.Sleep(time.Duration(watchThrottle) * time.Millisecond)
-			queued := getChangeQueued()
-			setChangeQueued(nil)
-			setIsThrottlingChanges(false)
-			if queued != nil {
-				onChange(queued[0], queued[1])
-			}
-		}()
-
-		if watchVars != nil && len(watchVars) > 0 {
-			watchVarChanged := false
-			for _, k := range watchVars {
-				trimmed := strings.TrimSpace(k)
-				if updatedEnv[trimmed] != previousEnv[trimmed] {
-					watchVarChanged = true
-					break
-				}
-			}
-			if !watchVarChanged {
-				return
-			}
+		if !watchVarsChanged(watchVars, updatedEnv, previousEnv) {
+			return
 		}
 
 		if onChangeCmdArg != "" {
@@ -139,7 +119,7 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 
 				execute(
 					onChangeCmdArg,
-					shell.ToPairs(updatedEnv, previousEnv, true, force),
+					envPairs(updatedEnv, previousEnv),
 					"copy",
 					false,
 					utils.FormatTerminal(" | on-reload > ", colors.Cyan),
@@ -149,7 +129,8 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 			}()
 		}
 
-		if execCmdArg != "" && watch {
+		// when --hooks has restart hooks, they decide when the watched command restarts
+		if execCmdArg != "" && watch && (hookRestart || !hasRestartHook()) {
 			go func() {
 				stderrLogger.Println(utils.FormatTerminal(" | reloading after update...", nil))
 
@@ -166,11 +147,56 @@ func execWithEnv(envkey string, env parser.EnvMap, clientName string, clientVers
 				)
 			}()
 		}
-	}
+	})))
 
 	daemon.ListenChangeWithEnv(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle, onChange)
 }
 
+// throttleChanges wraps an onChange handler so that it runs at most once
+// per --throttle interval. a change that arrives while throttling is
+// queued and handled when the interval elapses.
+func throttleChanges(handler func(parser.EnvMap, parser.EnvMap)) func(parser.EnvMap, parser.EnvMap) {
+	var onChange func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap)
+	onChange = func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		if isThrottlingChanges() {
+			setChangeQueued([]parser.EnvMap{updatedEnv, previousEnv})
+			return
+		}
+
+		setIsThrottlingChanges(true)
+		go func() {
+			time.Sleep(time.Duration(watchThrottle) * time.Millisecond)
+			queued := getChangeQueued()
+			setChangeQueued(nil)
+			setIsThrottlingChanges(false)
+			if queued != nil {
+				onChange(queued[0], queued[1])
+			}
+		}()
+
+		handler(updatedEnv, previousEnv)
+	}
+
+	return onChange
+}
+
+// watchVarsChanged returns true if any of vars differ between updatedEnv and
+// previousEnv, or if vars is empty
+func watchVarsChanged(vars []string, updatedEnv parser.EnvMap, previousEnv parser.EnvMap) bool {
+	if len(vars) == 0 {
+		return true
+	}
+
+	for _, k := range vars {
+		trimmed := strings.TrimSpace(k)
+		if updatedEnv[trimmed] != previousEnv[trimmed] {
+			return true
+		}
+	}
+
+	return false
+}
+
 func killWatchCommandIfRunning(sig syscall.Signal) {
 	setIsKillingWatch(true)
 	defer setIsKillingWatch(false)
@@ -209,41 +235,56 @@ func killWatchCommandIfRunning(sig syscall.Signal) {
 	mutex.Unlock()
 }
 
-func execute(c string, env []string, copyOrAttach string, includeStdin bool, copyOutputPrefix string) *exec.Cmd {
-	// if we're in an environment where a shell (`sh`) is defined, use that
-	// so we get shell expansion/other shell features.
-	// if we're on windows and not in a bash-like env where `sh` is defined, pass to `cmd`.
-	// otherwise, try passing the command directly to the system.
-	var command *exec.Cmd
-	if utils.CommandExists("sh") {
-		command = exec.Command("sh", "-c", c)
-	} else if runtime.GOOS == "windows" {
-		re := regexp.MustCompile(`\s+`)
-		args := []string{"/C"}
-		args = append(args, re.Split(c, -1)...)
-		command = exec.Command("cmd", args...)
-	} else {
-		command = exec.Command(c)
-	}
+// runningCommand is a started command, along with the goroutines copying
+// its output
+type runningCommand struct {
+	*exec.Cmd
+	copying sync.WaitGroup
+}
+
+// Wait waits for the command's output to be copied, then for it to exit--
+// exec.Cmd's Wait closes the pipes, so it can't be called first
+func (c *runningCommand) Wait() error {
+	c.copying.Wait()
+	return c.Cmd.Wait()
+}
+
+// copyOutput copies src to dst in the background (see the copyOutput func),
+// tracked so Wait doesn't return until it's done
+func (c *runningCommand) copyOutput(dst io.Writer, src io.Reader) {
+	c.copying.Add(1)
+	go func() {
+		defer c.copying.Done()
+		copyOutput(dst, src)
+	}()
+}
 
+func execute(c string, env []string, copyOrAttach string, includeStdin bool, copyOutputPrefix string) *runningCommand {
+	command := shellCommand(c)
 	command.Env = env
+	running := &runningCommand{Cmd: command}
+
+	// redacted output has to be piped, so the command can't be attached
+	if outputRedactor != nil && copyOrAttach == "attach" {
+		copyOrAttach = "copy"
+	}
 
 	if copyOrAttach == "copy" {
 		outPipe, err := command.StdoutPipe()
-		utils.CheckError(err, execCmdArg != "")
+		utils.CheckError(err, toStderr())
 		errPipe, err := command.StderrPipe()
-		utils.CheckError(err, execCmdArg != "")
+		utils.CheckError(err, toStderr())
 
 		var inPipe io.WriteCloser
 		if includeStdin {
 			inPipe, err = command.StdinPipe()
-			utils.CheckError(err, execCmdArg != "")
+			utils.CheckError(err, toStderr())
 		}
 
-		utils.CheckError(err, execCmdArg != "")
+		utils.CheckError(err, toStderr())
 
-		go io.Copy(os.Stdout, prefixer.New(outPipe, copyOutputPrefix))
-		go io.Copy(os.Stderr, prefixer.New(errPipe, copyOutputPrefix))
+		running.copyOutput(os.Stdout, prefixer.New(outPipe, copyOutputPrefix))
+		running.copyOutput(os.Stderr, prefixer.New(errPipe, copyOutputPrefix))
 
 		if includeStdin {
 			go io.Copy(inPipe, os.Stdin)
@@ -258,9 +299,26 @@ func execute(c string, env []string, copyOrAttach string, includeStdin bool, cop
 	}
 
 	err := command.Start()
-	utils.CheckError(err, execCmdArg != "")
+	utils.CheckError(err, toStderr())
+
+	return running
+}
+
+func shellCommand(c string) *exec.Cmd {
+	// if we're in an environment where a shell (`sh`) is defined, use that
+	// so we get shell expansion/other shell features.
+	// if we're on windows and not in a bash-like env where `sh` is defined, pass to `cmd`.
+	// otherwise, try passing the command directly to the system.
+	if utils.CommandExists("sh") {
+		return exec.Command("sh", "-c", c)
+	} else if runtime.GOOS == "windows" {
+		re := regexp.MustCompile(`\s+`)
+		args := []string{"/C"}
+		args = append(args, re.Split(c, -1)...)
+		return exec.Command("cmd", args...)
+	}
 
-	return command
+	return exec.Command(c)
 }
 
 func isKillingWatch() bool {
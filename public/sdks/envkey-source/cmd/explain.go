@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/env"
+)
+
+// explain prints every layer that set each var--see env.Explain
+func explain(vars []string, provenance env.Provenance) {
+	env.Explain(os.Stdout, vars, provenance, explainValues)
+
+	if force {
+		fmt.Println("\n(--force is set, so only ENVKEY values are used)")
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/bundle"
+	"github.com/envkey/envkey/public/sdks/envkey-source/env"
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	"github.com/envkey/envkey/public/sdks/envkey-source/version"
+	"github.com/spf13/cobra"
+)
+
+var exportBundlePath string
+var exportExpires string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Save your encrypted EnvKey environment to a bundle for loading offline with --from-bundle",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		execExport()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportBundlePath, "bundle", "", "path to write the bundle (required)")
+	exportCmd.Flags().StringVar(&exportExpires, "expires", "", "bundle can't be loaded after this long, e.g. 72h or 30d (default is no expiry)--advisory, since anyone with the ENVKEY can re-sign the bundle or roll the clock back")
+
+	exportCmd.Flags().StringVar(&envFileOverride, "env-file", "", "Explicitly set path to ENVKEY-containing .env file (optional)")
+	exportCmd.Flags().StringVar(&profile, "profile", "", "prefer .env.{profile} and .envkey.{profile} files, and use ~/.envkey/apps/{appId}.{profile}.env (default is $ENVKEY_PROFILE)")
+	exportCmd.Flags().BoolVar(&monorepo, "monorepo", false, "resolve ENVKEY from the nearest .envkey or .env file with an ENVKEY, stopping at the VCS root or --boundary-file")
+	exportCmd.Flags().StringVar(&boundaryFile, "boundary-file", "", "with --monorepo, stop walking up directories at a directory containing this file")
+	exportCmd.Flags().BoolVar(&verboseOutput, "verbose", false, "print verbose output (default is false)")
+	exportCmd.Flags().Float64Var(&timeoutSeconds, "timeout", 20.0, "timeout in seconds for http requests")
+	exportCmd.Flags().Uint8Var(&retries, "retries", 3, "number of times to retry requests on failure")
+	exportCmd.Flags().Float64Var(&retryBackoff, "retry-backoff", 1, "seconds to wait before the first retry, doubling on each retry after that (longer if the server sends Retry-After)")
+	exportCmd.Flags().Float64Var(&retryJitter, "retry-jitter", fetch.DEFAULT_RETRY_JITTER, "fraction of each retry wait that's randomized, e.g. 0.2 for +/- 20%")
+	exportCmd.Flags().Float64Var(&retryDeadline, "retry-deadline", 0, "if > 0, max seconds to spend on all fetch attempts and retries")
+	exportCmd.Flags().Float64Var(&hedgeDelaySeconds, "hedge-delay", 0, "if > 0, request failover hosts in parallel after this many seconds without a response from the primary host")
+}
+
+func execExport() {
+	initClientLogging()
+	initClientTracing()
+
+	if exportBundlePath == "" {
+		utils.Fatal("--bundle is required", true)
+	}
+
+	var expiresIn time.Duration
+	if exportExpires != "" {
+		var err error
+		expiresIn, err = bundle.ParseExpiry(exportExpires)
+		utils.CheckError(err, true)
+	}
+
+	envkey, _, _ := env.GetEnvkeyLayers(getEnvkeyOptions())
+	if envkey == "" {
+		utils.Fatal("ENVKEY missing\n", true)
+	}
+
+	b, err := fetch.FetchBundle(context.Background(), envkey, fetch.FetchOptions{
+		ClientName:        "envkey-source",
+		ClientVersion:     version.Version,
+		VerboseOutput:     verboseOutput,
+		TimeoutSeconds:    timeoutSeconds,
+		HedgeDelaySeconds: hedgeDelaySeconds,
+		RetryPolicy:       retryPolicy(),
+	}, expiresIn)
+	utils.CheckError(err, true)
+
+	err = b.Write(exportBundlePath)
+	utils.CheckError(err, true)
+
+	msg := "wrote bundle to " + exportBundlePath
+	if b.Meta.ExpiresAt != "" {
+		msg += " (expires " + b.Meta.ExpiresAt + ")"
+	}
+	fmt.Fprintln(os.Stderr, msg)
+}
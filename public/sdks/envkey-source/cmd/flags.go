@@ -1,7 +1,16 @@
 package cmd
 
+import (
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/redact"
+)
+
 var cacheDir string
 var envFileOverride string
+var profile string
+var monorepo bool
+var boundaryFile string
+var printResolution bool
 var shouldCache bool
 var force bool
 var printVersion bool
@@ -11,6 +20,10 @@ var verboseOutput bool
 var timeoutSeconds float64
 var retries uint8
 var retryBackoff float64
+var retryJitter float64
+var retryDeadline float64
+var hedgeDelaySeconds float64
+var fromBundlePath string
 
 var localDevHost bool
 
@@ -23,8 +36,21 @@ var memCache bool
 var watchThrottle uint32
 var rollingReload bool
 var rollingPct uint8
+var procfilePath string
+var hooksPath string
+var webhookUrls []string
+var webhookSecret string
+var webhookIncludeValues bool
+var syncToPath string
+var syncFormat string
+var syncOnInvalid string
+var secretsDir string
+var redactOutput bool
+var redactMinLength int
 
 var resolveEnvkey bool
+var explainVars []string
+var explainValues bool
 
 var shellHook string
 var ignoreMissing bool
@@ -33,22 +59,60 @@ var unset bool
 var jsonFormat bool
 var yamlFormat bool
 
+var logFormat string
+var logDir string
+var logLevel string
+
+var auditLogArg string
+
+var traceFile string
+var traceEndpoint string
+
 var clientNameArg string
 var clientVersionArg string
 
 func init() {
 	RootCmd.PersistentFlags().BoolP("help", "h", false, "help for envkey-source")
 
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "format for client and daemon log files: text or json")
+	RootCmd.PersistentFlags().StringVar(&logDir, "log-dir", "", "directory for client and daemon log files (default is $HOME/.envkey/logs)")
+	RootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "min level written to log files: debug, info, warn, or error")
+	RootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "append OTLP/JSON tracing spans for fetches, failover, and decryption to this file")
+	RootCmd.PersistentFlags().StringVar(&traceEndpoint, "trace-endpoint", "", "send OTLP/JSON tracing spans to a collector, e.g. http://localhost:4318/v1/traces (default is $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)")
+	RootCmd.PersistentFlags().StringVar(&auditLogArg, "audit-log", "", "append a hash-chained record of each env delivered to this file (default is $ENVKEY_AUDIT_LOG, or none)")
+
 	RootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "re-run command whenever environment is updated (default is false)")
 	RootCmd.Flags().StringVarP(&onChangeCmdArg, "on-reload", "r", "", "command to execute when environment is updated (default is none)")
-	RootCmd.Flags().StringSliceVar(&watchVars, "only", nil, "with -w or -r, reload only when specific vars change (comma-delimited list)")
+	RootCmd.Flags().StringSliceVar(&watchVars, "only", nil, "with -w, -r, or --procfile, reload only when specific vars change (comma-delimited list, prefix with process name for --procfile, e.g. web:DATABASE_URL)")
+	RootCmd.Flags().StringVar(&hooksPath, "hooks", "", "yaml or json file mapping var name patterns to commands to run when matching vars change")
 	RootCmd.Flags().Uint32Var(&watchThrottle, "throttle", 5000, "min delay between reloads with -w, -r, or --rolling")
 
 	RootCmd.Flags().BoolVar(&rollingReload, "rolling", false, "no-downtime rolling reloads across all connected processes with -w or -r")
 	RootCmd.Flags().Uint8Var(&rollingPct, "rolling-pct", 25, "min % of connected processes to reload in each batch with --rolling")
 
+	RootCmd.Flags().StringVar(&procfilePath, "procfile", "", "run and watch every process in a Procfile, restarting processes when environment is updated")
+
+	RootCmd.Flags().StringSliceVar(&webhookUrls, "webhook", nil, "with -m, -w, -r, --hooks, --procfile, --sync-to, or --secrets-dir, url(s) the daemon will POST changed var names to when environment is updated (comma-delimited list)")
+	RootCmd.Flags().StringVar(&webhookSecret, "webhook-secret", "", "secret for HMAC-SHA256 webhook signatures (default is $ENVKEY_WEBHOOK_SECRET)")
+	RootCmd.Flags().BoolVar(&webhookIncludeValues, "webhook-values", false, "include previous and current values of changed vars in webhook payloads (default is false)")
+
+	RootCmd.Flags().StringVar(&syncToPath, "sync-to", "", "keep a file continuously up to date with the latest environment (use -r to run a command after each write)")
+	RootCmd.Flags().StringVar(&syncFormat, "format", "dotenv", "with --sync-to, file format: dotenv, json, or yaml")
+	RootCmd.Flags().StringVar(&syncOnInvalid, "sync-on-invalid", "remove", "with --sync-to or --secrets-dir, what to do with files if ENVKEY becomes invalid: remove or blank")
+
+	RootCmd.Flags().StringVar(&secretsDir, "secrets-dir", "", "write each var to its own file in this directory and pass {VAR}_FILE paths to commands instead of values")
+
+	RootCmd.Flags().BoolVar(&redactOutput, "redact", false, "mask secret values (and their base64 and url-encoded forms) in command output as ***VAR_NAME*** (default is false)")
+	RootCmd.Flags().IntVar(&redactMinLength, "redact-min-length", redact.DEFAULT_MIN_LENGTH, "with --redact, only mask values at least this long")
+
 	RootCmd.Flags().BoolVarP(&force, "force", "f", false, "overwrite existing environment variables and/or other entries in .env file")
 	RootCmd.Flags().StringVar(&envFileOverride, "env-file", "", "Explicitly set path to ENVKEY-containing .env file (optional)")
+	RootCmd.Flags().StringVar(&profile, "profile", "", "prefer .env.{profile} and .envkey.{profile} files, and use ~/.envkey/apps/{appId}.{profile}.env (default is $ENVKEY_PROFILE)")
+	RootCmd.Flags().BoolVar(&monorepo, "monorepo", false, "resolve ENVKEY from the nearest .envkey or .env file with an ENVKEY, stopping at the VCS root or --boundary-file, and only apply .env overrides at or below it")
+	RootCmd.Flags().StringVar(&boundaryFile, "boundary-file", "", "with --monorepo, stop walking up directories at a directory containing this file (VCS roots always stop the walk)")
+	RootCmd.Flags().BoolVar(&printResolution, "print-resolution", false, "print how --monorepo resolves ENVKEY and .env files from the current directory, then exit")
+	RootCmd.Flags().StringSliceVar(&explainVars, "explain", nil, "print which layer (ENVKEY, app env file, .env, .env.local, or shell) each var's final value came from, then exit (comma-delimited list)")
+	RootCmd.Flags().BoolVar(&explainValues, "explain-values", false, "with --explain, print each layer's value instead of its length and a short hash (default is false)")
 
 	RootCmd.Flags().StringVar(&shellHook, "hook", "", "hook for shell config to automatically sync when entering directory")
 	RootCmd.Flags().BoolVar(&killDaemon, "kill", false, "kills watcher daemon process if it's running")
@@ -62,7 +126,12 @@ func init() {
 	RootCmd.Flags().BoolVar(&verboseOutput, "verbose", false, "print verbose output (default is false)")
 	RootCmd.Flags().Float64Var(&timeoutSeconds, "timeout", 20.0, "timeout in seconds for http requests")
 	RootCmd.Flags().Uint8Var(&retries, "retries", 3, "number of times to retry requests on failure")
-	RootCmd.Flags().Float64Var(&retryBackoff, "retry-backoff", 1, "retry backoff factor: {retry-backoff} * (2 ^ {retries - 1})")
+	RootCmd.Flags().Float64Var(&retryBackoff, "retry-backoff", 1, "seconds to wait before the first retry, doubling on each retry after that (longer if the server sends Retry-After)")
+	RootCmd.Flags().Float64Var(&retryJitter, "retry-jitter", fetch.DEFAULT_RETRY_JITTER, "fraction of each retry wait that's randomized, e.g. 0.2 for +/- 20%")
+	RootCmd.Flags().Float64Var(&retryDeadline, "retry-deadline", 0, "if > 0, max seconds to spend on all fetch attempts and retries")
+	RootCmd.Flags().Float64Var(&hedgeDelaySeconds, "hedge-delay", 0, "if > 0, request failover hosts in parallel after this many seconds without a response from the primary host, using the first successful response (default is to try failovers only after the primary fails)")
+
+	RootCmd.Flags().StringVar(&fromBundlePath, "from-bundle", "", "load the environment offline from a bundle saved with export --bundle instead of fetching it")
 
 	// differences between bash syntax and the /etc/environment format, as parsed by PAM
 	// (https://github.com/linux-pam/linux-pam/blob/master/modules/pam_env/pam_env.c#L194)
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/hooks"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	"github.com/goware/prefixer"
+	colors "github.com/logrusorgru/aurora/v3"
+)
+
+var changeHooks []hooks.Hook
+
+func loadChangeHooks() {
+	if hooksPath == "" {
+		return
+	}
+
+	var err error
+	changeHooks, err = hooks.Load(hooksPath)
+	utils.CheckError(err, toStderr())
+}
+
+// runChangeHooks runs every hook with a key pattern matching a changed var,
+// and returns true if any matching hook requested a restart
+func runChangeHooks(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) bool {
+	if len(changeHooks) == 0 {
+		return false
+	}
+
+	changes := hooks.Changes(updatedEnv, previousEnv)
+	if len(changes) == 0 {
+		return false
+	}
+
+	shouldRestart := false
+
+	for _, hook := range changeHooks {
+		matched := hook.Match(changes)
+		if len(matched) == 0 {
+			continue
+		}
+
+		if hook.Restart {
+			shouldRestart = true
+		}
+
+		if hook.Run == "" {
+			continue
+		}
+
+		payload, err := hooks.Payload{Changes: matched}.ToJson()
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't encode hook payload: "+err.Error(), colors.Red))
+			continue
+		}
+
+		go executeHook(hook.Run, envPairs(updatedEnv, previousEnv), payload)
+	}
+
+	return shouldRestart
+}
+
+func hasRestartHook() bool {
+	for _, hook := range changeHooks {
+		if hook.Restart {
+			return true
+		}
+	}
+	return false
+}
+
+func executeHook(c string, env []string, payload []byte) {
+	command := shellCommand(c)
+	command.Env = env
+	command.Stdin = bytes.NewReader(payload)
+
+	prefix := utils.FormatTerminal(" | hook > ", colors.Cyan)
+
+	// hooks get secrets in their env and payload, so their output is redacted
+	// like the command's
+	running := &runningCommand{Cmd: command}
+
+	outPipe, err := command.StdoutPipe()
+	if err == nil {
+		running.copyOutput(os.Stdout, prefixer.New(outPipe, prefix))
+	}
+	errPipe, err := command.StderrPipe()
+	if err == nil {
+		running.copyOutput(os.Stderr, prefixer.New(errPipe, prefix))
+	}
+
+	err = command.Start()
+	if err != nil {
+		stderrLogger.Println(utils.FormatTerminal(" | couldn't run hook '"+c+"': "+err.Error(), colors.Red))
+		return
+	}
+
+	running.Wait()
+}
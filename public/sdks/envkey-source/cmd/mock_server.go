@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+var mockServerEnvFiles []string
+var mockServerPort int
+var mockServerHost string
+var mockServerCertOut string
+var mockServerFaults []string
+var mockServerDelays []string
+var mockServerRetryAfter string
+var mockServerNoETags bool
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Run a local fake EnvKey host serving plaintext .env files, for end-to-end testing",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		execMockServer()
+	},
+}
+
+var mockServerEndpoints = map[string]int{
+	"primary":    mockserver.ENDPOINT_PRIMARY,
+	"in-region":  mockserver.ENDPOINT_IN_REGION_FAILOVER,
+	"failover":   mockserver.ENDPOINT_FAILOVER,
+	"signed-url": mockserver.ENDPOINT_SIGNED_URL,
+}
+
+func init() {
+	RootCmd.AddCommand(mockServerCmd)
+
+	mockServerCmd.Flags().StringSliceVar(&mockServerEnvFiles, "env", nil, "plaintext .env file to generate an ENVKEY for--changes are pushed to connected clients (required, repeatable)")
+	mockServerCmd.Flags().IntVar(&mockServerPort, "port", 19411, "port to listen on")
+	mockServerCmd.Flags().StringVar(&mockServerHost, "host", mockserver.DEFAULT_HOST, "hostname in generated ENVKEYs--it and its failover hostname (e.g. envkey-2.localhost) must resolve to this machine")
+	mockServerCmd.Flags().StringVar(&mockServerCertOut, "cert-out", filepath.Join(os.TempDir(), "envkey-mock-server.pem"), "path to write the server's self-signed certificate")
+	mockServerCmd.Flags().StringSliceVar(&mockServerFaults, "fail", nil, "make an endpoint respond with a status, or drop connections, e.g. primary=503 or in-region=drop (endpoints: primary, in-region, failover, signed-url)")
+	mockServerCmd.Flags().StringSliceVar(&mockServerDelays, "delay", nil, "make an endpoint wait before responding, e.g. primary=2s")
+	mockServerCmd.Flags().StringVar(&mockServerRetryAfter, "retry-after", "", "Retry-After header for --fail responses, e.g. 5 with primary=429")
+	mockServerCmd.Flags().BoolVar(&mockServerNoETags, "no-etags", false, "don't send ETags or respond to If-None-Match, like a server without conditional request support")
+}
+
+func execMockServer() {
+	if len(mockServerEnvFiles) == 0 {
+		utils.Fatal("at least one --env file is required", true)
+	}
+
+	faults, err := mockServerFaultsFromFlags()
+	utils.CheckError(err, true)
+
+	server, err := mockserver.New(mockserver.Options{
+		Addr:    "127.0.0.1:" + strconv.Itoa(mockServerPort),
+		Host:    mockServerHost,
+		NoETags: mockServerNoETags,
+	})
+	utils.CheckError(err, true)
+	defer server.Close()
+
+	for endpoint, fault := range faults {
+		f := fault
+		server.SetFault(endpoint, &f)
+	}
+
+	err = ioutil.WriteFile(mockServerCertOut, server.CertPEM(), 0644)
+	utils.CheckError(err, true)
+
+	envkeys := make([]string, len(mockServerEnvFiles))
+	for i, path := range mockServerEnvFiles {
+		envkeys[i], err = server.AddEnvFile(path)
+		utils.CheckError(err, true)
+		fmt.Printf("%s: ENVKEY=%s\n", path, envkeys[i])
+	}
+
+	fmt.Fprintf(os.Stderr, "mock EnvKey host listening on %s\n", server.Addr())
+	fmt.Fprintf(os.Stderr, "trust its certificate with: export SSL_CERT_FILE=%s\n", mockServerCertOut)
+	if failoverHostname := mockserver.FailoverHostname(mockServerHost); failoverHostname != mockServerHost {
+		fmt.Fprintf(os.Stderr, "%s and %s must resolve to 127.0.0.1 (add them to /etc/hosts if they don't)\n", mockServerHost, failoverHostname)
+	}
+
+	go watchMockServerEnvFiles(server, envkeys)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
+
+// watchMockServerEnvFiles polls the env files, updating envs and notifying
+// connected clients when they change
+func watchMockServerEnvFiles(server *mockserver.Server, envkeys []string) {
+	modTimes := make([]time.Time, len(mockServerEnvFiles))
+	for i, path := range mockServerEnvFiles {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+
+	for {
+		time.Sleep(time.Second)
+
+		for i, path := range mockServerEnvFiles {
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTimes[i]) {
+				continue
+			}
+			modTimes[i] = info.ModTime()
+
+			env, err := godotenv.Read(path)
+			if err == nil {
+				err = server.UpdateEnv(envkeys[i], env)
+			}
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "couldn't update %s: %s\n", path, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s changed--notified %d connected clients\n", path, server.Connections(envkeys[i]))
+			}
+		}
+	}
+}
+
+func mockServerFaultsFromFlags() (map[int]mockserver.Fault, error) {
+	faults := map[int]mockserver.Fault{}
+
+	parse := func(arg string) (int, string, error) {
+		split := strings.SplitN(arg, "=", 2)
+		endpoint, ok := mockServerEndpoints[split[0]]
+		if len(split) != 2 || !ok {
+			return 0, "", fmt.Errorf("invalid endpoint setting: %s (use endpoint=value, with endpoint one of primary, in-region, failover, or signed-url)", arg)
+		}
+		return endpoint, split[1], nil
+	}
+
+	for _, arg := range mockServerFaults {
+		endpoint, val, err := parse(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		fault := faults[endpoint]
+		if val == "drop" {
+			fault.Drop = true
+		} else {
+			fault.Status, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --fail status: %s (use a status code or drop)", val)
+			}
+			fault.RetryAfter = mockServerRetryAfter
+		}
+		faults[endpoint] = fault
+	}
+
+	for _, arg := range mockServerDelays {
+		endpoint, val, err := parse(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		fault := faults[endpoint]
+		fault.Delay, err = time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --delay duration: %s", val)
+		}
+		faults[endpoint] = fault
+	}
+
+	return faults, nil
+}
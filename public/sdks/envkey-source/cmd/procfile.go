@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/procfile"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	colors "github.com/logrusorgru/aurora/v3"
+)
+
+var procfileColors = []func(interface{}) colors.Value{
+	colors.Cyan,
+	colors.Yellow,
+	colors.Magenta,
+	colors.Blue,
+	colors.BrightGreen,
+	colors.BrightRed,
+}
+
+type procfileProcess struct {
+	entry  procfile.Entry
+	prefix string
+
+	// serializes restarts of this process
+	restartMutex sync.Mutex
+
+	// guarded by the package mutex
+	cmd     *exec.Cmd
+	done    chan struct{}
+	killing bool
+}
+
+var procfileProcesses []*procfileProcess
+
+func execProcfile(envkey string, env parser.EnvMap, clientName string, clientVersion string) {
+	entries, err := procfile.Read(procfilePath)
+	utils.CheckError(err, toStderr())
+
+	only, err := procfile.ParseWatchVars(watchVars, entries)
+	utils.CheckError(err, toStderr())
+
+	maxNameLen := 0
+	for _, entry := range entries {
+		if len(entry.Name) > maxNameLen {
+			maxNameLen = len(entry.Name)
+		}
+	}
+
+	for i, entry := range entries {
+		p := &procfileProcess{
+			entry: entry,
+			prefix: utils.FormatPrefix(
+				fmt.Sprintf("%-*s | ", maxNameLen, entry.Name),
+				procfileColors[i%len(procfileColors)],
+			),
+		}
+
+		mutex.Lock()
+		procfileProcesses = append(procfileProcesses, p)
+		mutex.Unlock()
+
+		p.start(env, nil)
+	}
+
+	onChange := throttleChanges(withRedaction(withSecretFiles(func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		var toRestart []*procfileProcess
+		var names []string
+
+		for _, p := range getProcfileProcesses() {
+			if only.ShouldRestart(p.entry.Name, updatedEnv, previousEnv) {
+				toRestart = append(toRestart, p)
+				names = append(names, p.entry.Name)
+			}
+		}
+
+		if len(toRestart) == 0 {
+			return
+		}
+
+		stderrLogger.Println(utils.FormatTerminal(" | reloading "+strings.Join(names, ", ")+" after update...", nil))
+
+		for _, p := range toRestart {
+			go p.restart(updatedEnv, previousEnv)
+		}
+	})))
+
+	daemon.ListenChangeWithEnv(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle, onChange)
+}
+
+func (p *procfileProcess) start(latestEnv parser.EnvMap, previousEnv parser.EnvMap) {
+	c := execute(p.entry.Command, envPairs(latestEnv, previousEnv), "copy", false, p.prefix)
+	done := make(chan struct{})
+
+	mutex.Lock()
+	p.cmd = c.Cmd
+	p.done = done
+	mutex.Unlock()
+
+	go func() {
+		err := c.Wait()
+
+		mutex.Lock()
+		killing := p.killing
+		if p.cmd == c.Cmd {
+			p.cmd = nil
+		}
+		mutex.Unlock()
+
+		close(done)
+
+		if !killing {
+			msg := " | " + p.entry.Name + " exited"
+			if err != nil {
+				msg = msg + ": " + err.Error()
+			}
+			stderrLogger.Println(utils.FormatTerminal(msg+" | waiting for changes...", colors.Red))
+		}
+	}()
+}
+
+func (p *procfileProcess) stop(sig syscall.Signal) {
+	mutex.Lock()
+	c := p.cmd
+	done := p.done
+	p.killing = true
+	mutex.Unlock()
+
+	defer func() {
+		mutex.Lock()
+		p.killing = false
+		mutex.Unlock()
+	}()
+
+	if c == nil {
+		return
+	}
+
+	// ignore errors on Signal since process may already have finished
+	c.Process.Signal(sig)
+
+	select {
+	case <-done:
+	case <-time.After(EXIT_SIGNAL_TIMEOUT):
+		c.Process.Signal(os.Kill)
+		<-done
+	}
+}
+
+func (p *procfileProcess) restart(latestEnv parser.EnvMap, previousEnv parser.EnvMap) {
+	p.restartMutex.Lock()
+	defer p.restartMutex.Unlock()
+
+	p.stop(syscall.SIGTERM)
+	p.start(latestEnv, previousEnv)
+}
+
+func killProcfileProcessesIfRunning(sig syscall.Signal) {
+	var wg sync.WaitGroup
+
+	for _, p := range getProcfileProcesses() {
+		wg.Add(1)
+		go func(p *procfileProcess) {
+			defer wg.Done()
+			p.stop(sig)
+		}(p)
+	}
+
+	wg.Wait()
+}
+
+func getProcfileProcesses() []*procfileProcess {
+	mutex.Lock()
+	res := procfileProcesses
+	mutex.Unlock()
+
+	return res
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/redact"
+)
+
+// with --redact, output from executed commands is piped through
+// outputRedactor to mask secret values
+var outputRedactor *redact.Redactor
+
+func initRedaction(env parser.EnvMap) {
+	if !redactOutput {
+		return
+	}
+
+	outputRedactor = redact.New(redactMinLength)
+	outputRedactor.Update(env)
+}
+
+// withRedaction wraps an onChange handler so that redacted values are
+// updated before the handler runs
+func withRedaction(handler func(parser.EnvMap, parser.EnvMap)) func(parser.EnvMap, parser.EnvMap) {
+	if outputRedactor == nil {
+		return handler
+	}
+
+	return func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		outputRedactor.Update(updatedEnv)
+		handler(updatedEnv, previousEnv)
+	}
+}
+
+func copyOutput(dst io.Writer, src io.Reader) {
+	// hides src's WriteTo, since prefixer's drops a last line without a
+	// trailing newline
+	src = struct{ io.Reader }{src}
+
+	if outputRedactor == nil {
+		io.Copy(dst, src)
+		return
+	}
+
+	w := outputRedactor.NewWriter(dst)
+	io.Copy(w, src)
+	w.Flush()
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/render"
+	"github.com/envkey/envkey/public/sdks/envkey-source/sink"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	colors "github.com/logrusorgru/aurora/v3"
+	"github.com/spf13/cobra"
+)
+
+var renderTemplatePath string
+var renderOutPath string
+var renderMode string
+
+var renderingTemplate = false
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a Go text/template config file with your EnvKey environment",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		execRender()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(renderCmd)
+
+	renderCmd.Flags().StringVarP(&renderTemplatePath, "template", "t", "", "path to template file (required)")
+	renderCmd.Flags().StringVarP(&renderOutPath, "out", "o", "", "path to write rendered output (default is stdout)")
+	renderCmd.Flags().StringVar(&renderMode, "mode", "", "permissions for the output file, e.g. 0640--overrides fileMode in the template (default is 0600)")
+
+	renderCmd.Flags().BoolVarP(&watch, "watch", "w", false, "re-render whenever environment is updated (default is false)")
+	renderCmd.Flags().StringVarP(&onChangeCmdArg, "on-reload", "r", "", "command to execute after the rendered output changes (implies -w)")
+	renderCmd.Flags().StringSliceVar(&watchVars, "only", nil, "with -w or -r, re-render only when specific vars change (comma-delimited list)")
+	renderCmd.Flags().Uint32Var(&watchThrottle, "throttle", 5000, "min delay between re-renders with -w or -r")
+
+	renderCmd.Flags().BoolVarP(&force, "force", "f", false, "ignore overrides from existing environment variables and .env files")
+	renderCmd.Flags().StringVar(&envFileOverride, "env-file", "", "Explicitly set path to ENVKEY-containing .env file (optional)")
+	renderCmd.Flags().StringVar(&profile, "profile", "", "prefer .env.{profile} and .envkey.{profile} files, and use ~/.envkey/apps/{appId}.{profile}.env (default is $ENVKEY_PROFILE)")
+	renderCmd.Flags().BoolVar(&monorepo, "monorepo", false, "resolve ENVKEY from the nearest .envkey or .env file with an ENVKEY, stopping at the VCS root or --boundary-file")
+	renderCmd.Flags().StringVar(&boundaryFile, "boundary-file", "", "with --monorepo, stop walking up directories at a directory containing this file")
+	renderCmd.Flags().BoolVarP(&shouldCache, "cache", "c", false, "cache encrypted config on disk as a local backup for offline work (default is false)")
+	renderCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "cache directory (default is $HOME/.envkey/cache)")
+	renderCmd.Flags().BoolVar(&verboseOutput, "verbose", false, "print verbose output (default is false)")
+	renderCmd.Flags().Float64Var(&timeoutSeconds, "timeout", 20.0, "timeout in seconds for http requests")
+	renderCmd.Flags().Uint8Var(&retries, "retries", 3, "number of times to retry requests on failure")
+	renderCmd.Flags().Float64Var(&retryBackoff, "retry-backoff", 1, "seconds to wait before the first retry, doubling on each retry after that (longer if the server sends Retry-After)")
+	renderCmd.Flags().Float64Var(&retryJitter, "retry-jitter", fetch.DEFAULT_RETRY_JITTER, "fraction of each retry wait that's randomized, e.g. 0.2 for +/- 20%")
+	renderCmd.Flags().Float64Var(&retryDeadline, "retry-deadline", 0, "if > 0, max seconds to spend on all fetch attempts and retries")
+	renderCmd.Flags().StringVar(&fromBundlePath, "from-bundle", "", "load the environment offline from a bundle saved with export --bundle instead of fetching it")
+	renderCmd.Flags().Float64Var(&hedgeDelaySeconds, "hedge-delay", 0, "if > 0, request failover hosts in parallel after this many seconds without a response from the primary host")
+}
+
+func execRender() {
+	renderingTemplate = true
+	initClientLogging()
+	initClientTracing()
+
+	if renderTemplatePath == "" {
+		utils.Fatal("-t/--template is required", toStderr())
+	}
+
+	watching := watch || onChangeCmdArg != ""
+
+	if watching && renderOutPath == "" {
+		utils.Fatal("-w and -r require -o/--out", toStderr())
+	}
+
+	if fromBundlePath != "" && watching {
+		utils.Fatal("--from-bundle loads an env offline, so it can't be used with -w or -r", toStderr())
+	}
+
+	envkey, env, clientName, clientVersion := loadEnv(watching, true)
+
+	output, err := renderTemplate(env)
+	utils.CheckError(err, toStderr())
+
+	if !watching {
+		return
+	}
+
+	stderrLogger.Println(utils.FormatTerminal(" | rendered "+renderOutPath+"--waiting for changes...", nil))
+
+	onChange := throttleChanges(func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		if !watchVarsChanged(watchVars, updatedEnv, previousEnv) {
+			return
+		}
+
+		res, err := render.RenderFile(renderTemplatePath, updatedEnv)
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't render "+renderTemplatePath+": "+err.Error(), colors.Red))
+			return
+		}
+
+		// only write and run -r when the update actually changes the output
+		if bytes.Equal(res.Output, output) {
+			if verboseOutput {
+				stderrLogger.Println(utils.FormatTerminal(" | environment updated--no change to "+renderOutPath, nil))
+			}
+			return
+		}
+
+		err = writeRendered(res)
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't write "+renderOutPath+": "+err.Error(), colors.Red))
+			return
+		}
+		output = res.Output
+
+		stderrLogger.Println(utils.FormatTerminal(" | rendered "+renderOutPath+" after update", nil))
+
+		if onChangeCmdArg != "" {
+			execute(
+				onChangeCmdArg,
+				envPairs(updatedEnv, previousEnv),
+				"copy",
+				false,
+				utils.FormatTerminal(" | on-reload > ", colors.Cyan),
+			).Wait()
+		}
+	})
+
+	daemon.ListenChangeWithEnv(envkey, clientName, clientVersion, false, 0, watchThrottle, onChange)
+}
+
+// renderTemplate renders the template and writes it to --out or stdout,
+// returning the rendered output
+func renderTemplate(env parser.EnvMap) ([]byte, error) {
+	res, err := render.RenderFile(renderTemplatePath, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if renderOutPath == "" {
+		_, err = os.Stdout.Write(res.Output)
+		return res.Output, err
+	}
+
+	return res.Output, writeRendered(res)
+}
+
+func writeRendered(res render.Result) error {
+	mode := os.FileMode(sink.FILE_MODE)
+	if res.Mode != 0 {
+		mode = res.Mode
+	}
+	if renderMode != "" {
+		var err error
+		mode, err = render.ParseMode(renderMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sink.WriteFileWithMode(renderOutPath, res.Output, mode)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -11,15 +12,22 @@ import (
 var RootCmd = &cobra.Command{
 	Use:   use,
 	Short: "Cross-platform integration tool to load an EnvKey environment in development or on a server.",
+	// any args that aren't a subcommand are the shell command to run
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		run(cmd, args, true)
+		run(cmd, args)
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	err := RootCmd.Execute()
+
+	// traces are exported in the background--see tracing.Wait
+	tracing.Wait(tracing.EXIT_TIMEOUT)
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
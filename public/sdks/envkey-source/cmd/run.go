@@ -1,31 +1,35 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/audit"
+	"github.com/envkey/envkey/public/sdks/envkey-source/bundle"
 	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
 	"github.com/envkey/envkey/public/sdks/envkey-source/env"
 	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
 	"github.com/envkey/envkey/public/sdks/envkey-source/shell"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 	"github.com/envkey/envkey/public/sdks/envkey-source/version"
 	"github.com/spf13/cobra"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var ClientLogEnabled = false
+var logger = logging.New("cmd")
 var execCmdArg = ""
 
 var closed chan os.Signal
 
-func run(cmd *cobra.Command, args []string, firstAttempt bool) {
+func run(cmd *cobra.Command, args []string) {
 	if printVersion {
 		fmt.Println(version.Version)
 		return
@@ -37,7 +41,7 @@ func run(cmd *cobra.Command, args []string, firstAttempt bool) {
 	}
 
 	if daemonMode {
-		daemon.InlineStart(shouldCache, memCache)
+		daemon.InlineStartWithOptions(daemonOptions())
 		return
 	}
 
@@ -52,6 +56,7 @@ func run(cmd *cobra.Command, args []string, firstAttempt bool) {
 	}
 
 	initClientLogging()
+	initClientTracing()
 
 	if len(args) > 0 && strings.TrimSpace(args[0]) != "" {
 		execCmdArg = strings.Join(args, " ")
@@ -59,12 +64,76 @@ func run(cmd *cobra.Command, args []string, firstAttempt bool) {
 
 	if (clientNameArg != "" && clientVersionArg == "") ||
 		(clientVersionArg != "" && clientNameArg == "") {
-		utils.Fatal("if one of --client-name or --client-version is set, the other must also be set", execCmdArg != "")
+		utils.Fatal("if one of --client-name or --client-version is set, the other must also be set", toStderr())
 	}
 
+	if printResolution {
+		res, err := env.ResolveFiles(envkeyProfile(), boundaryFile)
+		utils.CheckError(err, toStderr())
+		fmt.Print(res.String())
+		return
+	}
+
+	if resolveEnvkey {
+		envkey, _, _ := env.GetEnvkeyLayers(getEnvkeyOptions())
+		fmt.Print(envkey)
+		return
+	}
+
+	usingDaemon := memCache || onChangeCmdArg != "" || (execCmdArg != "" && watch) || procfilePath != "" || hooksPath != "" || syncToPath != "" || isSyncingSecretsDir()
+
+	if fromBundlePath != "" && usingDaemon {
+		utils.Fatal("--from-bundle loads an env offline, so it can't be used with -m, -w, -r, --hooks, --procfile, --sync-to, or --secrets-dir", toStderr())
+	}
+
+	if len(webhookUrls) > 0 && !usingDaemon {
+		utils.Fatal("--webhook requires one of -m, -w, -r, --hooks, --procfile, --sync-to, or --secrets-dir", toStderr())
+	}
+
+	envkey, res, clientName, clientVersion := loadEnv(usingDaemon, true)
+
+	closed = make(chan os.Signal)
+	signal.Notify(closed, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-closed
+		// stderrLogger.Println(utils.FormatTerminal(" | received "+sig.String()+" signal--cleaning up and exiting", nil))
+		logger.Info("signal_received", "Received %s signal. Cleaning up and exiting.", sig)
+		if sig == os.Interrupt {
+			killWatchCommandIfRunning(syscall.SIGINT)
+			killProcfileProcessesIfRunning(syscall.SIGINT)
+		} else if sig == syscall.SIGTERM {
+			killWatchCommandIfRunning(syscall.SIGTERM)
+			killProcfileProcessesIfRunning(syscall.SIGTERM)
+		}
+
+		os.Exit(0)
+	}()
+
+	err := writeSecretFiles(res)
+	utils.CheckError(err, toStderr())
+
+	initRedaction(res)
+
+	if procfilePath != "" {
+		execProcfile(envkey, res, clientName, clientVersion)
+		return
+	}
+
+	if syncToPath != "" || isSyncingSecretsDir() {
+		execSync(envkey, res, clientName, clientVersion)
+		return
+	}
+
+	execWithEnv(envkey, res, clientName, clientVersion)
+}
+
+// loadEnv resolves the ENVKEY, fetches its env (through the daemon if
+// usingDaemon is true) and applies overrides from .env files and the shell
+func loadEnv(usingDaemon bool, firstAttempt bool) (string, parser.EnvMap, string, string) {
 	var envkey string
 	var appConfig env.AppConfig
-	var overrides parser.EnvMap
+	var overrideLayers []env.Layer
 	var err error
 	/*
 			* ENVKEY lookup order:
@@ -82,18 +151,13 @@ func run(cmd *cobra.Command, args []string, firstAttempt bool) {
 			*	  4 - .env file at ~/.env
 	*/
 
-	envkey, appConfig, overrides = env.GetEnvkey(verboseOutput, envFileOverride, execCmdArg != "", localDevHost)
-
-	if resolveEnvkey {
-		fmt.Print(envkey)
-		return
-	}
+	envkey, appConfig, overrideLayers = env.GetEnvkeyLayers(getEnvkeyOptions())
 
 	if envkey == "" {
 		if ignoreMissing {
 			os.Exit(0)
 		} else {
-			utils.Fatal("ENVKEY missing\n", execCmdArg != "")
+			utils.Fatal("ENVKEY missing\n", toStderr())
 		}
 	}
 
@@ -114,84 +178,238 @@ func run(cmd *cobra.Command, args []string, firstAttempt bool) {
 
 	var res parser.EnvMap
 
-	fetchOpts := fetch.FetchOptions{shouldCache, cacheDir, clientName, clientVersion, verboseOutput, timeoutSeconds, retries, retryBackoff}
+	fetchOpts := fetch.FetchOptions{
+		ShouldCache:       shouldCache,
+		CacheDir:          cacheDir,
+		ClientName:        clientName,
+		ClientVersion:     clientVersion,
+		VerboseOutput:     verboseOutput,
+		TimeoutSeconds:    timeoutSeconds,
+		HedgeDelaySeconds: hedgeDelaySeconds,
+		RetryPolicy:       retryPolicy(),
+	}
 
-	if memCache || onChangeCmdArg != "" || (execCmdArg != "" && watch) {
-		daemon.LaunchDetachedIfNeeded(daemon.DaemonOptions{
-			verboseOutput,
-			shouldCache,
-			memCache,
-		})
-		res, _, err = daemon.FetchMap(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle)
+	ctx, span := tracing.Start(context.Background(), "envkey-source.load_env", tracing.Bool("envkey-source.using_daemon", usingDaemon))
+
+	if fromBundlePath != "" {
+		res, err = loadBundle(ctx, envkey, clientName, clientVersion)
+	} else if usingDaemon {
+		daemon.LaunchDetachedIfNeeded(daemonOptions())
+		res, _, err = daemon.FetchMapContext(ctx, envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle)
+
+		if err == nil && len(webhookUrls) > 0 {
+			registerWebhooks(envkey)
+		}
 
 		if err != nil {
-			res, err = fetch.FetchMap(envkey, fetchOpts)
+			res, err = fetchDirect(ctx, envkey, fetchOpts)
 		}
 	} else {
-		res, err = fetch.FetchMap(envkey, fetchOpts)
+		res, err = fetchDirect(ctx, envkey, fetchOpts)
 	}
 
-	if err != nil && err.Error() == "ENVKEY invalid" && appConfig.AppId != "" && firstAttempt {
+	span.SetError(err)
+	span.End()
+
+	// profile ENVKEYs are set by hand rather than generated, so they aren't cleared
+	// a bundle can't be refetched with another ENVKEY, so the ENVKEY isn't cleared
+	if err != nil && err.Error() == "ENVKEY invalid" && appConfig.AppId != "" && envkeyProfile() == "" && fromBundlePath == "" && firstAttempt {
 		// clear out incorrect ENVKEY and try again
 		env.ClearAppEnvkey(appConfig.AppId)
-		run(cmd, args, false)
-		return
+		return loadEnv(usingDaemon, false)
 	}
 
-	utils.CheckError(err, execCmdArg != "")
-
-	closed = make(chan os.Signal)
-	signal.Notify(closed, os.Interrupt, syscall.SIGTERM)
+	utils.CheckError(err, toStderr())
 
-	go func() {
-		sig := <-closed
-		// stderrLogger.Println(utils.FormatTerminal(" | received "+sig.String()+" signal--cleaning up and exiting", nil))
-		log.Println("Received " + sig.String() + " signal. Cleaning up and exiting.")
-		if sig == os.Interrupt {
-			killWatchCommandIfRunning(syscall.SIGINT)
-		} else if sig == syscall.SIGTERM {
-			killWatchCommandIfRunning(syscall.SIGTERM)
-		}
+	// see env/layers.go for precedence
+	res, provenance := env.Resolve(env.Layers(res, overrideLayers, force))
 
+	if len(explainVars) > 0 {
+		explain(explainVars, provenance)
 		os.Exit(0)
-	}()
+	}
 
-	if !force {
-		for k, v := range overrides {
-			if k != "ENVKEY" && os.Getenv(k) == "" {
-				res[k] = v
-			}
-		}
+	return envkey, res, clientName, clientVersion
+}
 
-		for k, _ := range res {
-			if os.Getenv(k) != "" {
-				res[k] = os.Getenv(k)
-			}
-		}
+// fetchDirect fetches without the daemon, recording the delivery in the
+// audit log if one is set (the daemon records its own deliveries)
+func fetchDirect(ctx context.Context, envkey string, fetchOpts fetch.FetchOptions) (parser.EnvMap, error) {
+	res, meta, err := fetch.FetchMapContext(ctx, envkey, fetchOpts)
+	if err != nil {
+		return res, err
 	}
 
-	execWithEnv(envkey, res, clientName, clientVersion)
+	err = auditDirect(audit.Record{
+		EnvkeyIdPart:  utils.IdPart(envkey),
+		ClientName:    fetchOpts.ClientName,
+		ClientVersion: fetchOpts.ClientVersion,
+		Keys:          audit.Keys(res),
+		FromCache:     meta.FromCache,
+	})
+
+	return res, err
 }
 
-func initClientLogging() {
-	home, err := os.UserHomeDir()
+// loadBundle loads the env offline from --from-bundle
+func loadBundle(ctx context.Context, envkey, clientName, clientVersion string) (parser.EnvMap, error) {
+	if verboseOutput {
+		fmt.Fprintln(os.Stderr, "loading bundle "+fromBundlePath)
+	}
+
+	b, err := bundle.Read(fromBundlePath)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	logDir := filepath.Join(home, ".envkey", "logs")
-	err = os.MkdirAll(logDir, os.ModePerm)
+	res, err := b.Parse(ctx, envkey, time.Now())
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	log.SetOutput(&lumberjack.Logger{
-		Filename:   filepath.Join(logDir, "envkey-source-client.log"),
-		MaxSize:    25, // megabytes
-		MaxBackups: 3,
-		MaxAge:     30, //days
-		Compress:   false,
+	err = auditDirect(audit.Record{
+		EnvkeyIdPart:  utils.IdPart(envkey),
+		ClientName:    clientName,
+		ClientVersion: clientVersion,
+		Keys:          audit.Keys(res),
+		FromBundle:    true,
 	})
 
+	return res, err
+}
+
+// auditDirect appends a record for this process to the audit log, if one is set
+func auditDirect(rec audit.Record) error {
+	path := auditLogPath()
+	if path == "" {
+		return nil
+	}
+
+	exe, _ := os.Executable()
+	rec.Source = audit.SOURCE_ENVKEY_SOURCE
+	rec.Pid = os.Getpid()
+	rec.Exe = exe
+	rec.PidVerified = true
+
+	return audit.Append(path, rec)
+}
+
+func registerWebhooks(envkey string) {
+	secret := webhookSecret
+	if secret == "" {
+		secret = os.Getenv("ENVKEY_WEBHOOK_SECRET")
+	}
+
+	var webhooks []daemon.Webhook
+	for _, url := range webhookUrls {
+		webhooks = append(webhooks, daemon.Webhook{
+			Url:           strings.TrimSpace(url),
+			Secret:        secret,
+			IncludeValues: webhookIncludeValues,
+		})
+	}
+
+	err := daemon.RegisterWebhooks(envkey, webhooks)
+	utils.CheckError(err, toStderr())
+
+	if verboseOutput {
+		fmt.Fprintln(os.Stderr, "registered webhooks with daemon")
+	}
+}
+
+func daemonOptions() daemon.DaemonOptions {
+	return daemon.DaemonOptions{
+		VerboseOutput:     verboseOutput,
+		ShouldCache:       shouldCache,
+		MemCache:          memCache,
+		LogOptions:        logOptions(),
+		AuditLogPath:      auditLogPath(),
+		TraceOptions:      traceOptions(),
+		HedgeDelaySeconds: hedgeDelaySeconds,
+		RetryPolicy:       retryPolicy(),
+	}
+}
+
+func retryPolicy() *fetch.RetryPolicy {
+	return &fetch.RetryPolicy{
+		Retries:         retries,
+		BackoffSeconds:  retryBackoff,
+		Jitter:          retryJitter,
+		DeadlineSeconds: retryDeadline,
+	}
+}
+
+func getEnvkeyOptions() env.GetEnvkeyOptions {
+	return env.GetEnvkeyOptions{
+		VerboseOutput: verboseOutput,
+		EnvFilePath:   envFileOverride,
+		Profile:       envkeyProfile(),
+		ToStderr:      toStderr(),
+		LocalDevHost:  localDevHost,
+		Monorepo:      monorepo,
+		BoundaryFile:  boundaryFile,
+	}
+}
+
+func auditLogPath() string {
+	if auditLogArg != "" {
+		return auditLogArg
+	}
+	return os.Getenv("ENVKEY_AUDIT_LOG")
+}
+
+func envkeyProfile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv("ENVKEY_PROFILE")
+}
+
+// errors are written to stderr when running commands, and as a failing shell
+// statement on stdout when output is meant to be eval'd
+func toStderr() bool {
+	return execCmdArg != "" || procfilePath != "" || syncToPath != "" || secretsDir != "" || renderingTemplate
+}
+
+// with --secrets-dir and no command to run, keep the directory in sync as a watcher
+func isSyncingSecretsDir() bool {
+	return secretsDir != "" && execCmdArg == "" && procfilePath == ""
+}
+
+func initClientLogging() {
+	opts := logOptions()
+	utils.CheckError(opts.Validate(), toStderr())
+
+	// client logging is best effort
+	err := logging.Init("envkey-source-client.log", opts)
+	if err != nil {
+		return
+	}
+
 	ClientLogEnabled = true
 }
+
+func logOptions() logging.Options {
+	return logging.Options{
+		Format: logFormat,
+		Dir:    logDir,
+		Level:  logLevel,
+	}
+}
+
+func initClientTracing() {
+	err := tracing.Init(traceOptions())
+	utils.CheckError(err, toStderr())
+}
+
+func traceOptions() tracing.Options {
+	endpoint := traceEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+
+	return tracing.Options{
+		File:     traceFile,
+		Endpoint: endpoint,
+	}
+}
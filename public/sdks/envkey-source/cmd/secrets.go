@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/shell"
+	"github.com/envkey/envkey/public/sdks/envkey-source/sink"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	colors "github.com/logrusorgru/aurora/v3"
+)
+
+// envPairs returns the environment for executed commands. with --secrets-dir,
+// vars are passed as paths to files (DB_PASSWORD_FILE=/run/secrets/DB_PASSWORD)
+func envPairs(latestEnv parser.EnvMap, previousEnv parser.EnvMap) []string {
+	return shell.ToPairsWithFiles(latestEnv, previousEnv, true, force, secretsDir)
+}
+
+func writeSecretFiles(env parser.EnvMap) error {
+	if secretsDir == "" {
+		return nil
+	}
+
+	return sink.WriteDir(secretsDir, env)
+}
+
+// withSecretFiles wraps an onChange handler so that --secrets-dir is updated
+// before the handler runs
+func withSecretFiles(handler func(parser.EnvMap, parser.EnvMap)) func(parser.EnvMap, parser.EnvMap) {
+	if secretsDir == "" {
+		return handler
+	}
+
+	return func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		err := writeSecretFiles(updatedEnv)
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't write files to "+secretsDir+": "+err.Error(), colors.Red))
+			return
+		}
+
+		handler(updatedEnv, previousEnv)
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/sink"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	colors "github.com/logrusorgru/aurora/v3"
+)
+
+// keeps --sync-to and/or --secrets-dir up to date as a watcher
+
+func execSync(envkey string, env parser.EnvMap, clientName string, clientVersion string) {
+	if execCmdArg != "" {
+		utils.Fatal("--sync-to can't be combined with a command--use -r to run a command after each write", toStderr())
+	}
+
+	if syncOnInvalid != "remove" && syncOnInvalid != "blank" {
+		utils.Fatal("--sync-on-invalid must be remove or blank", toStderr())
+	}
+
+	err := writeSyncFile(env)
+	utils.CheckError(err, toStderr())
+
+	stderrLogger.Println(utils.FormatTerminal(" | wrote "+syncTargets()+"--waiting for changes...", nil))
+
+	onChange := throttleChanges(withRedaction(func(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) {
+		// files are always kept current--with --only, the vars just decide
+		// whether -r runs
+		err := writeSyncFile(updatedEnv)
+		if err == nil {
+			err = writeSecretFiles(updatedEnv)
+		}
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't write "+syncTargets()+": "+err.Error(), colors.Red))
+			return
+		}
+
+		stderrLogger.Println(utils.FormatTerminal(" | wrote "+syncTargets()+" after update", nil))
+
+		if onChangeCmdArg != "" && watchVarsChanged(watchVars, updatedEnv, previousEnv) {
+			execute(
+				onChangeCmdArg,
+				envPairs(updatedEnv, previousEnv),
+				"copy",
+				false,
+				utils.FormatTerminal(" | on-reload > ", colors.Cyan),
+			).Wait()
+		}
+	}))
+
+	props := daemon.EnvChangeProps(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle, onChange)
+
+	props.OnInvalid = func() {
+		blank := syncOnInvalid == "blank"
+
+		var err error
+		if syncToPath != "" {
+			if blank {
+				err = sink.Blank(syncToPath)
+			} else {
+				err = sink.Remove(syncToPath)
+			}
+		}
+		if err == nil && secretsDir != "" {
+			err = sink.ClearDir(secretsDir, blank)
+		}
+
+		if err != nil {
+			stderrLogger.Println(utils.FormatTerminal(" | couldn't "+syncOnInvalid+" "+syncTargets()+": "+err.Error(), colors.Red))
+		}
+
+		stderrLogger.Println(utils.FormatTerminal(" | ENVKEY invalid–"+syncOnInvalid+" "+syncTargets()+"–watcher will exit", colors.Red))
+		os.Exit(1)
+	}
+
+	daemon.ListenChange(props)
+}
+
+func writeSyncFile(env parser.EnvMap) error {
+	if syncToPath == "" {
+		return nil
+	}
+
+	contents, err := sink.Format(env, syncFormat)
+	if err != nil {
+		return err
+	}
+
+	return sink.WriteFile(syncToPath, contents)
+}
+
+func syncTargets() string {
+	var targets []string
+	if syncToPath != "" {
+		targets = append(targets, syncToPath)
+	}
+	if secretsDir != "" {
+		targets = append(targets, secretsDir)
+	}
+	return strings.Join(targets, " and ")
+}
@@ -37,6 +37,43 @@ es -w --rolling -- ./start-server
 
 By default, this will reload any connected processes in up to four batches, with a 5 second delay between batches. You can use the --rolling-pct flag to change the number of batches, and the --throttle flag to change the delay.
 
+To run different commands depending on which variables changed, list them in a hooks file:
+
+hooks:
+  - keys: ["FEATURE_*"]
+    run: ./refresh-flags
+  - keys: ["DB_*"]
+    restart: true
+
+Each hook command receives JSON describing the matching changes on stdin: {"changes": [{"key": "FEATURE_X", "previous": "off", "current": "on"}]}. With -w, 'restart: true' restarts the watched command, and if any hook uses it, the watched command is restarted only by matching hooks:
+
+es --hooks hooks.yml -w -- ./start-server
+
+To notify other services when the environment changes, add one or more webhook urls. The daemon will POST JSON listing the names of changed variables (add --webhook-values to include values) and retry failed deliveries:
+
+es -m --webhook http://localhost:8080/envkey-updated
+
+If --webhook-secret or ENVKEY_WEBHOOK_SECRET is set, each request includes an X-Envkey-Timestamp header and an X-Envkey-Signature header with the hex HMAC-SHA256 of "{timestamp}.{body}", prefixed with 'sha256='.
+
+Webhooks are registered with the running daemon each time envkey-source loads the environment with --webhook. If the daemon restarts, they aren't delivered until the next load registers them again.
+
+To run several processes with the same ENVKEY, list them in a Procfile:
+
+web: ./start-server
+worker: ./start-worker
+
+Then start them all together. Output is prefixed with each process name, and processes are restarted when the environment changes:
+
+es --procfile Procfile
+
+Use --only to restart all processes only when specific variables change, or prefix a variable with a process name to restart just that process:
+
+es --procfile Procfile --only web:DATABASE_URL,worker:QUEUE_URL
+
+To keep secrets out of logs, use --redact. Command output is scanned as it streams, and any variable value at least --redact-min-length characters long (default 8), or its base64 or url-encoded form, is replaced with ***VAR_NAME***. Output is always piped with --redact, so the command won't be attached to a terminal:
+
+es --redact -w -- ./start-server
+
 Your EnvKey variables are available to use in shell commands. Just be sure to wrap the variables (or the whole command) in **single quotes**, otherwise variables will resolve *before* envkey-source loads your config.
 
 Will work:
@@ -55,6 +92,21 @@ When using the -w or -r flags, you can see the **previous** value of an EnvKey e
 
 es -r 'echo "previous value: $__PREV_SOME_VAR | new value: $SOME_VAR"' -- echo 'initial value: $SOME_VAR'
 
+Values are resolved in layers, with later layers taking precedence: ENVKEY values, ~/.envkey/apps/[appId].env (when using a .envkey file), the nearest .env file, a .env.local file next to it, and finally non-empty variables already set in your shell. With --force, only ENVKEY values are used. To see which layer a variable's value came from:
+
+es --explain DATABASE_URL,PORT
+
+Values are shown as their length and the start of their sha256 hash, so they aren't leaked into terminals or logs. Add --explain-values to print them.
+
+To switch between environments in one checkout, use --profile (or set ENVKEY_PROFILE). With --profile staging, .env.staging and .envkey.staging files are preferred over .env and .envkey, and the ENVKEY for a .envkey app is read from ~/.envkey/apps/[appId].staging.env:
+
+es --profile staging -- ./run-tests
+
+In a monorepo, use --monorepo for explicit resolution: envkey-source walks up from the current directory until it reaches a VCS root (or a directory containing --boundary-file), uses the nearest .envkey file or .env file with an ENVKEY, and only applies a .env file's overrides if it's at or below that level. Add --verbose to see the decision, or do a dry run with --print-resolution:
+
+es --monorepo --print-resolution
+es --monorepo --boundary-file .envkey-root -- ./start-server
+
 You can set your EnvKey environment in the current shell:
 	
 eval "$(es)"
@@ -66,6 +118,21 @@ es --pam > /etc/environment
 es --json > .env.json
 es --yaml > .env.yaml
 
+Or keep a file continuously up to date as a watcher. The file is rewritten atomically with 0600 permissions on each change, and is removed if the ENVKEY becomes invalid (or emptied with --sync-on-invalid blank). Use -r to run a command after each write, and --only to run it only when specific variables change (the file is still written on every change):
+
+es --sync-to config/.env
+es --sync-to config/env.json --format json -r 'kill -HUP $(cat app.pid)'
+
+For docker secrets-style consumers, use --secrets-dir to write each variable to its own file with 0600 permissions. Commands receive a {VAR}_FILE variable with the path to each file instead of the value, files for removed variables are deleted on reload, and without a command the directory is kept in sync as a watcher:
+
+es --secrets-dir /run/secrets -w -- ./start-server    # DB_PASSWORD_FILE=/run/secrets/DB_PASSWORD
+es --secrets-dir /run/secrets
+
+To render config files for tools that can't read environment variables, use the render command with a Go text/template file. Variables are available as {{ .VAR_NAME }}, along with the helpers required, default, env, b64enc, b64dec, json (quotes a value), and fileMode (sets output permissions, default 0600). With -w or -r, the file is re-rendered on each change, and -r only runs when the rendered output actually changes:
+
+es render -t nginx.conf.tmpl -o /etc/nginx/nginx.conf -r 'nginx -s reload'
+es render -t app.yml.tmpl    # prints to stdout
+
 You can automatically set your EnvKey environment whenever you enter an EnvKey-enabled directory. Add the following to your shell config for each shell type.
 
 bash (~/.bashrc or ~/.bash_profile):
@@ -74,11 +141,45 @@ eval "$(es --hook bash)"
 zsh (~/.zshrc):
 eval "$(es --hook zsh)"
 
+Client and daemon logs are written to $HOME/.envkey/logs. Use --log-dir to change the directory, --log-level to set the minimum level (debug, info, warn, or error), and --log-format json to write structured entries with level, component, ENVKEY id, event, and error fields:
+
+es --log-format json --log-level warn -w -- ./start-server
+
+To profile slow fetches, use --trace-file or --trace-endpoint (or $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) to export OTLP/JSON tracing spans for each endpoint attempt, failover, cache read and write, key parsing, trust chain verification, and per-blob verification and decryption. Daemon fetches continue the client's trace:
+
+es --trace-file /tmp/envkey-traces.json -- ./start-server
+es --trace-endpoint http://localhost:4318/v1/traces -w -- ./start-server
+
+Use --audit-log (or $ENVKEY_AUDIT_LOG) to append a record of every env delivered to a local process: the time, ENVKEY id, process id and executable, var names (never values), and whether values came from the offline cache. Each record includes a hash of the record before it, so audit verify catches records edited, deleted, or reordered in the middle of the log (but not records truncated from the end, or a log rewritten with new hashes, so keep it where only trusted users can write). With the daemon, set --audit-log when it's started, and it records the process on the other end of its unix socket where the OS allows:
+
+es --audit-log ~/.envkey/audit.log -- ./start-server
+es audit verify ~/.envkey/audit.log
+
 Use the --cache/-c flag to maintain an encrypted file-system cache for offline work:
 
 es -c -- any-shell-command
 
+For hosts with no route to the EnvKey host, save the encrypted environment to a bundle on a host that can reach it, then load it offline with --from-bundle and the same ENVKEY. Loading a bundle goes through the same key decryption, trust chain verification, and decryption as a fetch. Use --expires to stop a bundle from loading after a duration like 72h or 30d. The expiry is advisory: it's signed with the ENVKEY's own key, so it stops anyone without the ENVKEY from extending it, but not a holder of the ENVKEY, who can re-sign the bundle or roll the clock back:
+
+es export --bundle out.ekb --expires 30d
+es --from-bundle out.ekb -- ./start-server
+
+To test end-to-end without an EnvKey host, run mock-server with plaintext .env files. It generates an ENVKEY for each file, with real keys and signed trust chains, and pushes changes to connected clients when a file is saved. Use --fail and --delay to simulate failover, 404, 426, and 429 responses, or slow endpoints. Clients must trust the certificate written to --cert-out, and the --host hostname (and its failover hostname) must resolve to 127.0.0.1:
+
+es mock-server --env test.env --fail primary=503
+SSL_CERT_FILE=/tmp/envkey-mock-server.pem ENVKEY=... es -w -- ./start-server
+
+In Go tests, the mockserver package does the same in-process, and its Install method points fetches and daemon websockets at the server.
+
 Use the --mem-cache/-m flag to cache the latest values in memory and keep them automatically updated on changes. This avoid the latency of a request to the EnvKey host on each load, but offers less strong consistency guarantees:
 
 es -m -- any-shell-command
+
+By default, failover hosts are only tried after the primary host fails or times out. Use --hedge-delay to start the next failover request whenever that many seconds pass without a response (or as soon as a request fails), using the first successful response and cancelling the rest:
+
+es --hedge-delay 0.5 -- any-shell-command
+
+Failed fetches are retried --retries times (default 3) after network errors, 5xx responses, and rate limiting, waiting --retry-backoff seconds before the first retry and doubling after that, with --retry-jitter randomization. A Retry-After header is honored when it's longer than the backoff. An invalid ENVKEY, a required client upgrade, any other 4xx response, or a decryption failure isn't retried. Use --retry-deadline to cap the total time spent:
+
+es --retries 5 --retry-deadline 30 -- any-shell-command
 `
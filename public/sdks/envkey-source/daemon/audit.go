@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/audit"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+)
+
+// clients that can't be identified by peer credentials report their own
+// pid and executable in these headers
+const CLIENT_PID_HEADER = "X-Envkey-Client-Pid"
+const CLIENT_EXE_HEADER = "X-Envkey-Client-Exe"
+
+type connContextKey struct{}
+
+var auditLogPath string
+
+// fetches are served on a unix socket as well as on tcp so that, where the
+// os supports it, the daemon can see which process it's delivering an env to.
+// the socket is in its own 0700 directory, since it's created with the
+// process umask before it can be chmodded, and ~/.envkey may be readable by
+// other users.
+func SocketPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".envkey", "daemon", "envkey-source-daemon.sock"), nil
+}
+
+func saveConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+func auditDelivery(r *http.Request, envkey, clientName, clientVersion string, keys []string, fromCache bool) {
+	if auditLogPath == "" {
+		return
+	}
+
+	rec := audit.Record{
+		EnvkeyIdPart:  utils.IdPart(envkey),
+		Source:        audit.SOURCE_DAEMON,
+		ClientName:    clientName,
+		ClientVersion: clientVersion,
+		Keys:          keys,
+		FromCache:     fromCache,
+	}
+
+	conn, _ := r.Context().Value(connContextKey{}).(net.Conn)
+	if pid, ok := audit.PeerPid(conn); ok {
+		rec.Pid = pid
+		rec.Exe = audit.PidExe(pid)
+		rec.PidVerified = true
+	} else {
+		rec.Pid, _ = strconv.Atoi(r.Header.Get(CLIENT_PID_HEADER))
+		rec.Exe = r.Header.Get(CLIENT_EXE_HEADER)
+	}
+
+	err := audit.Append(auditLogPath, rec)
+	if err != nil {
+		envkeyLogger(envkey).Error("audit_failed", err, "couldn't write audit log record")
+	}
+}
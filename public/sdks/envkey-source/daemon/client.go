@@ -3,7 +3,9 @@ package daemon
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +15,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +25,7 @@ import (
 
 	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 	"github.com/envkey/envkey/public/sdks/envkey-source/version"
 )
@@ -29,7 +33,27 @@ import (
 // client state (foreground process)
 var stderrLogger = log.New(os.Stderr, "", 0)
 var tcpClientsByEnvkey = map[string]*net.TCPConn{}
-var onChangeChannelsByEnvkey = make(map[string](chan struct{}))
+
+var ErrEnvkeyInvalid = errors.New("ENVKEY invalid")
+
+// fetches go over the daemon's unix socket when it's available, falling
+// back to tcp
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			if runtime.GOOS != "windows" {
+				if path, err := SocketPath(); err == nil {
+					conn, err := dialer.DialContext(ctx, "unix", path)
+					if err == nil {
+						return conn, nil
+					}
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	},
+}
 
 func LaunchDetachedIfNeeded(opts DaemonOptions) error {
 	alive := IsAlive()
@@ -43,7 +67,10 @@ func LaunchDetachedIfNeeded(opts DaemonOptions) error {
 			stderrLogger.Println(utils.FormatTerminal(" | envkey-source daemon not running–starting", nil))
 		}
 
-		name := os.Args[0]
+		name := opts.Executable
+		if name == "" {
+			name = os.Args[0]
+		}
 		cmdArgs := []string{"--daemon"}
 
 		if opts.ShouldCache {
@@ -54,6 +81,40 @@ func LaunchDetachedIfNeeded(opts DaemonOptions) error {
 			cmdArgs = append(cmdArgs, "--mem-cache")
 		}
 
+		if opts.LogOptions.Format != "" {
+			cmdArgs = append(cmdArgs, "--log-format", opts.LogOptions.Format)
+		}
+		if opts.LogOptions.Dir != "" {
+			cmdArgs = append(cmdArgs, "--log-dir", opts.LogOptions.Dir)
+		}
+		if opts.LogOptions.Level != "" {
+			cmdArgs = append(cmdArgs, "--log-level", opts.LogOptions.Level)
+		}
+
+		if opts.RetryPolicy != nil {
+			cmdArgs = append(cmdArgs,
+				"--retries", strconv.Itoa(int(opts.RetryPolicy.Retries)),
+				"--retry-backoff", strconv.FormatFloat(opts.RetryPolicy.BackoffSeconds, 'f', -1, 64),
+				"--retry-jitter", strconv.FormatFloat(opts.RetryPolicy.Jitter, 'f', -1, 64),
+				"--retry-deadline", strconv.FormatFloat(opts.RetryPolicy.DeadlineSeconds, 'f', -1, 64),
+			)
+		}
+
+		if opts.HedgeDelaySeconds > 0 {
+			cmdArgs = append(cmdArgs, "--hedge-delay", strconv.FormatFloat(opts.HedgeDelaySeconds, 'f', -1, 64))
+		}
+
+		if opts.TraceOptions.File != "" {
+			cmdArgs = append(cmdArgs, "--trace-file", opts.TraceOptions.File)
+		}
+		if opts.TraceOptions.Endpoint != "" {
+			cmdArgs = append(cmdArgs, "--trace-endpoint", opts.TraceOptions.Endpoint)
+		}
+
+		if opts.AuditLogPath != "" {
+			cmdArgs = append(cmdArgs, "--audit-log", opts.AuditLogPath)
+		}
+
 		if opts.VerboseOutput {
 			stderrLogger.Println(utils.FormatTerminal(" | executing "+name, nil))
 		}
@@ -116,6 +177,12 @@ func Fetch(envkey, clientNameArg, clientVersionArg string, rollingReload bool, r
 }
 
 func FetchMap(envkey, clientNameArg, clientVersionArg string, rollingReload bool, rollingPct uint8, watchThrottle uint32) (parser.EnvMap, parser.EnvMap, error) {
+	return FetchMapContext(context.Background(), envkey, clientNameArg, clientVersionArg, rollingReload, rollingPct, watchThrottle)
+}
+
+// FetchMapContext is like FetchMap, passing the span in ctx to the daemon so
+// its fetch is traced as part of the same trace
+func FetchMapContext(ctx context.Context, envkey, clientNameArg, clientVersionArg string, rollingReload bool, rollingPct uint8, watchThrottle uint32) (parser.EnvMap, parser.EnvMap, error) {
 
 	clientName := clientNameArg
 	if clientName == "" {
@@ -130,14 +197,27 @@ func FetchMap(envkey, clientNameArg, clientVersionArg string, rollingReload bool
 	fetchUrl := fmt.Sprintf("http://127.0.0.1:19409/fetch/%s/%s/%s/%v/%d/%d", envkey, url.QueryEscape(clientName),
 		url.QueryEscape(clientVersion), rollingReload, rollingPct, watchThrottle)
 
-	resp, err := http.Get(fetchUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", fetchUrl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracing.Inject(ctx, req.Header)
+
+	// for the daemon's audit log when it can't get peer credentials
+	req.Header.Set(CLIENT_PID_HEADER, strconv.Itoa(os.Getpid()))
+	if exe, err := os.Executable(); err == nil {
+		req.Header.Set(CLIENT_EXE_HEADER, exe)
+	}
+
+	resp, err := fetchClient.Do(req)
 
 	if err != nil {
 		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 || resp.StatusCode == 401 {
-		return nil, nil, errors.New("ENVKEY invalid")
+		return nil, nil, ErrEnvkeyInvalid
 	} else if resp.StatusCode != 200 {
 		return nil, nil, errors.New("error loading ENVKEY")
 	}
@@ -160,6 +240,32 @@ func FetchMap(envkey, clientNameArg, clientVersionArg string, rollingReload bool
 	return daemonResp.CurrentEnv, daemonResp.PreviousEnv, nil
 }
 
+// RegisterWebhooks adds webhooks the daemon will notify on updates to an
+// ENVKEY, replacing any registered with the same url. the ENVKEY must
+// already have been fetched through the daemon. registrations are only kept
+// in the daemon's memory, so they're lost if it restarts--register again
+// after loading the ENVKEY through a new daemon.
+func RegisterWebhooks(envkey string, webhooks []Webhook) error {
+	body, err := json.Marshal(webhooks)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post("http://127.0.0.1:19409/webhooks/"+envkey, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return errors.New("ENVKEY not loaded by daemon")
+	} else if resp.StatusCode != 200 {
+		return errors.New("error registering webhooks")
+	}
+
+	return nil
+}
+
 func ListenChange(props ListenChangeProps) {
 	envkey := props.Envkey
 
@@ -177,97 +283,168 @@ func ListenChange(props ListenChangeProps) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:19410")
 	if err != nil {
 		props.OnDaemonConnectFailed(err)
+		return
 	}
 	client, err := net.DialTCP("tcp", nil, tcpAddr)
 	if err != nil {
 		props.OnDaemonConnectFailed(err)
+		return
 	}
 
 	writer := bufio.NewWriter(client)
 	_, err = writer.WriteString(composite + "\n")
 
-	if err != nil {
-		props.OnDaemonConnectFailed(err)
+	if err == nil {
+		err = writer.Flush()
 	}
 
-	err = writer.Flush()
-
 	if err != nil {
+		client.Close()
 		props.OnDaemonConnectFailed(err)
+		return
 	}
 
-	done := make(chan struct{})
-
 	mutex.Lock()
 	tcpClientsByEnvkey[envkey] = client
-	onChangeChannelsByEnvkey[envkey] = done
 	mutex.Unlock()
 
-	go func() {
-		defer close(done)
-		for {
-			reader := bufio.NewReader(client)
-			res, err := reader.ReadString('\n')
+	reader := bufio.NewReader(client)
+	for {
+		res, err := reader.ReadString('\n')
 
-			if err != nil {
-				props.OnLostDaemonConnection(err)
+		if err != nil {
+			mutex.Lock()
+			removed := tcpClientsByEnvkey[envkey] != client
+			if !removed {
+				delete(tcpClientsByEnvkey, envkey)
 			}
-			msg := strings.TrimSpace(res)
-
-			log.Println("Received TCP message:", msg)
-
-			if msg == "envkey_invalid" {
-				props.OnInvalid()
-			} else if msg == "connection_throttled" {
-				props.OnThrottled()
-			} else if msg == "will_reconnect" {
-				props.OnWillReconnect()
-			} else if msg == "reconnected" {
-				props.OnReconnected()
-			} else if msg == "reconnected_no_change" {
-				props.OnReconnectedNoChange()
-			} else if msg == "suspended" {
-				props.OnSuspended()
-			} else if msg == "suspended_no_change" {
-				props.OnSuspendedNoChange()
-			} else if strings.HasPrefix(msg, "start_rolling") {
-				split := strings.Split(msg, "|")
-				batchNumConv, _ := strconv.ParseUint(split[1], 10, 16)
-				totalBatches, _ := strconv.ParseUint(split[2], 10, 16)
-				props.OnStartRolling(uint16(batchNumConv), uint16(totalBatches), props.WatchThrottle)
-			} else if msg == "rolling_complete" {
-				props.OnRollingComplete()
-			} else if msg == "env_update" {
-				props.OnChange()
+			mutex.Unlock()
+
+			client.Close()
+
+			// closed by RemoveListener rather than lost
+			if !removed && props.OnLostDaemonConnection != nil {
+				props.OnLostDaemonConnection(err)
 			}
+			return
+		}
+		handleListenerMessage(props, strings.TrimSpace(res))
+	}
+}
+
+// ListenChangeContext is like ListenChange, but any number of listeners can
+// run for the same ENVKEY, nil handlers are skipped, and it returns when ctx
+// is done (returning ctx.Err()) or the connection to the daemon fails,
+// rather than calling OnDaemonConnectFailed or OnLostDaemonConnection. the
+// ENVKEY must already have been fetched through the daemon. see Subscribe
+// for a listener that reconnects.
+func ListenChangeContext(ctx context.Context, props ListenChangeProps) error {
+	client, err := dialListener(ctx, props.Envkey)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// unblock the read below when ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-stop:
 		}
 	}()
 
+	reader := bufio.NewReader(client)
 	for {
-		select {
-		case <-done:
+		res, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		handleListenerMessage(props, strings.TrimSpace(res))
+	}
+}
+
+// dialListener connects to the daemon's tcp server and registers a listener
+// for envkey
+func dialListener(ctx context.Context, envkey string) (net.Conn, error) {
+	connIdBytes, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:19410")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte(envkey + "|" + connIdBytes.String() + "\n"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func handleListenerMessage(props ListenChangeProps, msg string) {
+	envkeyLogger(props.Envkey).Debug("tcp_message_received", "Received TCP message: %s", msg)
+
+	if msg == "envkey_invalid" && props.OnInvalid != nil {
+		props.OnInvalid()
+	} else if msg == "connection_throttled" && props.OnThrottled != nil {
+		props.OnThrottled()
+	} else if msg == "will_reconnect" && props.OnWillReconnect != nil {
+		props.OnWillReconnect()
+	} else if msg == "reconnected" && props.OnReconnected != nil {
+		props.OnReconnected()
+	} else if msg == "reconnected_no_change" && props.OnReconnectedNoChange != nil {
+		props.OnReconnectedNoChange()
+	} else if msg == "suspended" && props.OnSuspended != nil {
+		props.OnSuspended()
+	} else if msg == "suspended_no_change" && props.OnSuspendedNoChange != nil {
+		props.OnSuspendedNoChange()
+	} else if strings.HasPrefix(msg, "start_rolling") && props.OnStartRolling != nil {
+		split := strings.Split(msg, "|")
+		if len(split) < 3 {
 			return
 		}
+		batchNumConv, _ := strconv.ParseUint(split[1], 10, 16)
+		totalBatches, _ := strconv.ParseUint(split[2], 10, 16)
+		props.OnStartRolling(uint16(batchNumConv), uint16(totalBatches), props.WatchThrottle)
+	} else if msg == "rolling_complete" && props.OnRollingComplete != nil {
+		props.OnRollingComplete()
+	} else if msg == "env_update" && props.OnChange != nil {
+		props.OnChange()
 	}
 }
 
+// RemoveListener stops the ListenChange call for envkey, if any
 func RemoveListener(envkey string) {
 	mutex.Lock()
 	tcpClient := tcpClientsByEnvkey[envkey]
-	onChangeChannel := onChangeChannelsByEnvkey[envkey]
+	delete(tcpClientsByEnvkey, envkey)
 	mutex.Unlock()
 
 	if tcpClient != nil {
 		tcpClient.Close()
 	}
-
-	if onChangeChannel != nil {
-		close(onChangeChannel)
-	}
 }
 
 func ListenChangeWithEnv(envkey, clientName, clientVersion string, rollingReload bool, rollingPct uint8, watchThrottle uint32, onChange func(parser.EnvMap, parser.EnvMap)) {
-	ListenChange(ListenChangeProps{
+	ListenChange(EnvChangeProps(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle, onChange))
+}
+
+// EnvChangeProps returns the ListenChangeProps used by ListenChangeWithEnv, which log
+// each event to stderr and exit on errors, so that callers can override individual handlers
+func EnvChangeProps(envkey, clientName, clientVersion string, rollingReload bool, rollingPct uint8, watchThrottle uint32, onChange func(parser.EnvMap, parser.EnvMap)) ListenChangeProps {
+	return ListenChangeProps{
 		Envkey:        envkey,
 		WatchThrottle: watchThrottle,
 		OnChange: func() {
@@ -317,5 +494,5 @@ func ListenChangeWithEnv(envkey, clientName, clientVersion string, rollingReload
 		OnSuspendedNoChange: func() {
 			// stderrLogger.Println(utils.FormatTerminal(" | nothing changed–waiting for changes...", colors.Green))
 		},
-	})
+	}
 }
@@ -1,44 +1,56 @@
 package daemon
 
 import (
-	"log"
 	"math/rand"
-	"os"
 	"os/signal"
-	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
-	"gopkg.in/natefinch/lumberjack.v2"
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 )
 
 var mutex sync.Mutex
 var shouldCache bool
 var memCache bool
+var hedgeDelaySeconds float64
+var retryPolicy = fetch.DefaultRetryPolicy(3, 1)
 
+var logger = logging.New("daemon")
+
+// InlineStart runs the daemon in the current process with the default
+// options otherwise--see InlineStartWithOptions
 func InlineStart(shouldCacheArg bool, memCacheArg bool) {
-	shouldCache = shouldCacheArg
+	InlineStartWithOptions(DaemonOptions{ShouldCache: shouldCacheArg, MemCache: memCacheArg})
+}
+
+// InlineStartWithOptions runs the daemon in the current process
+func InlineStartWithOptions(opts DaemonOptions) {
+	shouldCache = opts.ShouldCache
+	memCache = opts.MemCache
+	auditLogPath = opts.AuditLogPath
+	hedgeDelaySeconds = opts.HedgeDelaySeconds
+	if opts.RetryPolicy != nil {
+		retryPolicy = *opts.RetryPolicy
+	}
 
-	home, err := os.UserHomeDir()
+	err := logging.Init("envkey-source-daemon.log", opts.LogOptions)
 	if err != nil {
 		panic(err)
 	}
 
-	logDir := filepath.Join(home, ".envkey", "logs")
-	err = os.MkdirAll(logDir, os.ModePerm)
+	traceOpts := opts.TraceOptions
+	if traceOpts.ServiceName == "" {
+		traceOpts.ServiceName = "envkey-source-daemon"
+	}
+	err = tracing.Init(traceOpts)
 	if err != nil {
 		panic(err)
 	}
 
-	log.SetOutput(&lumberjack.Logger{
-		Filename:   filepath.Join(logDir, "envkey-source-daemon.log"),
-		MaxSize:    25, // megabytes
-		MaxBackups: 3,
-		MaxAge:     30, //days
-		Compress:   false,
-	})
-
 	// seed rand for WS backoff and fetch jitter
 	rand.Seed(time.Now().UTC().UnixNano())
 
@@ -53,3 +65,7 @@ func InlineStart(shouldCacheArg bool, memCacheArg bool) {
 
 	select {}
 }
+
+func envkeyLogger(envkey string) logging.Logger {
+	return logger.WithEnvkeyIdPart(utils.IdPart(envkey))
+}
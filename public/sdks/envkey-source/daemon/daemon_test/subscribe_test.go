@@ -0,0 +1,160 @@
+package daemon_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/fakedaemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func startFakeDaemon(t *testing.T, env parser.EnvMap) *fakedaemon.Daemon {
+	if daemon.IsAlive() {
+		t.Skip("the in-process daemon started by TestWebhooks holds the daemon's ports")
+	}
+
+	os.Setenv("HOME", t.TempDir())
+
+	d, err := fakedaemon.New(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Stop)
+
+	return d
+}
+
+func nextEvent(t *testing.T, events <-chan daemon.Event) daemon.Event {
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return daemon.Event{}
+}
+
+func waitRegistered(t *testing.T, d *fakedaemon.Daemon) {
+	select {
+	case <-d.Registered():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for listener")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	d := startFakeDaemon(t, parser.EnvMap{"A": "1", "B": "1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	env, events, err := daemon.SubscribeWithEnv(ctx, "envkey", daemon.SubscribeOptions{ReconnectInterval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1", "B": "1"}, env)
+	waitRegistered(t, d)
+
+	// only changed keys are listed
+	d.SetEnv(parser.EnvMap{"A": "2", "B": "1", "C": "1"})
+	d.Write("env_update")
+	event := nextEvent(t, events)
+	assert.Equal(t, daemon.EVENT_UPDATED, event.Type)
+	assert.Equal(t, []string{"A", "C"}, event.ChangedKeys)
+	assert.Equal(t, parser.EnvMap{"A": "2", "B": "1", "C": "1"}, event.Env)
+
+	// updates that change nothing are skipped
+	d.Write("env_update")
+	d.Write("start_rolling|1|3")
+	event = nextEvent(t, events)
+	assert.Equal(t, daemon.EVENT_ROLLING_STARTED, event.Type)
+	assert.Equal(t, uint16(1), event.BatchNum)
+	assert.Equal(t, uint16(3), event.TotalBatches)
+
+	d.Write("rolling_complete")
+	assert.Equal(t, daemon.EVENT_ROLLING_COMPLETE, nextEvent(t, events).Type)
+	d.Write("will_reconnect")
+	assert.Equal(t, daemon.EVENT_RECONNECTING, nextEvent(t, events).Type)
+	d.Write("reconnected")
+	assert.Equal(t, daemon.EVENT_RECONNECTED, nextEvent(t, events).Type)
+
+	// the subscription reconnects once the daemon is back, sending changes
+	// made while it was gone
+	d.SetDown(true)
+	d.CloseListeners()
+	event = nextEvent(t, events)
+	assert.Equal(t, daemon.EVENT_DISCONNECTED, event.Type)
+	assert.NotNil(t, event.Err)
+
+	d.SetEnv(parser.EnvMap{"A": "2", "B": "2", "C": "1"})
+	d.SetDown(false)
+	waitRegistered(t, d)
+	assert.Equal(t, daemon.EVENT_RECONNECTED, nextEvent(t, events).Type)
+	event = nextEvent(t, events)
+	assert.Equal(t, daemon.EVENT_UPDATED, event.Type)
+	assert.Equal(t, []string{"B"}, event.ChangedKeys)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("events not closed")
+	}
+}
+
+func TestSubscribeInvalid(t *testing.T) {
+	d := startFakeDaemon(t, parser.EnvMap{"A": "1"})
+
+	events, err := daemon.Subscribe(context.Background(), "envkey", daemon.SubscribeOptions{})
+	assert.Nil(t, err)
+	waitRegistered(t, d)
+
+	d.Write("envkey_invalid")
+	assert.Equal(t, daemon.EVENT_INVALID, nextEvent(t, events).Type)
+	_, ok := <-events
+	assert.False(t, ok)
+
+	d.SetInvalid(true)
+	_, err = daemon.Subscribe(context.Background(), "envkey", daemon.SubscribeOptions{})
+	assert.Equal(t, daemon.ErrEnvkeyInvalid, err)
+}
+
+func TestListenChangeContext(t *testing.T) {
+	d := startFakeDaemon(t, parser.EnvMap{"A": "1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		// nil handlers are skipped
+		done <- daemon.ListenChangeContext(ctx, daemon.ListenChangeProps{
+			Envkey:   "envkey",
+			OnChange: func() { changed <- struct{}{} },
+		})
+	}()
+	waitRegistered(t, d)
+
+	d.Write("will_reconnect")
+	d.Write("env_update")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not received")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't stop")
+	}
+}
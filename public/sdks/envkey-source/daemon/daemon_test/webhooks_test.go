@@ -0,0 +1,134 @@
+package daemon_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+type delivery struct {
+	header  http.Header
+	body    []byte
+	payload daemon.WebhookPayload
+}
+
+func startWebhookServer(t *testing.T) (*httptest.Server, chan delivery) {
+	deliveries := make(chan delivery, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		d := delivery{header: r.Header, body: body}
+		json.Unmarshal(body, &d.payload)
+		deliveries <- d
+	}))
+	t.Cleanup(server.Close)
+	return server, deliveries
+}
+
+func nextDelivery(t *testing.T, deliveries chan delivery) delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+	return delivery{}
+}
+
+// runs the daemon in this process until the test binary exits, so it must
+// run after the fake daemon tests, which skip once it's running
+func TestWebhooks(t *testing.T) {
+	home := t.TempDir()
+	os.Setenv("HOME", home)
+
+	// an existing socket directory that other users can read
+	socketDir := filepath.Join(home, ".envkey", "daemon")
+	assert.Nil(t, os.MkdirAll(socketDir, 0755))
+
+	// like the daemon, the server is left running and installed, since the
+	// daemon keeps fetching until the test binary exits
+	server, err := mockserver.New(mockserver.Options{})
+	assert.Nil(t, err)
+	server.Install()
+
+	envkey, err := server.AddEnv(parser.EnvMap{"A": "1", "B": "1"})
+	assert.Nil(t, err)
+
+	go daemon.InlineStart(false, true)
+	for i := 0; !daemon.IsAlive(); i++ {
+		if i == 100 {
+			t.Fatal("daemon didn't start")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// the unix socket is only reachable by this user
+	if runtime.GOOS != "windows" {
+		socketPath, err := daemon.SocketPath()
+		assert.Nil(t, err)
+		assert.Equal(t, socketDir, filepath.Dir(socketPath))
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(socketPath)
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		info, err := os.Stat(socketDir)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	}
+
+	// the ENVKEY must be loaded first
+	assert.NotNil(t, daemon.RegisterWebhooks(envkey, []daemon.Webhook{{Url: "http://localhost"}}))
+
+	_, _, err = daemon.FetchMap(envkey, "", "", false, 0, 0)
+	assert.Nil(t, err)
+
+	signed, signedDeliveries := startWebhookServer(t)
+	unsigned, unsignedDeliveries := startWebhookServer(t)
+
+	// registrations from separate clients for the same ENVKEY are merged
+	assert.Nil(t, daemon.RegisterWebhooks(envkey, []daemon.Webhook{{Url: signed.URL, Secret: "secret"}}))
+	assert.Nil(t, daemon.RegisterWebhooks(envkey, []daemon.Webhook{{Url: unsigned.URL, IncludeValues: true}}))
+
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"A": "2", "B": "1", "C": "1"}))
+
+	d := nextDelivery(t, signedDeliveries)
+	assert.Equal(t, "env_update", d.payload.Event)
+	assert.Equal(t, []string{"A", "C"}, d.payload.ChangedKeys)
+	assert.Nil(t, d.payload.Changes)
+
+	timestamp := d.header.Get("X-Envkey-Timestamp")
+	assert.NotEmpty(t, timestamp)
+	assert.Equal(t, "sha256="+daemon.WebhookSignature("secret", timestamp, d.body), d.header.Get("X-Envkey-Signature"))
+
+	d = nextDelivery(t, unsignedDeliveries)
+	assert.Equal(t, []string{"A", "C"}, d.payload.ChangedKeys)
+	assert.Empty(t, d.header.Get("X-Envkey-Signature"))
+	assert.Len(t, d.payload.Changes, 2)
+	assert.Equal(t, "2", *d.payload.Changes[0].Current)
+	assert.Equal(t, "1", *d.payload.Changes[0].Previous)
+
+	// registering the same url again replaces it rather than adding another
+	assert.Nil(t, daemon.RegisterWebhooks(envkey, []daemon.Webhook{{Url: signed.URL}}))
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"A": "3", "B": "1", "C": "1"}))
+
+	d = nextDelivery(t, signedDeliveries)
+	assert.Equal(t, []string{"A"}, d.payload.ChangedKeys)
+	assert.Empty(t, d.header.Get("X-Envkey-Signature"))
+	nextDelivery(t, unsignedDeliveries)
+
+	select {
+	case <-signedDeliveries:
+		t.Fatal("webhook delivered twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -2,13 +2,17 @@ package daemon
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"math/rand"
 	"reflect"
 	"time"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/audit"
 	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 )
 
 const JITTER = 500 //ms
@@ -17,7 +21,20 @@ var currentEnvsByEnvkey = map[string]parser.EnvMap{}
 var previousEnvsByEnvkey = map[string]parser.EnvMap{}
 var metaByEnvkey = map[string]EnvkeyMeta{}
 
-func fetchAndConnect(envkey, clientName, clientVersion string, rollingReload bool, rollingPct uint8, watchThrottle uint32) (buf bytes.Buffer, err error) {
+// whether the last fetch for an ENVKEY fell back to the on-disk cache
+var fromCacheByEnvkey = map[string]bool{}
+
+// validator of the payload each ENVKEY's current env was loaded from, so
+// fetches after notifications and reconnects skip parsing it if unchanged
+var validatorsByEnvkey = map[string]string{}
+
+// most of a response is unchanged between fetches, and signed trust chains
+// are often shared between ENVKEYs, so one cache is used for all ENVKEYs
+var verifyCache = parser.NewVerifyCache(parser.DEFAULT_VERIFY_CACHE_SIZE)
+
+// fetchAndConnect returns the gob-encoded DaemonResponse, along with the
+// delivered var names and whether they were loaded from the on-disk cache
+func fetchAndConnect(ctx context.Context, envkey, clientName, clientVersion string, rollingReload bool, rollingPct uint8, watchThrottle uint32) (buf bytes.Buffer, keys []string, fromCache bool, err error) {
 
 	defer func() {
 		mutex.Lock()
@@ -35,7 +52,7 @@ func fetchAndConnect(envkey, clientName, clientVersion string, rollingReload boo
 	mutex.Unlock()
 
 	if currentEnv == nil {
-		_, err = fetchCurrent(envkey, clientName, clientVersion)
+		_, err = fetchCurrent(ctx, envkey, clientName, clientVersion)
 
 		if err != nil {
 			return
@@ -44,7 +61,7 @@ func fetchAndConnect(envkey, clientName, clientVersion string, rollingReload boo
 		go connectEnvkeyWebsocket(envkey, clientName, clientVersion, rollingReload, rollingPct, watchThrottle)
 
 	} else if socket == nil || !socket.IsConnected() {
-		_, err = fetchCurrent(envkey, clientName, clientVersion)
+		_, err = fetchCurrent(ctx, envkey, clientName, clientVersion)
 
 		if err != nil {
 			return
@@ -54,8 +71,11 @@ func fetchAndConnect(envkey, clientName, clientVersion string, rollingReload boo
 	mutex.Lock()
 	previousEnv = previousEnvsByEnvkey[envkey]
 	currentEnv = currentEnvsByEnvkey[envkey]
+	fromCache = fromCacheByEnvkey[envkey]
 	mutex.Unlock()
 
+	keys = audit.Keys(currentEnv)
+
 	resp := DaemonResponse{make(parser.EnvMap), make(parser.EnvMap)}
 	if currentEnv != nil {
 		resp.CurrentEnv = currentEnv
@@ -72,9 +92,18 @@ func fetchAndConnect(envkey, clientName, clientVersion string, rollingReload boo
 	return
 }
 
-func fetchCurrent(envkey, clientName, clientVersion string) (changed bool, err error) {
+// fetchCurrent fetches the latest env, updating the daemon's copy if it
+// changed. the fetch is traced as a child of the span in ctx, if any.
+func fetchCurrent(ctx context.Context, envkey, clientName, clientVersion string) (changed bool, err error) {
 	changed = false
 
+	ctx, span := tracing.Start(ctx, "daemon.fetch_current", tracing.String("envkey.id_part", utils.IdPart(envkey)))
+	defer func() {
+		span.SetAttributes(tracing.Bool("daemon.changed", changed))
+		span.SetError(err)
+		span.End()
+	}()
+
 	fetchOptions := fetch.FetchOptions{
 		ShouldCache:    shouldCache,
 		CacheDir:       "",
@@ -82,28 +111,48 @@ func fetchCurrent(envkey, clientName, clientVersion string) (changed bool, err e
 		ClientVersion:  clientVersion,
 		VerboseOutput:  true,
 		TimeoutSeconds: 20,
-		Retries:        3,
-		RetryBackoff:   1,
+
+		HedgeDelaySeconds: hedgeDelaySeconds,
+		RetryPolicy:       &retryPolicy,
+		VerifyCache:       verifyCache,
 	}
 
+	mutex.Lock()
+	if currentEnvsByEnvkey[envkey] != nil {
+		fetchOptions.IfNoneMatch = validatorsByEnvkey[envkey]
+	}
+	mutex.Unlock()
+
 	// a little itty bitty bit o' jitter does a server good
 	// prevents simultaneous slamming by hundreds of ENVKEYs at the
 	// exact same time on a big update
-	time.Sleep(time.Duration(rand.Intn(JITTER)) * time.Millisecond)
+	jitter := rand.Intn(JITTER)
+	span.SetAttributes(tracing.Int("daemon.jitter_ms", jitter))
+	time.Sleep(time.Duration(jitter) * time.Millisecond)
 
-	fetchRes, err := fetch.FetchMap(envkey, fetchOptions)
+	fetchRes, fetchMeta, err := fetch.FetchMapContext(ctx, envkey, fetchOptions)
 
 	if err != nil {
 		return
 	}
+	var previousEnv parser.EnvMap
 	mutex.Lock()
-	if currentEnvsByEnvkey[envkey] == nil || !reflect.DeepEqual(currentEnvsByEnvkey[envkey], fetchRes) {
+	fromCacheByEnvkey[envkey] = fetchMeta.FromCache
+	validatorsByEnvkey[envkey] = fetchMeta.Validator
+	if fetchMeta.NotModified {
+		span.SetAttributes(tracing.Bool("daemon.not_modified", true))
+	} else if currentEnvsByEnvkey[envkey] == nil || !reflect.DeepEqual(currentEnvsByEnvkey[envkey], fetchRes) {
 		changed = true
-		previousEnvsByEnvkey[envkey] = currentEnvsByEnvkey[envkey]
+		previousEnv = currentEnvsByEnvkey[envkey]
+		previousEnvsByEnvkey[envkey] = previousEnv
 		currentEnvsByEnvkey[envkey] = fetchRes
 		metaByEnvkey[envkey] = EnvkeyMeta{clientName, clientVersion}
 	}
 	mutex.Unlock()
 
+	if changed && previousEnv != nil {
+		go notifyWebhooks(envkey, fetchRes, previousEnv)
+	}
+
 	return
 }
@@ -1,12 +1,17 @@
 package daemon
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
 	"github.com/envkey/envkey/public/sdks/envkey-source/version"
 	"github.com/gorilla/mux"
@@ -18,9 +23,58 @@ func startHttpServer() {
 	r.HandleFunc("/alive", aliveHandler).Methods("GET")
 	r.HandleFunc("/stop", stopHandler).Methods("GET")
 	r.HandleFunc("/fetch/{envkey}/{clientName}/{clientVersion}/{rollingReload}/{rollingPct}/{watchThrottle}", fetchHandler).Methods("GET")
+	r.HandleFunc("/webhooks/{envkey}", webhooksHandler).Methods("POST")
 
-	http.Handle("/", r)
-	log.Fatal(http.ListenAndServe(":19409", nil))
+	server := &http.Server{Addr: ":19409", Handler: r, ConnContext: saveConn}
+
+	if runtime.GOOS != "windows" {
+		go serveUnixSocket(server)
+	}
+
+	err := server.ListenAndServe()
+	logger.Error("http_server_failed", err, "http server stopped")
+	os.Exit(1)
+}
+
+// unix socket connections are optional--clients fall back to tcp if the
+// socket can't be served
+func serveUnixSocket(server *http.Server) {
+	path, err := SocketPath()
+	if err != nil {
+		logger.Warn("unix_socket_failed", err, "couldn't serve unix socket")
+		return
+	}
+
+	// other users can't reach the socket through its directory, even in the
+	// moment between Listen and Chmod
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = os.Chmod(dir, 0700)
+	}
+	if err != nil {
+		logger.Warn("unix_socket_failed", err, "couldn't serve unix socket")
+		return
+	}
+
+	// a socket file left by a daemon that didn't shut down cleanly
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		logger.Warn("unix_socket_failed", err, "couldn't serve unix socket")
+		return
+	}
+
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		listener.Close()
+		logger.Warn("unix_socket_failed", err, "couldn't serve unix socket")
+		return
+	}
+
+	err = server.Serve(listener)
+	logger.Warn("unix_socket_failed", err, "unix socket server stopped")
 }
 
 func aliveHandler(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +89,7 @@ func stopHandler(w http.ResponseWriter, r *http.Request) {
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
-	log.Println(msg)
+	logger.Info("daemon_stopped", "%s", msg)
 	os.Exit(0)
 }
 
@@ -43,7 +97,7 @@ func fetchHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	envkey := vars["envkey"]
 
-	log.Printf("fetching env -- %s", utils.IdPart(envkey))
+	envkeyLogger(envkey).Info("fetch", "fetching env -- %s", utils.IdPart(envkey))
 
 	if envkey == "" {
 		w.WriteHeader(http.StatusNotFound)
@@ -62,7 +116,7 @@ func fetchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Println("fetch error:", err)
+		envkeyLogger(envkey).Error("fetch_failed", err, "fetch error")
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, "Fetch error", err)
 		return
@@ -70,16 +124,53 @@ func fetchHandler(w http.ResponseWriter, r *http.Request) {
 
 	rollingPct := uint8(rollingPctConv)
 
-	buf, err := fetchAndConnect(envkey, vars["clientName"], vars["clientVersion"], rollingReload, rollingPct, watchThrottle)
+	// continue the client's trace, if it sent one. not derived from the
+	// request context so a client disconnecting doesn't cancel the fetch.
+	ctx := tracing.Extract(context.Background(), r.Header)
+
+	buf, keys, fromCache, err := fetchAndConnect(ctx, envkey, vars["clientName"], vars["clientVersion"], rollingReload, rollingPct, watchThrottle)
 
 	if err != nil {
-		log.Println("fetch error:", err)
+		envkeyLogger(envkey).Error("fetch_failed", err, "fetch error")
 
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, "Fetch error", err)
 		return
 	}
 
+	auditDelivery(r, envkey, vars["clientName"], vars["clientVersion"], keys, fromCache)
+
 	w.WriteHeader(http.StatusOK)
 	w.Write(buf.Bytes())
 }
+
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	envkey := vars["envkey"]
+
+	var webhooks []Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhooks)
+
+	if err != nil {
+		envkeyLogger(envkey).Error("webhooks_invalid", err, "webhooks error")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "Webhooks error", err)
+		return
+	}
+
+	mutex.Lock()
+	currentEnv := currentEnvsByEnvkey[envkey]
+	mutex.Unlock()
+
+	if currentEnv == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Not found")
+		return
+	}
+
+	envkeyLogger(envkey).Info("webhooks_set", "setting %d webhooks -- %s", len(webhooks), utils.IdPart(envkey))
+
+	setWebhooks(envkey, webhooks)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,7 +1,7 @@
 package daemon
 
 import (
-	"log"
+	"context"
 	"time"
 )
 
@@ -18,7 +18,7 @@ func startSuspendedWatcher() {
 		delta := (now - lastSuspendedCheckAt) - CHECK_SUSPENDED_INTERVAL
 
 		if delta > SUSPENSION_MIN_DELTA {
-			log.Printf("Process was suspended. delta: %d", delta)
+			logger.Info("suspended", "Process was suspended. delta: %d", delta)
 
 			// run through any ENVKEYs we're actively listening to and
 			// check for changes
@@ -38,7 +38,7 @@ func startSuspendedWatcher() {
 
 				if socket.IsConnected() {
 					writeTCP(envkey, []byte("suspended"))
-					changed, err := fetchCurrent(envkey, meta.ClientName, meta.ClientVersion)
+					changed, err := fetchCurrent(context.Background(), envkey, meta.ClientName, meta.ClientVersion)
 
 					if err == nil {
 						if changed {
@@ -47,7 +47,7 @@ func startSuspendedWatcher() {
 							writeTCP(envkey, []byte("suspended_no_change"))
 						}
 					} else {
-						log.Println("awake from suspension: fetchCurrent error")
+						envkeyLogger(envkey).Error("fetch_failed", err, "awake from suspension: fetchCurrent error")
 						socket.CloseAndReconnect()
 					}
 				}
@@ -2,10 +2,10 @@ package daemon
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"os"
@@ -30,13 +30,15 @@ var isRollingByEnvkey = map[string]bool{}
 func startTcpServer() {
 	listener, err := net.Listen("tcp", "127.0.0.1:19410")
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("tcp_server_failed", err, "couldn't start tcp server")
+		os.Exit(1)
 	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Fatal(err)
+			logger.Error("tcp_server_failed", err, "couldn't accept tcp connection")
+			os.Exit(1)
 		}
 		go handleTcpConnection(conn)
 	}
@@ -47,7 +49,7 @@ func handleTcpConnection(serverConn net.Conn) {
 	var connId string
 
 	defer func() {
-		log.Printf("closing Tcp Connection: %s|%s", utils.IdPart(envkey), connId)
+		envkeyLogger(envkey).Info("tcp_connection_closed", "closing Tcp Connection: %s|%s", utils.IdPart(envkey), connId)
 		serverConn.Close()
 		mutex.Lock()
 		delete(tcpServerConnsByEnvkeyByConnId[envkey], connId)
@@ -64,7 +66,7 @@ func handleTcpConnection(serverConn net.Conn) {
 		msg, err := reader.ReadString('\n')
 
 		if err != nil {
-			log.Printf("TCP Connection %s|%s error: %s", utils.IdPart(envkey), connId, err)
+			envkeyLogger(envkey).Error("tcp_connection_failed", err, "TCP Connection %s|%s error", utils.IdPart(envkey), connId)
 			return
 		}
 
@@ -73,7 +75,7 @@ func handleTcpConnection(serverConn net.Conn) {
 		envkey = split[0]
 		connId = split[1]
 
-		log.Printf("TCP Connection established: %s|%s", utils.IdPart(envkey), connId)
+		envkeyLogger(envkey).Info("tcp_connection_established", "TCP Connection established: %s|%s", utils.IdPart(envkey), connId)
 
 		var currentEnv parser.EnvMap
 		mutex.Lock()
@@ -81,7 +83,7 @@ func handleTcpConnection(serverConn net.Conn) {
 		mutex.Unlock()
 
 		if currentEnv == nil {
-			log.Printf("TCP Connection %s|%s: no currentEnv", utils.IdPart(envkey), connId)
+			envkeyLogger(envkey).Warn("tcp_connection_no_env", nil, "TCP Connection %s|%s: no currentEnv", utils.IdPart(envkey), connId)
 			return
 		} else {
 			mutex.Lock()
@@ -101,7 +103,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 	mutex.Unlock()
 
 	if connected {
-		log.Printf("websocket for %s already connected", utils.IdPart(envkey))
+		envkeyLogger(envkey).Debug("websocket_already_connected", "websocket for %s already connected", utils.IdPart(envkey))
 		return nil
 	}
 
@@ -133,7 +135,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 			writeTCP(envkey, []byte("will_reconnect"))
 		},
 		OnReconnect: func() {
-			changed, err := fetchCurrent(envkey, clientName, clientVersion)
+			changed, err := fetchCurrent(context.Background(), envkey, clientName, clientVersion)
 
 			if err == nil {
 				writeTCP(envkey, []byte("reconnected"))
@@ -145,7 +147,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 					writeTCP(envkey, []byte("reconnected_no_change"))
 				}
 			} else {
-				log.Println("fetchCurrent error:", err.Error())
+				envkeyLogger(envkey).Error("fetch_failed", err, "fetchCurrent error")
 			}
 		},
 		OnInvalid: func() {
@@ -156,7 +158,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 		},
 	}
 	socket.Dial(endpoint, http.Header{"authorization": {string(authorizationJsonBytes)}})
-	log.Printf("connected to %s", endpoint)
+	envkeyLogger(envkey).Info("websocket_connected", "connected to %s", endpoint)
 
 	mutex.Lock()
 	websocketsByEnvkey[envkey] = socket
@@ -194,21 +196,21 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 			if msgBytes != nil {
 				msg := string(msgBytes)
 
-				log.Printf("%s websocket received message: %s", utils.IdPart(envkey), msg)
+				envkeyLogger(envkey).Info("websocket_message_received", "%s websocket received message: %s", utils.IdPart(envkey), msg)
 
-				changed, err := fetchCurrent(envkey, clientName, clientVersion)
+				changed, err := fetchCurrent(context.Background(), envkey, clientName, clientVersion)
 				if err != nil {
-					log.Printf("socket read loop: fetchCurrent error: %s", err)
+					envkeyLogger(envkey).Error("fetch_failed", err, "socket read loop: fetchCurrent error")
 					break
 				}
-				log.Printf("%s fetched latest env. changed: %v", utils.IdPart(envkey), changed)
+				envkeyLogger(envkey).Info("fetched", "%s fetched latest env. changed: %v", utils.IdPart(envkey), changed)
 
 				if changed {
 					if rollingReload {
 						batchNum, totalBatches, err := rolling.BatchInfo(msg, rollingPct)
 
 						if err != nil {
-							log.Printf("parse rolling reload batch info error: %s", err)
+							envkeyLogger(envkey).Error("rolling_reload_failed", err, "parse rolling reload batch info error")
 							break
 						}
 
@@ -216,7 +218,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 							err = writeTCP(envkey, []byte(fmt.Sprintf("start_rolling|%d|%d", batchNum, totalBatches)))
 
 							if err != nil {
-								log.Printf("writeTCP error: %s", err)
+								envkeyLogger(envkey).Error("tcp_write_failed", err, "writeTCP error")
 								break
 							}
 
@@ -242,7 +244,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 
 								err = writeTCP(envkey, []byte("env_update"))
 								if err != nil {
-									log.Printf("writeTCP error: %s", err)
+									envkeyLogger(envkey).Error("tcp_write_failed", err, "writeTCP error")
 									return
 								}
 
@@ -256,7 +258,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 
 								err = writeTCP(envkey, []byte("rolling_complete"))
 								if err != nil {
-									log.Printf("writeTCP error: %s", err)
+									envkeyLogger(envkey).Error("tcp_write_failed", err, "writeTCP error")
 									return
 								}
 							}()
@@ -269,7 +271,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 				}
 
 				if err != nil {
-					log.Printf("writeTCP error: %s", err)
+					envkeyLogger(envkey).Error("tcp_write_failed", err, "writeTCP error")
 					break
 				}
 			}
@@ -293,7 +295,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 			}
 		}
 
-		log.Println("Read websocket message loop stopped")
+		envkeyLogger(envkey).Debug("websocket_read_loop_stopped", "Read websocket message loop stopped")
 	}()
 
 	go func() {
@@ -308,7 +310,7 @@ func connectEnvkeyWebsocket(envkey, clientName, clientVersion string, rollingRel
 
 			time.Sleep(WS_PING_INTERVAL)
 		}
-		log.Println("Websocket ping loop stopped")
+		envkeyLogger(envkey).Debug("websocket_ping_loop_stopped", "Websocket ping loop stopped")
 	}()
 
 	for {
@@ -343,7 +345,7 @@ func writeTCP(envkey string, message []byte) error {
 			return errors.New("no TCP connections")
 		}
 	} else {
-		log.Printf("Sending message %s to %d TCP connections for %s", message, len(tcpServerConns), utils.IdPart(envkey))
+		envkeyLogger(envkey).Debug("tcp_message_sent", "Sending message %s to %d TCP connections for %s", message, len(tcpServerConns), utils.IdPart(envkey))
 
 		for _, connId := range connIds {
 			mutex.Lock()
@@ -378,19 +380,22 @@ func closeWebsocket(envkey string) {
 		return
 	}
 
-	log.Printf("%s websocket closing", utils.IdPart(envkey))
+	envkeyLogger(envkey).Info("websocket_closed", "%s websocket closing", utils.IdPart(envkey))
 
 	mutex.Lock()
 	socket := websocketsByEnvkey[envkey]
 	delete(websocketsByEnvkey, envkey)
 	delete(currentEnvsByEnvkey, envkey)
 	delete(previousEnvsByEnvkey, envkey)
+	delete(fromCacheByEnvkey, envkey)
+	delete(validatorsByEnvkey, envkey)
+	delete(webhooksByEnvkey, envkey)
 	tcpServerConns := tcpServerConnsByEnvkeyByConnId[envkey]
 	delete(tcpServerConnsByEnvkeyByConnId, envkey)
 	mutex.Unlock()
 
 	if len(tcpServerConns) > 0 {
-		log.Printf("Closing %d tcp connections", len(tcpServerConns))
+		envkeyLogger(envkey).Info("tcp_connections_closed", "Closing %d tcp connections", len(tcpServerConns))
 	}
 
 	for _, conn := range tcpServerConns {
@@ -404,7 +409,7 @@ func closeWebsocket(envkey string) {
 	mutex.Unlock()
 
 	if socketsRemaining == 0 {
-		log.Printf("No socket connections remaining. Stopping daemon.")
+		logger.Info("daemon_stopped", "No socket connections remaining. Stopping daemon.")
 		os.Exit(0)
 	}
 }
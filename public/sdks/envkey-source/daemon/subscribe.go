@@ -0,0 +1,287 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/hooks"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+const DEFAULT_RECONNECT_INTERVAL = time.Duration(1) * time.Second
+
+type EventType int
+
+const (
+	// the env changed--Env and ChangedKeys are set
+	EVENT_UPDATED EventType = iota
+
+	// a rolling reload started--BatchNum and TotalBatches are set, and
+	// EVENT_UPDATED follows when it's this process's turn to reload
+	EVENT_ROLLING_STARTED
+	EVENT_ROLLING_COMPLETE
+
+	// the daemon lost its connection to the EnvKey host and is reconnecting
+	EVENT_RECONNECTING
+
+	// the daemon reconnected to the EnvKey host, or the subscription
+	// reconnected to the daemon after EVENT_DISCONNECTED. EVENT_UPDATED
+	// follows if the env changed in the meantime.
+	EVENT_RECONNECTED
+
+	// the ENVKEY was revoked or the connection limit was reached--no more
+	// events are sent
+	EVENT_INVALID
+	EVENT_THROTTLED
+
+	// the connection to the daemon was lost--Err is set. the subscription
+	// keeps trying to reconnect until it's restarted.
+	EVENT_DISCONNECTED
+)
+
+type Event struct {
+	Type EventType
+
+	// EVENT_UPDATED: the current env, and the keys added, updated, or
+	// removed since the last event, sorted
+	Env         parser.EnvMap
+	ChangedKeys []string
+
+	// EVENT_ROLLING_STARTED
+	BatchNum     uint16
+	TotalBatches uint16
+
+	// EVENT_DISCONNECTED
+	Err error
+}
+
+type SubscribeOptions struct {
+	ClientName    string
+	ClientVersion string
+
+	RollingReload bool
+	RollingPct    uint8
+	WatchThrottle uint32
+
+	// default is DEFAULT_RECONNECT_INTERVAL
+	ReconnectInterval time.Duration
+}
+
+type subscription struct {
+	ctx    context.Context
+	envkey string
+	opts   SubscribeOptions
+	events chan Event
+	env    parser.EnvMap
+}
+
+// Subscribe loads the ENVKEY through the daemon, then sends an event on the
+// returned channel for each change pushed by the daemon. the daemon must be
+// running. the channel is closed when ctx is done, or after EVENT_INVALID or
+// EVENT_THROTTLED.
+func Subscribe(ctx context.Context, envkey string, opts SubscribeOptions) (<-chan Event, error) {
+	_, events, err := SubscribeWithEnv(ctx, envkey, opts)
+	return events, err
+}
+
+// SubscribeWithEnv is Subscribe, also returning the env it loaded. the first
+// EVENT_UPDATED is for a change since then.
+func SubscribeWithEnv(ctx context.Context, envkey string, opts SubscribeOptions) (parser.EnvMap, <-chan Event, error) {
+	if opts.ReconnectInterval == 0 {
+		opts.ReconnectInterval = DEFAULT_RECONNECT_INTERVAL
+	}
+
+	s := &subscription{
+		ctx:    ctx,
+		envkey: envkey,
+		opts:   opts,
+		events: make(chan Event),
+	}
+
+	var err error
+	s.env, err = s.fetch()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := dialListener(ctx, envkey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := s.env
+	go s.run(conn)
+
+	return env, s.events, nil
+}
+
+func (s *subscription) run(conn net.Conn) {
+	defer close(s.events)
+
+	// catch a change between the first fetch and connecting
+	if !s.update() {
+		conn.Close()
+		return
+	}
+
+	for {
+		stop, err := s.listen(conn)
+		if stop || !s.send(Event{Type: EVENT_DISCONNECTED, Err: err}) {
+			return
+		}
+
+		conn = s.reconnect()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// listen sends events for messages from the daemon until the connection
+// fails, returning the error, or until the subscription should stop
+func (s *subscription) listen(conn net.Conn) (stop bool, err error) {
+	defer conn.Close()
+
+	// unblock the read below when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		res, err := reader.ReadString('\n')
+		if err != nil {
+			return s.ctx.Err() != nil, err
+		}
+
+		msg := strings.TrimSpace(res)
+		envkeyLogger(s.envkey).Debug("tcp_message_received", "Received TCP message: %s", msg)
+
+		if !s.handle(msg) {
+			return true, nil
+		}
+	}
+}
+
+// handle returns false if the subscription should stop
+func (s *subscription) handle(msg string) bool {
+	switch {
+	case msg == "env_update":
+		return s.update()
+
+	case strings.HasPrefix(msg, "start_rolling"):
+		split := strings.Split(msg, "|")
+		if len(split) < 3 {
+			return true
+		}
+		batchNum, _ := strconv.ParseUint(split[1], 10, 16)
+		totalBatches, _ := strconv.ParseUint(split[2], 10, 16)
+		return s.send(Event{Type: EVENT_ROLLING_STARTED, BatchNum: uint16(batchNum), TotalBatches: uint16(totalBatches)})
+
+	case msg == "rolling_complete":
+		return s.send(Event{Type: EVENT_ROLLING_COMPLETE})
+
+	case msg == "will_reconnect":
+		return s.send(Event{Type: EVENT_RECONNECTING})
+
+	case msg == "reconnected":
+		return s.send(Event{Type: EVENT_RECONNECTED})
+
+	case msg == "envkey_invalid":
+		s.send(Event{Type: EVENT_INVALID})
+		return false
+
+	case msg == "connection_throttled":
+		s.send(Event{Type: EVENT_THROTTLED})
+		return false
+	}
+
+	// reconnected_no_change, suspended, and suspended_no_change need no
+	// event--env_update follows if anything changed
+	return true
+}
+
+// update fetches the env from the daemon, sending EVENT_UPDATED if it
+// changed. a failed fetch is left for the connection to fail, since the
+// daemon is likely gone.
+func (s *subscription) update() bool {
+	env, err := s.fetch()
+	if err == ErrEnvkeyInvalid {
+		s.send(Event{Type: EVENT_INVALID})
+		return false
+	} else if err != nil {
+		envkeyLogger(s.envkey).Error("fetch_failed", err, "subscription fetch error")
+		return true
+	}
+
+	changes := hooks.Changes(env, s.env)
+	if len(changes) == 0 {
+		return true
+	}
+
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Key
+	}
+	s.env = env
+
+	return s.send(Event{Type: EVENT_UPDATED, Env: env, ChangedKeys: keys})
+}
+
+// reconnect retries until the daemon is back or ctx is done, returning nil
+// if the subscription should stop
+func (s *subscription) reconnect() net.Conn {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-time.After(s.opts.ReconnectInterval):
+		}
+
+		// a restarted daemon must load the ENVKEY again before it accepts
+		// the connection
+		_, err := s.fetch()
+		if err == ErrEnvkeyInvalid {
+			s.send(Event{Type: EVENT_INVALID})
+			return nil
+		} else if err != nil {
+			continue
+		}
+
+		conn, err := dialListener(s.ctx, s.envkey)
+		if err != nil {
+			continue
+		}
+
+		if !s.send(Event{Type: EVENT_RECONNECTED}) || !s.update() {
+			conn.Close()
+			return nil
+		}
+		return conn
+	}
+}
+
+func (s *subscription) fetch() (parser.EnvMap, error) {
+	env, _, err := FetchMapContext(s.ctx, s.envkey, s.opts.ClientName, s.opts.ClientVersion, s.opts.RollingReload, s.opts.RollingPct, s.opts.WatchThrottle)
+	return env, err
+}
+
+// send returns false if ctx is done first
+func (s *subscription) send(event Event) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
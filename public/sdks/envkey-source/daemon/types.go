@@ -1,7 +1,11 @@
 package daemon
 
 import (
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/hooks"
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 )
 
 type ListenChangeProps struct {
@@ -25,6 +29,18 @@ type DaemonOptions struct {
 	VerboseOutput bool
 	ShouldCache   bool
 	MemCache      bool
+	LogOptions    logging.Options
+	AuditLogPath  string
+	TraceOptions  tracing.Options
+
+	HedgeDelaySeconds float64
+
+	// used for every fetch by the daemon--if nil, 3 retries with a 1 second backoff
+	RetryPolicy *fetch.RetryPolicy
+
+	// envkey-source executable to start the daemon with--default is this
+	// process's own executable
+	Executable string
 }
 
 type SocketAuth struct {
@@ -42,3 +58,18 @@ type EnvkeyMeta struct {
 	ClientName    string
 	ClientVersion string
 }
+
+type Webhook struct {
+	Url           string `json:"url"`
+	Secret        string `json:"secret,omitempty"`
+	IncludeValues bool   `json:"includeValues,omitempty"`
+}
+
+type WebhookPayload struct {
+	Id           string         `json:"id"`
+	Event        string         `json:"event"`
+	EnvkeyIdPart string         `json:"envkeyIdPart"`
+	ChangedKeys  []string       `json:"changedKeys"`
+	Changes      []hooks.Change `json:"changes,omitempty"`
+	Timestamp    int64          `json:"timestamp"`
+}
@@ -0,0 +1,176 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/hooks"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/utils"
+	"github.com/google/uuid"
+	"github.com/jpillora/backoff"
+)
+
+/*
+* webhooks are POSTed to on every env update for an ENVKEY. the body is a
+* json WebhookPayload listing changed var names (values only if IncludeValues
+* is set). if a Secret is set, requests are signed with:
+*
+*		X-Envkey-Timestamp: {unix seconds}
+*		X-Envkey-Signature: sha256={hex hmac-sha256 of "{timestamp}.{body}" keyed by secret}
+ */
+
+const WEBHOOK_MAX_ATTEMPTS = 4
+const WEBHOOK_TIMEOUT = time.Duration(10) * time.Second
+
+var webhooksByEnvkey = map[string][]Webhook{}
+
+var webhookClient = &http.Client{Timeout: WEBHOOK_TIMEOUT}
+
+// setWebhooks adds webhooks for an ENVKEY, replacing any already registered
+// with the same url, so clients sharing an ENVKEY don't replace each other's.
+// they're kept in memory until the ENVKEY's websocket closes.
+func setWebhooks(envkey string, webhooks []Webhook) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// copied, since notifyWebhooks reads the current slice without the lock
+	merged := append([]Webhook{}, webhooksByEnvkey[envkey]...)
+
+	for _, webhook := range webhooks {
+		replaced := false
+		for i := range merged {
+			if merged[i].Url == webhook.Url {
+				merged[i] = webhook
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, webhook)
+		}
+	}
+
+	if len(merged) > 0 {
+		webhooksByEnvkey[envkey] = merged
+	}
+}
+
+func notifyWebhooks(envkey string, currentEnv parser.EnvMap, previousEnv parser.EnvMap) {
+	mutex.Lock()
+	webhooks := webhooksByEnvkey[envkey]
+	mutex.Unlock()
+
+	if len(webhooks) == 0 {
+		return
+	}
+
+	changes := hooks.Changes(currentEnv, previousEnv)
+	if len(changes) == 0 {
+		return
+	}
+
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Key
+	}
+
+	idBytes, err := uuid.NewRandom()
+	if err != nil {
+		envkeyLogger(envkey).Error("webhook_failed", err, "%s webhook id error", utils.IdPart(envkey))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		payload := WebhookPayload{
+			Id:           idBytes.String(),
+			Event:        "env_update",
+			EnvkeyIdPart: utils.IdPart(envkey),
+			ChangedKeys:  keys,
+			Timestamp:    time.Now().UnixMilli(),
+		}
+		if webhook.IncludeValues {
+			payload.Changes = changes
+		}
+
+		go sendWebhook(envkey, webhook, payload)
+	}
+}
+
+func sendWebhook(envkey string, webhook Webhook, payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		envkeyLogger(envkey).Error("webhook_failed", err, "%s webhook encode error", utils.IdPart(envkey))
+		return
+	}
+
+	b := &backoff.Backoff{
+		Min:    time.Duration(1) * time.Second,
+		Max:    time.Duration(30) * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 1; attempt <= WEBHOOK_MAX_ATTEMPTS; attempt++ {
+		retryable, err := postWebhook(webhook, body)
+
+		if err == nil {
+			envkeyLogger(envkey).Info("webhook_delivered", "%s webhook %s delivered", utils.IdPart(envkey), webhook.Url)
+			return
+		}
+
+		envkeyLogger(envkey).Warn("webhook_attempt_failed", err, "%s webhook %s attempt %d failed", utils.IdPart(envkey), webhook.Url, attempt)
+
+		if !retryable {
+			return
+		}
+
+		if attempt < WEBHOOK_MAX_ATTEMPTS {
+			time.Sleep(b.Duration())
+		}
+	}
+}
+
+func postWebhook(webhook Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", webhook.Url, bytes.NewBuffer(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if webhook.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Envkey-Timestamp", timestamp)
+		req.Header.Set("X-Envkey-Signature", "sha256="+WebhookSignature(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = errors.New("response status: " + strconv.Itoa(resp.StatusCode))
+
+	// retry server errors and rate limiting, but not other client errors
+	return resp.StatusCode >= 500 || resp.StatusCode == 429, err
+}
+
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
@@ -29,7 +30,50 @@ type LocalKeyRes struct {
 	LocalKey string `json:"localKey"`
 }
 
+type GetEnvkeyOptions struct {
+	VerboseOutput bool
+	EnvFilePath   string
+	Profile       string
+	ToStderr      bool
+	LocalDevHost  bool
+
+	// see resolution.go
+	Monorepo     bool
+	BoundaryFile string
+}
+
 func GetEnvkey(verboseOutput bool, envFilePath string, toStderr bool, localDevHost bool) (string, AppConfig, parser.EnvMap) {
+	envkey, appConfig, layers := GetEnvkeyLayers(GetEnvkeyOptions{
+		VerboseOutput: verboseOutput,
+		EnvFilePath:   envFilePath,
+		Profile:       os.Getenv("ENVKEY_PROFILE"),
+		ToStderr:      toStderr,
+		LocalDevHost:  localDevHost,
+	})
+	return envkey, appConfig, flattenLayers(layers)
+}
+
+// GetEnvkeyLayers is like GetEnvkey, but returns override files as separate
+// layers in order of precedence (see layers.go) so the source of each value
+// can be tracked.
+//
+// If profile is set (e.g. "staging"), .env.staging and .envkey.staging files are
+// preferred over .env and .envkey anywhere in the directory tree, and the app
+// env file is ~/.envkey/apps/[appId].staging.env
+func GetEnvkeyLayers(opts GetEnvkeyOptions) (string, AppConfig, []Layer) {
+	envkey, appConfig, layers, err := LookupEnvkeyLayers(opts)
+	utils.CheckError(err, opts.ToStderr)
+	return envkey, appConfig, layers
+}
+
+// LookupEnvkeyLayers is like GetEnvkeyLayers, but returns errors rather than
+// exiting, for use as a library
+func LookupEnvkeyLayers(opts GetEnvkeyOptions) (string, AppConfig, []Layer, error) {
+	verboseOutput := opts.VerboseOutput
+	envFilePath := opts.EnvFilePath
+	profile := opts.Profile
+	localDevHost := opts.LocalDevHost
+
 	/*
 			* ENVKEY lookup order:
 			*		1 - ENVKEY environment variable is set
@@ -54,33 +98,53 @@ func GetEnvkey(verboseOutput bool, envFilePath string, toStderr bool, localDevHo
 	var envkey string
 	var appConfig AppConfig
 	var envFileOverrides parser.EnvMap
+	var envFileOverridesPath string
 	var configDirOverrides parser.EnvMap
-	var envFileDepth uint8
-	var envkeyFileDepth uint8
+	var configDirOverridesPath string
+	var envFileDepth int
+	var envkeyFileDepth int
 	var envkeyFileJsonBytes []byte
 	var err error
 
+	if !ValidProfile(profile) {
+		return "", appConfig, nil, errors.New("invalid profile: " + profile + " (may only contain letters, numbers, - and _)")
+	}
+
+	if opts.Monorepo && envFilePath == "" {
+		return getEnvkeyMonorepo(opts)
+	}
+
 	preloadEnvkey := os.Getenv("ENVKEY")
 
 	if envFilePath == "" {
-		envFileOverrides, envFileDepth, _ = ReadEnvFileFromCwdUpwards(verboseOutput)
+		envFileOverrides, envFileDepth, envFileOverridesPath, _ = findProfileEnvFileFromCwdUpwards(profile, verboseOutput)
 	} else {
 		envFileOverrides, err = godotenv.Read(envFilePath)
 		if err != nil {
-			utils.CheckError(errors.New("--env-file not found"), toStderr)
+			return "", appConfig, nil, errors.New("--env-file not found")
 		}
+		envFileOverridesPath = envFilePath
 
 		if preloadEnvkey != "" {
 			if verboseOutput {
 				fmt.Fprintln(os.Stderr, "using ENVKEY environment var")
 			}
-			return preloadEnvkey, appConfig, envFileOverrides
+			return preloadEnvkey, appConfig, envFileLayers(envFileOverrides, envFileOverridesPath, verboseOutput), nil
 		}
 	}
 
 	overridesEnvkey := envFileOverrides["ENVKEY"]
 
-	envkeyFileJsonBytes, envkeyFileDepth, _ = ReadFileFromCwdUpwards(".envkey", verboseOutput)
+	envkeyFileName := ".envkey"
+	if profile != "" {
+		envkeyFileJsonBytes, envkeyFileDepth, err = ReadFileFromCwdUpwards(ProfileFilename(".envkey", profile), verboseOutput)
+		if err == nil {
+			envkeyFileName = ProfileFilename(".envkey", profile)
+		}
+	}
+	if envkeyFileJsonBytes == nil {
+		envkeyFileJsonBytes, envkeyFileDepth, _ = ReadFileFromCwdUpwards(".envkey", verboseOutput)
+	}
 	json.Unmarshal(envkeyFileJsonBytes, &appConfig)
 
 	useEnvOverridesForENVKEY := false
@@ -99,7 +163,7 @@ func GetEnvkey(verboseOutput bool, envFilePath string, toStderr bool, localDevHo
 
 	if useEnvOverridesForENVKEY {
 		if verboseOutput {
-			fmt.Fprintln(os.Stderr, "using ENVKEY from", strings.Repeat("../", int(envFileDepth))+".env")
+			fmt.Fprintln(os.Stderr, "using ENVKEY from", strings.Repeat("../", envFileDepth)+filepath.Base(envFileOverridesPath))
 		}
 
 		envkey = overridesEnvkey
@@ -110,11 +174,15 @@ func GetEnvkey(verboseOutput bool, envFilePath string, toStderr bool, localDevHo
 		envkey = preloadEnvkey
 	} else if appConfig != (AppConfig{}) {
 		if verboseOutput {
-			fmt.Fprintln(os.Stderr, "using app config file", strings.Repeat("../", int(envkeyFileDepth))+".envkey")
+			fmt.Fprintln(os.Stderr, "using app config file", strings.Repeat("../", envkeyFileDepth)+envkeyFileName)
 		}
 
-		envkey, configDirOverrides, err = EnvkeyFromAppId(appConfig.OrgId, appConfig.AppId, verboseOutput, localDevHost)
-		utils.CheckError(err, toStderr)
+		envkey, configDirOverrides, err = EnvkeyFromAppIdWithProfile(appConfig.OrgId, appConfig.AppId, profile, verboseOutput, localDevHost)
+		if err != nil {
+			return "", appConfig, nil, err
+		}
+
+		_, configDirOverridesPath, _ = appEnvkeyPath(appConfig.AppId, profile)
 	}
 
 	if envkey == "" && envFilePath == "" {
@@ -123,28 +191,55 @@ func GetEnvkey(verboseOutput bool, envFilePath string, toStderr bool, localDevHo
 			if verboseOutput {
 				fmt.Fprintln(os.Stderr, "checking for $HOME/.env")
 			}
-			envFileOverrides, _ = godotenv.Read(filepath.Join(home, ".env"))
+			envFileOverridesPath = filepath.Join(home, ".env")
+			envFileOverrides, _ = godotenv.Read(envFileOverridesPath)
 			envkey = envFileOverrides["ENVKEY"]
 			applyEnvOverrides = true
 		}
 	}
 
-	// merge overrides
-	combinedOverrides := parser.EnvMap{}
-	for k, v := range configDirOverrides {
-		combinedOverrides[k] = v
+	layers := []Layer{}
+	if len(configDirOverrides) > 0 {
+		layers = append(layers, Layer{Name: LAYER_APP_ENV_FILE, Path: configDirOverridesPath, Vars: configDirOverrides})
 	}
 	if applyEnvOverrides {
-		for k, v := range envFileOverrides {
-			combinedOverrides[k] = v
+		layers = append(layers, envFileLayers(envFileOverrides, envFileOverridesPath, verboseOutput)...)
+	}
+
+	return envkey, appConfig, layers, nil
+}
+
+// envFileLayers returns layers for a .env file and a .env.local file
+// alongside it, if one exists
+func envFileLayers(envFileOverrides parser.EnvMap, envFileOverridesPath string, verboseOutput bool) []Layer {
+	var layers []Layer
+
+	if len(envFileOverrides) > 0 {
+		layers = append(layers, Layer{Name: LAYER_ENV_FILE, Path: envFileOverridesPath, Vars: envFileOverrides})
+	}
+
+	if envFileOverridesPath == "" {
+		return layers
+	}
+
+	localPath := filepath.Join(filepath.Dir(envFileOverridesPath), ".env.local")
+	localOverrides, err := godotenv.Read(localPath)
+	if err == nil {
+		if verboseOutput {
+			fmt.Fprintln(os.Stderr, "found .env.local file at "+localPath)
 		}
+		layers = append(layers, Layer{Name: LAYER_ENV_LOCAL_FILE, Path: localPath, Vars: localOverrides})
 	}
 
-	return envkey, appConfig, combinedOverrides
+	return layers
 }
 
 func EnvkeyFromAppId(orgId string, appId string, verboseOutput bool, localDevHost bool) (string, parser.EnvMap, error) {
-	_, path, err := appEnvkeyPath(appId)
+	return EnvkeyFromAppIdWithProfile(orgId, appId, "", verboseOutput, localDevHost)
+}
+
+func EnvkeyFromAppIdWithProfile(orgId string, appId string, profile string, verboseOutput bool, localDevHost bool) (string, parser.EnvMap, error) {
+	_, path, err := appEnvkeyPath(appId, profile)
 	if err != nil {
 		return "", parser.EnvMap{}, err
 	}
@@ -175,13 +270,19 @@ func EnvkeyFromAppId(orgId string, appId string, verboseOutput bool, localDevHos
 		return envkey, overrides, nil
 	}
 
+	// local keys are only generated for the development environment, so a
+	// profile's ENVKEY must be set in its app env file
+	if profile != "" {
+		return "", overrides, errors.New("no ENVKEY set for profile " + profile + "--add ENVKEY=... to " + path)
+	}
+
 	envkey, err = genLocalKey(orgId, appId, verboseOutput, localDevHost, 0)
 
 	return envkey, overrides, err
 }
 
 func ClearAppEnvkey(appId string) error {
-	_, path, err := appEnvkeyPath(appId)
+	_, path, err := appEnvkeyPath(appId, "")
 	if err != nil {
 		return err
 	}
@@ -306,18 +407,23 @@ func appEnvkeyDir() (string, error) {
 	return dir, nil
 }
 
-func appEnvkeyPath(appId string) (string, string, error) {
+func appEnvkeyPath(appId string, profile string) (string, string, error) {
 	dir, err := appEnvkeyDir()
 	if err != nil {
 		return "", "", err
 	}
 
-	path := filepath.Join(dir, appId+".env")
+	filename := appId + ".env"
+	if profile != "" {
+		filename = appId + "." + profile + ".env"
+	}
+
+	path := filepath.Join(dir, filename)
 	return dir, path, nil
 }
 
 func writeLocalKey(appId, envkey string) error {
-	dir, path, err := appEnvkeyPath(appId)
+	dir, path, err := appEnvkeyPath(appId, "")
 
 	if err != nil {
 		return err
@@ -334,14 +440,14 @@ func writeLocalKey(appId, envkey string) error {
 	return ioutil.WriteFile(path, body, 0600)
 }
 
-func ReadFileFromCwdUpwards(filename string, verboseOutput bool) ([]byte, uint8, error) {
+func ReadFileFromCwdUpwards(filename string, verboseOutput bool) ([]byte, int, error) {
 	cwd, err := os.Getwd()
 
 	if err != nil {
 		return nil, 0, err
 	}
 
-	var depth uint8 = 0
+	depth := 0
 	for {
 		path := filepath.Join(cwd, filename)
 		fileInfo, err := os.Stat(path)
@@ -375,32 +481,62 @@ func ReadFileFromCwdUpwards(filename string, verboseOutput bool) ([]byte, uint8,
 	}
 }
 
-func ReadEnvFileFromCwdUpwards(verboseOutput bool) (parser.EnvMap, uint8, error) {
+func ReadEnvFileFromCwdUpwards(verboseOutput bool) (parser.EnvMap, int, error) {
+	envMap, depth, _, err := findEnvFileFromCwdUpwards(".env", verboseOutput)
+	return envMap, depth, err
+}
+
+// prefers .env.[profile] anywhere in the tree, then falls back to .env
+func findProfileEnvFileFromCwdUpwards(profile string, verboseOutput bool) (parser.EnvMap, int, string, error) {
+	if profile != "" {
+		envMap, depth, path, err := findEnvFileFromCwdUpwards(ProfileFilename(".env", profile), verboseOutput)
+		if err == nil {
+			return envMap, depth, path, nil
+		}
+	}
+
+	return findEnvFileFromCwdUpwards(".env", verboseOutput)
+}
+
+func findEnvFileFromCwdUpwards(filename string, verboseOutput bool) (parser.EnvMap, int, string, error) {
 	cwd, err := os.Getwd()
 
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
-	var depth uint8 = 0
+	depth := 0
 	for {
-		path := filepath.Join(cwd, ".env")
+		path := filepath.Join(cwd, filename)
 		envMap, err := godotenv.Read(path)
 
 		if err == nil {
 			if verboseOutput {
-				fmt.Fprintln(os.Stderr, "found .env file at "+path)
+				fmt.Fprintln(os.Stderr, "found "+filename+" file at "+path)
 			}
 
-			return envMap, depth, nil
+			return envMap, depth, path, nil
 		}
 
 		parentDir := filepath.Dir(cwd)
 		if cwd == parentDir {
-			return nil, 0, errors.New("File not found")
+			return nil, 0, "", errors.New("File not found")
 		}
 
 		depth++
 		cwd = parentDir
 	}
 }
+
+func ProfileFilename(filename string, profile string) string {
+	if profile == "" {
+		return filename
+	}
+	return filename + "." + profile
+}
+
+var profileRegex = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+func ValidProfile(profile string) bool {
+	return profileRegex.MatchString(profile)
+}
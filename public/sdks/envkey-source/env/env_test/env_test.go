@@ -0,0 +1,153 @@
+package env_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/env"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	os.Setenv("ENVKEY_TEST_SHELL", "from-shell")
+	defer os.Unsetenv("ENVKEY_TEST_SHELL")
+
+	envkeyVars := parser.EnvMap{
+		"ENVKEY_TEST_SHELL": "from-envkey",
+		"ENVKEY_TEST_FILE":  "from-envkey",
+		"ENVKEY_TEST_ONLY":  "from-envkey",
+	}
+
+	fileLayers := []env.Layer{
+		{Name: env.LAYER_APP_ENV_FILE, Path: "app.env", Vars: parser.EnvMap{"ENVKEY": "local-key", "ENVKEY_TEST_FILE": "from-app"}},
+		{Name: env.LAYER_ENV_FILE, Path: ".env", Vars: parser.EnvMap{"ENVKEY_TEST_FILE": "from-env"}},
+		{Name: env.LAYER_ENV_LOCAL_FILE, Path: ".env.local", Vars: parser.EnvMap{"ENVKEY_TEST_FILE": "from-local", "ENVKEY_TEST_SHELL": "from-local"}},
+	}
+
+	res, provenance := env.Resolve(env.Layers(envkeyVars, fileLayers, false))
+
+	assert.Equal(t, parser.EnvMap{
+		"ENVKEY_TEST_SHELL": "from-shell",
+		"ENVKEY_TEST_FILE":  "from-local",
+		"ENVKEY_TEST_ONLY":  "from-envkey",
+	}, res)
+
+	assert.Equal(t, []env.Source{
+		{Layer: env.LAYER_ENV_LOCAL_FILE, Path: ".env.local", Value: "from-local"},
+		{Layer: env.LAYER_ENV_FILE, Path: ".env", Value: "from-env"},
+		{Layer: env.LAYER_APP_ENV_FILE, Path: "app.env", Value: "from-app"},
+		{Layer: env.LAYER_ENVKEY, Value: "from-envkey"},
+	}, provenance["ENVKEY_TEST_FILE"])
+
+	assert.Equal(t, env.LAYER_SHELL, provenance["ENVKEY_TEST_SHELL"][0].Layer)
+
+	// with force, only ENVKEY values are used
+	res, _ = env.Resolve(env.Layers(envkeyVars, fileLayers, true))
+	assert.Equal(t, envkeyVars, res)
+}
+
+func TestGetEnvkeyLayersProfile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-profile")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("ENVKEY=default-key"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, ".env.staging"), []byte("ENVKEY=staging-key"), 0600)
+
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	preloadEnvkey := os.Getenv("ENVKEY")
+	os.Unsetenv("ENVKEY")
+	defer os.Setenv("ENVKEY", preloadEnvkey)
+
+	envkey, _, _ := env.GetEnvkeyLayers(env.GetEnvkeyOptions{ToStderr: true})
+	assert.Equal(t, "default-key", envkey)
+
+	envkey, _, layers := env.GetEnvkeyLayers(env.GetEnvkeyOptions{Profile: "staging", ToStderr: true})
+	assert.Equal(t, "staging-key", envkey)
+	assert.Equal(t, ".env.staging", filepath.Base(layers[0].Path))
+
+	// falls back to .env when there's no file for the profile
+	envkey, _, _ = env.GetEnvkeyLayers(env.GetEnvkeyOptions{Profile: "test", ToStderr: true})
+	assert.Equal(t, "default-key", envkey)
+
+	assert.False(t, env.ValidProfile("../staging"))
+}
+
+func TestResolveFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-monorepo")
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	service := filepath.Join(dir, "services", "api", "src")
+	os.MkdirAll(service, 0700)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0700)
+
+	// repo-root .env with an ENVKEY, service-level .envkey
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("ENVKEY=root-key\nPORT=3000"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "services", "api", ".envkey"), []byte(`{"appId":"app","orgId":"org"}`), 0600)
+
+	cwd, _ := os.Getwd()
+	os.Chdir(service)
+	defer os.Chdir(cwd)
+
+	res, err := env.ResolveFiles("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, dir, res.Boundary)
+	assert.Equal(t, 2, len(res.Candidates))
+	assert.Equal(t, filepath.Join(dir, "services", "api", ".envkey"), res.EnvkeySource.Path)
+	assert.Equal(t, 1, res.EnvkeySource.Depth)
+
+	// root .env is above the service's .envkey, so its overrides aren't applied
+	assert.Nil(t, res.EnvFile)
+
+	// a boundary file stops the walk before the repo root
+	ioutil.WriteFile(filepath.Join(dir, "services", ".envkey-root"), []byte{}, 0600)
+	res, err = env.ResolveFiles("", ".envkey-root")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "services"), res.Boundary)
+	assert.Equal(t, 1, len(res.Candidates))
+
+	// a .env with an ENVKEY beats a .envkey in the same directory
+	ioutil.WriteFile(filepath.Join(dir, "services", "api", ".env"), []byte("ENVKEY=service-key"), 0600)
+	res, err = env.ResolveFiles("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, env.CANDIDATE_ENV_FILE, res.EnvkeySource.Kind)
+	assert.Equal(t, res.EnvkeySource, res.EnvFile)
+}
+
+func TestExplain(t *testing.T) {
+	provenance := env.Provenance{
+		"SECRET": {
+			{Layer: env.LAYER_ENV_FILE, Path: ".env", Value: "from-env"},
+			{Layer: env.LAYER_ENVKEY, Value: "from-envkey"},
+		},
+	}
+
+	// values are masked by default
+	var out strings.Builder
+	assert.Nil(t, env.Explain(&out, []string{"SECRET", "MISSING"}, provenance, false))
+	assert.NotContains(t, out.String(), "from-env")
+	assert.Contains(t, out.String(), env.MaskValue("from-env"))
+	assert.Contains(t, out.String(), env.MaskValue("from-envkey"))
+	assert.Contains(t, out.String(), "* .env")
+	assert.Contains(t, out.String(), "not set by any layer")
+
+	out.Reset()
+	assert.Nil(t, env.Explain(&out, []string{"SECRET"}, provenance, true))
+	assert.Contains(t, out.String(), "from-env\n")
+	assert.Contains(t, out.String(), "from-envkey")
+}
+
+func TestMaskValue(t *testing.T) {
+	assert.Equal(t, "(empty)", env.MaskValue(""))
+	assert.Equal(t, env.MaskValue("secret"), env.MaskValue("secret"))
+	assert.NotEqual(t, env.MaskValue("secret"), env.MaskValue("secreT"))
+	assert.Contains(t, env.MaskValue("secret"), "6 chars")
+	assert.NotContains(t, env.MaskValue("secret"), "secret")
+}
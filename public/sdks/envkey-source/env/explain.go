@@ -0,0 +1,57 @@
+package env
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Explain writes every layer that set each var, from highest to lowest
+// precedence, with the layer the final value came from marked with *. values
+// are masked unless showValues is set.
+func Explain(out io.Writer, vars []string, provenance Provenance, showValues bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for i, k := range vars {
+		k = strings.TrimSpace(k)
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, k)
+
+		sources := provenance[k]
+		if len(sources) == 0 {
+			fmt.Fprintln(w, "    not set by any layer")
+			continue
+		}
+
+		for j, source := range sources {
+			marker := " "
+			if j == 0 {
+				marker = "*"
+			}
+
+			value := source.Value
+			if !showValues {
+				value = MaskValue(value)
+			}
+			fmt.Fprintf(w, "  %s %s\t%s\t%s\n", marker, source.Layer, source.Path, value)
+		}
+	}
+
+	return w.Flush()
+}
+
+// MaskValue describes a value without printing it--its length and the start
+// of its sha256 hash, enough to tell whether two layers set the same value
+func MaskValue(v string) string {
+	if v == "" {
+		return "(empty)"
+	}
+	sum := sha256.Sum256([]byte(v))
+	return fmt.Sprintf("(%d chars, sha256 %s...)", len(v), hex.EncodeToString(sum[:])[:8])
+}
@@ -0,0 +1,95 @@
+package env
+
+import (
+	"os"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+/*
+* Layers are applied in order, with later layers taking precedence:
+*		1 - ENVKEY: values fetched for the ENVKEY
+*		2 - app env file: ~/.envkey/apps/[appId].env (when using a .envkey config file)
+*		3 - .env: nearest .env file (or --env-file, or $HOME/.env)
+*		4 - .env.local: .env.local file in the same directory as the .env file
+*		5 - shell: non-empty environment variables already set in the shell
+*
+* With --force, only ENVKEY values are used.
+ */
+
+const (
+	LAYER_ENVKEY         = "ENVKEY"
+	LAYER_APP_ENV_FILE   = "app env file"
+	LAYER_ENV_FILE       = ".env"
+	LAYER_ENV_LOCAL_FILE = ".env.local"
+	LAYER_SHELL          = "shell"
+)
+
+type Layer struct {
+	Name string
+	Path string
+	Vars parser.EnvMap
+}
+
+type Source struct {
+	Layer string
+	Path  string
+	Value string
+}
+
+// Provenance maps each var to every layer that set it, from highest to
+// lowest precedence--the first Source is where the final value came from
+type Provenance map[string][]Source
+
+// Layers returns the full list of layers to resolve given the ENVKEY's values
+// and the override file layers returned by GetEnvkeyLayers
+func Layers(envkeyVars parser.EnvMap, fileLayers []Layer, force bool) []Layer {
+	layers := []Layer{{Name: LAYER_ENVKEY, Vars: envkeyVars}}
+
+	if force {
+		return layers
+	}
+
+	layers = append(layers, fileLayers...)
+
+	shellVars := parser.EnvMap{}
+	for _, layer := range layers {
+		for k := range layer.Vars {
+			if v := os.Getenv(k); v != "" {
+				shellVars[k] = v
+			}
+		}
+	}
+
+	return append(layers, Layer{Name: LAYER_SHELL, Vars: shellVars})
+}
+
+// Resolve merges layers in order, with later layers taking precedence. ENVKEY
+// itself is never set from override layers.
+func Resolve(layers []Layer) (parser.EnvMap, Provenance) {
+	res := parser.EnvMap{}
+	provenance := Provenance{}
+
+	for _, layer := range layers {
+		for k, v := range layer.Vars {
+			if k == "ENVKEY" && layer.Name != LAYER_ENVKEY {
+				continue
+			}
+
+			res[k] = v
+			provenance[k] = append([]Source{{Layer: layer.Name, Path: layer.Path, Value: v}}, provenance[k]...)
+		}
+	}
+
+	return res, provenance
+}
+
+func flattenLayers(layers []Layer) parser.EnvMap {
+	res := parser.EnvMap{}
+	for _, layer := range layers {
+		for k, v := range layer.Vars {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,260 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/joho/godotenv"
+)
+
+/*
+* Monorepo resolution (--monorepo) walks up from the current directory
+* collecting every .envkey and .env file until it reaches a VCS root or a
+* directory containing the boundary file, then:
+*		- if the ENVKEY environment variable is set, it's used
+*		- otherwise the nearest .env with an ENVKEY or .envkey file supplies the
+*		  ENVKEY--a .env wins over a .envkey in the same directory
+*		- the nearest .env at or below the ENVKEY's directory is applied as
+*		  overrides, so a repo-root .env never overrides a service's .envkey
+*		- if nothing within the boundary supplies an ENVKEY, falls back to ~/.env
+*
+* With a profile, .env.[profile] and .envkey.[profile] are preferred in each
+* directory.
+ */
+
+const (
+	CANDIDATE_ENV_FILE    = ".env"
+	CANDIDATE_ENVKEY_FILE = ".envkey"
+)
+
+var vcsDirs = []string{".git", ".hg", ".svn"}
+
+type Candidate struct {
+	Kind      string
+	Path      string
+	Depth     int
+	HasEnvkey bool
+}
+
+type Resolution struct {
+	Cwd            string
+	Boundary       string
+	BoundaryReason string
+	Candidates     []Candidate
+
+	EnvkeyVarSet bool
+	EnvkeySource *Candidate
+	EnvFile      *Candidate
+}
+
+func ResolveFiles(profile string, boundaryFile string) (Resolution, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	res := Resolution{Cwd: cwd, EnvkeyVarSet: os.Getenv("ENVKEY") != ""}
+
+	dir := cwd
+	for depth := 0; ; depth++ {
+		envPath := profileCandidatePath(dir, ".env", profile)
+		if envPath != "" {
+			envMap, err := godotenv.Read(envPath)
+			if err == nil {
+				res.Candidates = append(res.Candidates, Candidate{
+					Kind:      CANDIDATE_ENV_FILE,
+					Path:      envPath,
+					Depth:     depth,
+					HasEnvkey: envMap["ENVKEY"] != "",
+				})
+			}
+		}
+
+		envkeyPath := profileCandidatePath(dir, ".envkey", profile)
+		if envkeyPath != "" {
+			res.Candidates = append(res.Candidates, Candidate{
+				Kind:  CANDIDATE_ENVKEY_FILE,
+				Path:  envkeyPath,
+				Depth: depth,
+			})
+		}
+
+		if reason := boundaryReason(dir, boundaryFile); reason != "" {
+			res.Boundary = dir
+			res.BoundaryReason = reason
+			break
+		}
+
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			res.Boundary = dir
+			res.BoundaryReason = "filesystem root"
+			break
+		}
+		dir = parentDir
+	}
+
+	for i := range res.Candidates {
+		c := &res.Candidates[i]
+		if c.Kind == CANDIDATE_ENVKEY_FILE || c.HasEnvkey {
+			res.EnvkeySource = c
+			break
+		}
+	}
+
+	for i := range res.Candidates {
+		c := &res.Candidates[i]
+		if c.Kind != CANDIDATE_ENV_FILE {
+			continue
+		}
+		if res.EnvkeySource != nil && c.Depth > res.EnvkeySource.Depth {
+			break
+		}
+		res.EnvFile = c
+		break
+	}
+
+	return res, nil
+}
+
+func (res Resolution) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "walked up from %s to %s (%s)\n", res.Cwd, res.Boundary, res.BoundaryReason)
+
+	if len(res.Candidates) == 0 {
+		fmt.Fprintln(&b, "no .envkey or .env files found")
+	} else {
+		fmt.Fprintln(&b, "candidates, nearest first:")
+		for _, c := range res.Candidates {
+			note := ""
+			if c.HasEnvkey {
+				note = " (has ENVKEY)"
+			}
+			fmt.Fprintf(&b, "  %s%s\n", c.Path, note)
+		}
+	}
+
+	switch {
+	case res.EnvkeyVarSet:
+		fmt.Fprintln(&b, "ENVKEY: ENVKEY environment variable")
+	case res.EnvkeySource != nil:
+		fmt.Fprintf(&b, "ENVKEY: %s\n", res.EnvkeySource.Path)
+	default:
+		fmt.Fprintln(&b, "ENVKEY: none found--will check $HOME/.env")
+	}
+
+	if res.EnvFile != nil {
+		fmt.Fprintf(&b, "overrides: %s\n", res.EnvFile.Path)
+	} else if res.EnvkeySource != nil || res.EnvkeyVarSet {
+		fmt.Fprintln(&b, "overrides: none")
+	}
+
+	return b.String()
+}
+
+func getEnvkeyMonorepo(opts GetEnvkeyOptions) (string, AppConfig, []Layer, error) {
+	var envkey string
+	var appConfig AppConfig
+	var configDirOverrides parser.EnvMap
+	var configDirOverridesPath string
+	var envFileOverrides parser.EnvMap
+	var envFileOverridesPath string
+
+	res, err := ResolveFiles(opts.Profile, opts.BoundaryFile)
+	if err != nil {
+		return "", appConfig, nil, err
+	}
+
+	if opts.VerboseOutput {
+		fmt.Fprint(os.Stderr, res.String())
+	}
+
+	if res.EnvFile != nil {
+		envFileOverridesPath = res.EnvFile.Path
+		envFileOverrides, _ = godotenv.Read(envFileOverridesPath)
+	}
+
+	if res.EnvkeyVarSet {
+		envkey = os.Getenv("ENVKEY")
+	} else if res.EnvkeySource != nil && res.EnvkeySource.Kind == CANDIDATE_ENV_FILE {
+		envkey = envFileOverrides["ENVKEY"]
+	} else if res.EnvkeySource != nil {
+		jsonBytes, err := ioutil.ReadFile(res.EnvkeySource.Path)
+		if err != nil {
+			return "", appConfig, nil, err
+		}
+		json.Unmarshal(jsonBytes, &appConfig)
+
+		if appConfig != (AppConfig{}) {
+			envkey, configDirOverrides, err = EnvkeyFromAppIdWithProfile(appConfig.OrgId, appConfig.AppId, opts.Profile, opts.VerboseOutput, opts.LocalDevHost)
+			if err != nil {
+				return "", appConfig, nil, err
+			}
+
+			_, configDirOverridesPath, _ = appEnvkeyPath(appConfig.AppId, opts.Profile)
+		}
+	}
+
+	if envkey == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			if opts.VerboseOutput {
+				fmt.Fprintln(os.Stderr, "checking for $HOME/.env")
+			}
+			envFileOverridesPath = filepath.Join(home, ".env")
+			envFileOverrides, _ = godotenv.Read(envFileOverridesPath)
+			envkey = envFileOverrides["ENVKEY"]
+		}
+	}
+
+	layers := []Layer{}
+	if len(configDirOverrides) > 0 {
+		layers = append(layers, Layer{Name: LAYER_APP_ENV_FILE, Path: configDirOverridesPath, Vars: configDirOverrides})
+	}
+	if envFileOverridesPath != "" {
+		layers = append(layers, envFileLayers(envFileOverrides, envFileOverridesPath, opts.VerboseOutput)...)
+	}
+
+	return envkey, appConfig, layers, nil
+}
+
+// profileCandidatePath returns the path to name.[profile] in dir if it
+// exists, falling back to name, or "" if neither exists
+func profileCandidatePath(dir string, name string, profile string) string {
+	names := []string{name}
+	if profile != "" {
+		names = []string{ProfileFilename(name, profile), name}
+	}
+
+	for _, n := range names {
+		path := filepath.Join(dir, n)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+func boundaryReason(dir string, boundaryFile string) string {
+	if boundaryFile != "" {
+		if _, err := os.Stat(filepath.Join(dir, boundaryFile)); err == nil {
+			return "boundary file " + boundaryFile
+		}
+	}
+
+	for _, vcsDir := range vcsDirs {
+		if _, err := os.Stat(filepath.Join(dir, vcsDir)); err == nil {
+			return "VCS root " + vcsDir
+		}
+	}
+
+	return ""
+}
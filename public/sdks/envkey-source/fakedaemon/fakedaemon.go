@@ -0,0 +1,173 @@
+package fakedaemon
+
+import (
+	"bufio"
+	"encoding/gob"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// a stand-in for the envkey-source daemon in tests of daemon clients. it
+// serves fetches and listener connections on the daemon's ports, returning
+// whatever env it's given, and lets tests send listener messages and
+// simulate the daemon failing, exiting, and coming back.
+//
+// fetches only go to the real daemon's unix socket if it exists, so point
+// HOME at an empty directory while it's running.
+
+const HTTP_ADDR = "127.0.0.1:19409"
+const TCP_ADDR = "127.0.0.1:19410"
+
+type Daemon struct {
+	mu       sync.Mutex
+	env      parser.EnvMap
+	down     bool
+	invalid  bool
+	server   *http.Server
+	listener net.Listener
+	conns    []net.Conn
+
+	registered chan string
+}
+
+// New starts serving env on the daemon's ports
+func New(env parser.EnvMap) (*Daemon, error) {
+	d := &Daemon{env: env, registered: make(chan string, 100)}
+
+	err := d.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Start serves on the daemon's ports again after Stop
+func (d *Daemon) Start() error {
+	httpListener, err := net.Listen("tcp", HTTP_ADDR)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", TCP_ADDR)
+	if err != nil {
+		httpListener.Close()
+		return err
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(d.handleFetch)}
+
+	d.mu.Lock()
+	d.server = server
+	d.listener = listener
+	d.mu.Unlock()
+
+	go server.Serve(httpListener)
+	go d.accept(listener)
+
+	return nil
+}
+
+// Stop closes the daemon's ports and every listener connection, like a
+// daemon exiting
+func (d *Daemon) Stop() {
+	d.mu.Lock()
+	server, listener := d.server, d.listener
+	d.server, d.listener = nil, nil
+	d.mu.Unlock()
+
+	if server != nil {
+		server.Close()
+		listener.Close()
+	}
+
+	d.CloseListeners()
+}
+
+func (d *Daemon) SetEnv(env parser.EnvMap) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.env = env
+}
+
+// SetDown makes fetches fail with a 503
+func (d *Daemon) SetDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+// SetInvalid makes fetches fail with a 404, like an invalid ENVKEY
+func (d *Daemon) SetInvalid(invalid bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.invalid = invalid
+}
+
+// Write sends a message to every listener connection
+func (d *Daemon) Write(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Write([]byte(msg + "\n"))
+	}
+}
+
+// CloseListeners closes every listener connection while the ports stay
+// open, like a daemon restarting
+func (d *Daemon) CloseListeners() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+// Registered receives the line each listener sends when it connects
+func (d *Daemon) Registered() <-chan string {
+	return d.registered
+}
+
+func (d *Daemon) handleFetch(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if d.invalid {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	gob.NewEncoder(w).Encode(daemon.DaemonResponse{CurrentEnv: d.env, PreviousEnv: parser.EnvMap{}})
+}
+
+func (d *Daemon) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		d.mu.Lock()
+		d.conns = append(d.conns, conn)
+		d.mu.Unlock()
+
+		// tests that don't wait for registrations don't block the daemon
+		select {
+		case d.registered <- line:
+		default:
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package fetch
 
-// this package is tested from outside via end-to-end typescript tests
+// this package is mostly tested from outside via end-to-end typescript tests
 
 import (
 	"bytes"
@@ -10,7 +10,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -22,9 +21,12 @@ import (
 	"time"
 
 	"github.com/certifi/gocertifi"
+	"github.com/envkey/envkey/public/sdks/envkey-source/bundle"
 	"github.com/envkey/envkey/public/sdks/envkey-source/cache"
 	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/version"
 	multierror "github.com/hashicorp/go-multierror"
 	// "github.com/davecgh/go-spew/spew"
@@ -36,6 +38,8 @@ var FetchServiceVersion = 2
 var NumFailovers = 2
 var DefaultClientName = "fetch"
 
+var logger = logging.New("fetch")
+
 var UpdateTrustedRootActionType = "envkey/api/ENVKEY_FETCH_UPDATE_TRUSTED_ROOT_PUBKEY"
 var UpdateTrustedRootLoggableType = "authAction"
 
@@ -48,8 +52,53 @@ func Fetch(envkey string, options FetchOptions) (string, error) {
 }
 
 func FetchMap(envkey string, options FetchOptions) (parser.EnvMap, error) {
+	res, _, err := FetchMapWithMeta(envkey, options)
+	return res, err
+}
+
+// FetchMapWithMeta is like FetchMap, but also returns details on how the env was loaded
+func FetchMapWithMeta(envkey string, options FetchOptions) (parser.EnvMap, FetchMeta, error) {
+	return FetchMapContext(context.Background(), envkey, options)
+}
+
+// FetchBundle fetches and verifies the env like FetchMapContext, then
+// returns the encrypted response as an offline bundle that expires after
+// expiresIn (0 for no expiry)
+func FetchBundle(ctx context.Context, envkey string, options FetchOptions, expiresIn time.Duration) (*bundle.Bundle, error) {
+	// a bundle needs the full response, even if it hasn't changed
+	options.IfNoneMatch = ""
+	_, _, response, privkey, err := fetchAndParse(ctx, envkey, options)
+	if err != nil {
+		return nil, err
+	}
+
+	envkeyIdPart := strings.Split(envkey, "-")[0]
+	return bundle.New(envkeyIdPart, response, privkey, time.Now(), expiresIn)
+}
+
+// FetchMapContext is like FetchMapWithMeta, with tracing spans for each
+// request, cache access, and parsing step as children of the span in ctx.
+// cancelling ctx cancels in-flight requests.
+func FetchMapContext(ctx context.Context, envkey string, options FetchOptions) (parser.EnvMap, FetchMeta, error) {
+	res, meta, _, _, err := fetchAndParse(ctx, envkey, options)
+	return res, meta, err
+}
+
+// fetchAndParse also returns the encrypted response and the decrypted
+// ENVKEY private key, for exporting bundles
+func fetchAndParse(ctx context.Context, envkey string, options FetchOptions) (res parser.EnvMap, meta FetchMeta, response *parser.FetchResponse, privkey *crypto.Privkey, err error) {
+	ctx, span := tracing.Start(ctx, "fetch")
+	defer func() {
+		span.SetAttributes(
+			tracing.Bool("fetch.from_cache", meta.FromCache),
+			tracing.Bool("fetch.not_modified", meta.NotModified),
+		)
+		span.SetError(err)
+		span.End()
+	}()
+
 	if len(strings.Split(envkey, "-")) < 2 {
-		return nil, errors.New("ENVKEY invalid")
+		return nil, meta, nil, nil, newFetchError(ERROR_INVALID, 0, "ENVKEY invalid")
 	}
 
 	// may be initalized already when mocking for tests
@@ -79,25 +128,32 @@ func FetchMap(envkey string, options FetchOptions) (parser.EnvMap, error) {
 		}
 	}
 
-	response, envkeyIdPart, envkeyHost, pw, err := fetchEnv(envkey, options, fetchCache)
+	response, envkeyIdPart, envkeyHost, pw, meta, err := fetchEnv(ctx, envkey, options, fetchCache)
 	if err != nil {
-		return nil, err
+		return nil, meta, nil, nil, err
 	}
+	span.SetAttributes(tracing.String("envkey.id_part", envkeyIdPart))
 
-	if options.VerboseOutput {
-		fmt.Fprintln(os.Stderr, "Parsing and decrypting response...")
+	if meta.NotModified {
+		if options.VerboseOutput {
+			fmt.Fprintln(os.Stderr, "Not modified since the last fetch.")
+		}
+		return nil, meta, nil, nil, nil
 	}
-	res, privkey, newSignedTrustedRoot, replacementIds, isV1UpgradedEnvkey, err := response.Parse(pw, false)
 
-	if err == nil && isV1UpgradedEnvkey {
-		res, privkey, newSignedTrustedRoot, replacementIds, _, err = response.Parse(res["KEY"], true)
+	if options.VerboseOutput {
+		fmt.Fprintln(os.Stderr, "Parsing and decrypting response...")
 	}
+	var newSignedTrustedRoot *crypto.SignedData
+	var replacementIds []string
+	res, privkey, newSignedTrustedRoot, replacementIds, err = response.ParseWithV1Upgrade(ctx, pw, options.VerifyCache)
 
 	if err != nil {
 		if options.VerboseOutput {
 			fmt.Fprintln(os.Stderr, "Error parsing and decrypting:")
 			fmt.Fprintln(os.Stderr, err)
 		}
+		logger.WithEnvkeyIdPart(envkeyIdPart).Error("parse_failed", err, "error parsing and decrypting")
 
 		if fetchCache != nil {
 			// Wait for cache write to finish, then delete cache due to error, then wait for that to finish before returning error
@@ -106,7 +162,7 @@ func FetchMap(envkey string, options FetchOptions) (parser.EnvMap, error) {
 			<-fetchCache.Done
 		}
 
-		return nil, errors.New("ENVKEY invalid")
+		return nil, meta, nil, nil, newFetchError(ERROR_DECRYPT, 0, "ENVKEY invalid")
 	}
 
 	// If the trusted root pubkey was replaced, send update action back to server, ignoring failure
@@ -144,7 +200,7 @@ func FetchMap(envkey string, options FetchOptions) (parser.EnvMap, error) {
 		}
 	}
 
-	return res, nil
+	return res, meta, response, privkey, nil
 }
 
 func UrlWithLoggingParams(baseUrl string, options FetchOptions) string {
@@ -191,6 +247,18 @@ func InitClient(timeoutSeconds float64) {
 	}
 }
 
+// requestClient returns Client with options.TimeoutSeconds applied. Client is
+// created with the timeout of the first fetch, so it's set per request for
+// callers that pass a different one.
+func requestClient(options FetchOptions) *http.Client {
+	if options.TimeoutSeconds <= 0 {
+		return Client
+	}
+	client := *Client
+	client.Timeout = time.Duration(options.TimeoutSeconds * float64(time.Second))
+	return &client
+}
+
 func replaceCertPool() error {
 	certPool, err := gocertifi.CACerts()
 	if err != nil {
@@ -201,11 +269,12 @@ func replaceCertPool() error {
 }
 
 func httpExecGetRequest(
+	client *http.Client,
 	req *http.Request,
 	respChan chan httpChannelResponse,
 	errChan chan httpChannelErr,
 ) {
-	resp, err := Client.Do(req)
+	resp, err := client.Do(req)
 	if err == nil {
 		respChan <- httpChannelResponse{resp, req.URL.String()}
 	} else {
@@ -216,7 +285,7 @@ func httpExecGetRequest(
 				errChan <- httpChannelErr{multierror.Append(err, certPoolErr), req.URL.String()}
 				return
 			}
-			httpExecGetRequest(req, respChan, errChan)
+			httpExecGetRequest(client, req, respChan, errChan)
 		} else {
 			errChan <- httpChannelErr{err, req.URL.String()}
 		}
@@ -236,11 +305,13 @@ func httpPost(
 }
 
 func httpGetAsync(
+	client *http.Client,
 	url string,
 	ctx context.Context,
 	respChan chan httpChannelResponse,
 	errChan chan httpChannelErr,
 	inRegionFailoverHeader bool,
+	ifNoneMatch string,
 ) {
 	req, err := http.NewRequest("GET", url, nil)
 
@@ -253,15 +324,19 @@ func httpGetAsync(
 		req.Header.Set("Failover", "in-region")
 	}
 
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
 	req = req.WithContext(ctx)
 
-	go httpExecGetRequest(req, respChan, errChan)
+	go httpExecGetRequest(client, req, respChan, errChan)
 }
 
-func httpGet(url string, inRegionFailoverHeader bool) (*http.Response, error) {
+func httpGet(ctx context.Context, client *http.Client, url string, inRegionFailoverHeader bool, ifNoneMatch string) (*http.Response, error) {
 	respChan, errChan := make(chan httpChannelResponse), make(chan httpChannelErr)
 
-	httpGetAsync(url, context.Background(), respChan, errChan, inRegionFailoverHeader)
+	httpGetAsync(client, url, ctx, respChan, errChan, inRegionFailoverHeader, ifNoneMatch)
 
 	for {
 		select {
@@ -341,6 +416,14 @@ func postUpdateRootPubkeyAction(
 }
 
 func logRequestIfVerbose(url string, options FetchOptions, err error, r *http.Response) {
+	if err != nil {
+		logger.Warn("request_failed", err, "loading from %s failed", url)
+	} else if r.StatusCode >= 500 {
+		logger.Warn("request_failed", nil, "loading from %s failed with status %d", url, r.StatusCode)
+	} else {
+		logger.Debug("request_succeeded", "loaded from %s with status %d", url, r.StatusCode)
+	}
+
 	if options.VerboseOutput {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Loading from %s failed.\n", url)
@@ -355,41 +438,63 @@ func logRequestIfVerbose(url string, options FetchOptions, err error, r *http.Re
 	}
 }
 
-func fetchEnv(envkey string, options FetchOptions, fetchCache *cache.Cache) (*parser.FetchResponse, string, string, string, error) {
+func fetchEnv(ctx context.Context, envkey string, options FetchOptions, fetchCache *cache.Cache) (*parser.FetchResponse, string, string, string, FetchMeta, error) {
 	envkeyIdPart, pw, envkeyHost := SplitEnvkey(envkey)
 	response := new(parser.FetchResponse)
-	err := getJson(envkeyHost, envkeyIdPart, options, response, fetchCache)
+	policy := options.retryPolicy()
+
+	start := time.Now()
+	if policy.DeadlineSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.deadline())
+		defer cancel()
+	}
 
-	if err != nil && options.Retries > 0 {
+	cond := conditional{validator: options.IfNoneMatch}
+	if cond.validator == "" && fetchCache != nil {
+		validator, err := fetchCache.ReadValidator(envkeyIdPart)
+		if err == nil && validator != "" {
+			cond = conditional{validator: validator, fromCache: true}
+		}
+	}
 
-		var retry uint8 = 0
-		for retry < options.Retries {
-			if err.Error() == "ENVKEY invalid" {
-				break
-			}
+	get := func(attempt int) (FetchMeta, error) {
+		meta, err := getJson(ctx, envkeyHost, envkeyIdPart, options, cond, response, fetchCache, attempt)
+		if err == errCachedBodyMissing {
+			cond = conditional{}
+			meta, err = getJson(ctx, envkeyHost, envkeyIdPart, options, cond, response, fetchCache, attempt)
+		}
+		return meta, err
+	}
 
-			if options.RetryBackoff > 0 {
-				var backoff float64 = 0
-				backoff = options.RetryBackoff * math.Pow(2, (float64(retry-1)))
-				if backoff > 0 {
-					time.Sleep(time.Duration(backoff) * time.Second)
-				}
-			}
+	meta, err := get(0)
 
-			if options.VerboseOutput {
-				fmt.Fprintf(os.Stderr, "\nRetrying...\n")
-			}
-			err = getJson(envkeyHost, envkeyIdPart, options, response, fetchCache)
-			if err == nil {
-				break
-			}
+	for retry := 0; err != nil && retry < int(policy.Retries); retry++ {
+		if !Retryable(err) || ctx.Err() != nil {
+			break
+		}
+
+		wait := policy.Wait(retry, err)
+
+		if policy.DeadlineSeconds > 0 && time.Since(start)+wait >= policy.deadline() {
+			logger.WithEnvkeyIdPart(envkeyIdPart).Warn("fetch_retry_deadline", err, "not retrying--retry deadline of %vs would be exceeded", policy.DeadlineSeconds)
+			break
+		}
+
+		if options.VerboseOutput {
+			fmt.Fprintf(os.Stderr, "\nRetrying in %s...\n", wait.Round(time.Millisecond))
+		}
+		logger.WithEnvkeyIdPart(envkeyIdPart).Info("fetch_retry", "retrying fetch in %s (retry %d of %d)", wait.Round(time.Millisecond), retry+1, policy.Retries)
 
-			retry++
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
 		}
 
+		meta, err = get(retry + 1)
 	}
 
-	return response, envkeyIdPart, envkeyHost, pw, err
+	return response, envkeyIdPart, envkeyHost, pw, meta, err
 }
 
 func SplitEnvkey(envkey string) (string, string, string) {
@@ -422,7 +527,9 @@ func getActionUrl(envkeyHost string) string {
 	return host + "/action"
 }
 
-func getFetchUrlBase(envkeyHost string, envkeyIdPart string, numEndpoint int) string {
+// getFetchHost returns the scheme and host for the fetch endpoint, with
+// failover endpoints numbered after the first subdomain (api-v2-2.envkey.com)
+func getFetchHost(envkeyHost string, numEndpoint int) string {
 	host := GetHost(envkeyHost)
 
 	if numEndpoint > 1 {
@@ -430,6 +537,12 @@ func getFetchUrlBase(envkeyHost string, envkeyIdPart string, numEndpoint int) st
 		host = re.ReplaceAllString(host, ("$1-" + strconv.Itoa(numEndpoint) + ".$2"))
 	}
 
+	return host
+}
+
+func getFetchUrlBase(envkeyHost string, envkeyIdPart string, numEndpoint int) string {
+	host := getFetchHost(envkeyHost, numEndpoint)
+
 	return host + "/fetch?fetchServiceVersion=" + strconv.Itoa(FetchServiceVersion) + "&envkeyIdPart=" + envkeyIdPart
 }
 
@@ -438,19 +551,32 @@ func getJsonUrl(envkeyHost string, envkeyIdPart string, options FetchOptions, nu
 	return UrlWithLoggingParams(baseUrl, options)
 }
 
-func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, response *parser.FetchResponse, fetchCache *cache.Cache) error {
+// getJson sends cond's validator with each request. if the payload matches
+// a validator from the caller, response is left empty and meta.NotModified
+// is set. if it matches the on-disk cache's, the cached body is used.
+func getJson(ctx context.Context, envkeyHost string, envkeyIdPart string, options FetchOptions, cond conditional, response *parser.FetchResponse, fetchCache *cache.Cache, attempt int) (meta FetchMeta, err error) {
+	ctx, span := tracing.Start(ctx, "fetch.get_json", tracing.Int("fetch.attempt", attempt))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 
 	numEndpoint := 0
 	maxEndpoints := NumFailovers
 
 	var body []byte
-	var err error
 	var r *http.Response
 
 	for numEndpoint <= maxEndpoints {
-		body, r, err = getJsonBody(envkeyHost, envkeyIdPart, options, numEndpoint)
+		if options.HedgeDelaySeconds > 0 {
+			// every endpoint is tried in a single hedged pass, which returns
+			// the last endpoint's number if they all fail
+			body, r, numEndpoint, err = getJsonBodyHedged(ctx, envkeyHost, envkeyIdPart, options, cond.validator)
+		} else {
+			body, r, err = getJsonBody(ctx, envkeyHost, envkeyIdPart, options, cond.validator, numEndpoint)
+		}
 
-		if err == nil && r.StatusCode == 200 {
+		if err == nil && (r.StatusCode == 200 || r.StatusCode == http.StatusNotModified) {
 			break
 		}
 
@@ -460,15 +586,19 @@ func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, respo
 				fmt.Fprintln(os.Stderr, "404 not found")
 			}
 
+			logger.WithEnvkeyIdPart(envkeyIdPart).Warn("envkey_invalid", nil, "fetch error: 404 not found")
+
 			// Since ENVKEY wasn't found and permission may have been removed, clear cache
 			if fetchCache != nil {
 				fetchCache.Delete(envkeyIdPart)
 			}
-			return errors.New("ENVKEY invalid")
+			return meta, newFetchError(ERROR_INVALID, r.StatusCode, "ENVKEY invalid")
 		} else if r != nil && r.StatusCode == 426 {
-			return errors.New("organization requires a newer version of envkey-source client")
+			return meta, newFetchError(ERROR_UPGRADE_REQUIRED, r.StatusCode, "organization requires a newer version of envkey-source client")
 		} else if r != nil && r.StatusCode == 429 {
-			return errors.New("request limit exceeded")
+			rateLimitErr := newFetchError(ERROR_RATE_LIMITED, r.StatusCode, "request limit exceeded")
+			rateLimitErr.RetryAfter = parseRetryAfter(r.Header.Get("Retry-After"))
+			return meta, rateLimitErr
 		}
 
 		numEndpoint = numEndpoint + 1
@@ -476,12 +606,12 @@ func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, respo
 
 	// if we fetched from a failover, that will give us a pre-signed s3 url that we then
 	// need to load the actual payload from before proceeding
-	if err == nil && numEndpoint > 0 {
+	if err == nil && numEndpoint > 0 && r.StatusCode != http.StatusNotModified {
 		failoverResponse := new(FailoverResponse)
 		err = json.Unmarshal(body, &failoverResponse)
 
 		if err == nil {
-			body, r, err = getFailoverJsonBody(failoverResponse.SignedUrl, options)
+			body, r, err = getFailoverJsonBody(ctx, failoverResponse.SignedUrl, options, cond.validator)
 
 			if err != nil || r.StatusCode >= 400 {
 				msg := "Error fetching pre-signed s3 failover url (" + failoverResponse.SignedUrl + "): "
@@ -495,6 +625,7 @@ func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, respo
 					fmt.Fprintln(os.Stderr, msg)
 				}
 				err = errors.New(msg)
+				logger.WithEnvkeyIdPart(envkeyIdPart).Warn("failover_failed", err, "failover fetch failed")
 			}
 		} else {
 			msg := "Error parsing failover response: " + err.Error()
@@ -509,6 +640,16 @@ func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, respo
 	if err != nil || r == nil || r.StatusCode >= 400 {
 		var msg string
 
+		kind := ERROR_NETWORK
+		statusCode := 0
+		if r != nil && r.StatusCode >= 500 {
+			kind = ERROR_SERVER
+			statusCode = r.StatusCode
+		} else if r != nil && r.StatusCode >= 400 {
+			kind = ERROR_CLIENT
+			statusCode = r.StatusCode
+		}
+
 		if err == nil {
 			msg = "could not load from server.\nresponse status: " + strconv.Itoa(r.StatusCode)
 		} else {
@@ -517,44 +658,98 @@ func getJson(envkeyHost string, envkeyIdPart string, options FetchOptions, respo
 
 		// try loading from cache
 		if fetchCache != nil {
+			_, cacheSpan := tracing.Start(ctx, "cache.read")
 			body, err = fetchCache.Read(envkeyIdPart)
+			cacheSpan.SetError(err)
+			cacheSpan.End()
 			if err != nil {
 				if options.VerboseOutput {
 					fmt.Fprintln(os.Stderr, "Cache read error:")
 					fmt.Fprintln(os.Stderr, err)
 				}
 				msg = msg + "\ncache read error: " + err.Error()
+			} else {
+				meta.FromCache = true
+				meta.Validator, _ = fetchCache.ReadValidator(envkeyIdPart)
+				if meta.Validator == "" {
+					meta.Validator = ContentValidator(body)
+				}
+				logger.WithEnvkeyIdPart(envkeyIdPart).Warn("loaded_from_cache", errors.New(msg), "couldn't load from server--loaded from cache")
 			}
 		}
 
 		if err != nil {
-			err = errors.New(msg)
+			err = newFetchError(kind, statusCode, msg)
+			logger.WithEnvkeyIdPart(envkeyIdPart).Error("fetch_failed", err, "fetch failed")
+		}
+	}
+
+	// true if the server confirmed the cached body is current, so it needn't be written again
+	cachedBodyCurrent := false
+
+	if err == nil && !meta.FromCache {
+		notModified := r.StatusCode == http.StatusNotModified
+		if notModified {
+			meta.Validator = cond.validator
+			if etag := r.Header.Get("ETag"); etag != "" {
+				meta.Validator = etag
+			}
+		} else {
+			meta.Validator = responseValidator(r, body)
+			notModified = cond.validator != "" && unchanged(cond.validator, r, body)
+		}
+
+		if notModified {
+			logger.WithEnvkeyIdPart(envkeyIdPart).Debug("not_modified", "payload unchanged since the last fetch")
+
+			if !cond.fromCache {
+				meta.NotModified = true
+				return meta, nil
+			}
+
+			if r.StatusCode == http.StatusNotModified {
+				_, cacheSpan := tracing.Start(ctx, "cache.read")
+				body, err = fetchCache.Read(envkeyIdPart)
+				cacheSpan.SetError(err)
+				cacheSpan.End()
+				if err != nil {
+					return meta, errCachedBodyMissing
+				}
+				cachedBodyCurrent = true
+			}
 		}
 	}
 
 	if err == nil {
 		err = json.Unmarshal(body, response)
-		if fetchCache != nil && err == nil {
+		if fetchCache != nil && err == nil && !cachedBodyCurrent {
 			// If caching enabled, write raw response to cache while doing decryption in parallel
-			go fetchCache.Write(envkeyIdPart, body)
+			go func() {
+				_, cacheSpan := tracing.Start(ctx, "cache.write")
+				cacheSpan.SetError(fetchCache.WriteWithValidator(envkeyIdPart, body, meta.Validator))
+				cacheSpan.End()
+			}()
 		}
 	}
 
-	return err
+	return meta, err
 }
 
-func getJsonBody(envkeyHost string, envkeyIdPart string, options FetchOptions, numEndpoint int) ([]byte, *http.Response, error) {
-	var err, fetchErr error
-	var body []byte
-	var r *http.Response
+func getJsonBody(ctx context.Context, envkeyHost string, envkeyIdPart string, options FetchOptions, validator string, numEndpoint int) (body []byte, r *http.Response, err error) {
+	var fetchErr error
 
 	url := getJsonUrl(envkeyHost, envkeyIdPart, options, numEndpoint)
 
+	ctx, span := tracing.Start(ctx, "fetch.endpoint", tracing.Int("fetch.endpoint", numEndpoint), tracing.String("http.host", strings.TrimPrefix(getFetchHost(envkeyHost, numEndpoint), "https://")))
+	defer func() {
+		endRequestSpan(span, r, err)
+	}()
+
 	if options.VerboseOutput {
 		fmt.Fprintf(os.Stderr, "Attempting to load encrypted config from url: %s\n", url)
 	}
 
-	r, fetchErr = httpGet(url, numEndpoint == 1)
+	r, fetchErr = httpGet(ctx, requestClient(options), url, numEndpoint == 1, validator)
 	if r != nil {
 		defer r.Body.Close()
 	}
@@ -575,16 +770,19 @@ func getJsonBody(envkeyHost string, envkeyIdPart string, options FetchOptions, n
 	return body, r, err
 }
 
-func getFailoverJsonBody(signedUrl string, options FetchOptions) ([]byte, *http.Response, error) {
-	var err, fetchErr error
-	var body []byte
-	var r *http.Response
+func getFailoverJsonBody(ctx context.Context, signedUrl string, options FetchOptions, validator string) (body []byte, r *http.Response, err error) {
+	var fetchErr error
+
+	ctx, span := tracing.Start(ctx, "fetch.failover_signed_url")
+	defer func() {
+		endRequestSpan(span, r, err)
+	}()
 
 	if options.VerboseOutput {
 		fmt.Fprintf(os.Stderr, "Attempting to load encrypted config from pre-signed s3 failover url: %s\n", signedUrl)
 	}
 
-	r, fetchErr = httpGet(signedUrl, false)
+	r, fetchErr = httpGet(ctx, requestClient(options), signedUrl, false, validator)
 	if r != nil {
 		defer r.Body.Close()
 	}
@@ -604,3 +802,137 @@ func getFailoverJsonBody(signedUrl string, options FetchOptions) ([]byte, *http.
 
 	return body, r, err
 }
+
+func endRequestSpan(span *tracing.Span, r *http.Response, err error) {
+	if r != nil {
+		span.SetAttributes(tracing.Int("http.status_code", r.StatusCode))
+		if err == nil && r.StatusCode >= 400 {
+			err = errors.New("response status: " + strconv.Itoa(r.StatusCode))
+		}
+	}
+	span.SetError(err)
+	span.End()
+}
+
+type hedgedResult struct {
+	numEndpoint int
+	response    *http.Response
+	err         error
+	span        *tracing.Span
+}
+
+// getJsonBodyHedged starts a request to the primary endpoint, then starts a
+// request to the next failover endpoint each time HedgeDelaySeconds passes
+// without a successful response (or as soon as a request fails). the first
+// successful response wins and the other requests are cancelled. a 404, 426,
+// or 429 from any endpoint is returned immediately, as in the sequential mode.
+// if every endpoint fails, the last fetch error is returned (or an error for
+// the last response's status if none of them got an error).
+func getJsonBodyHedged(ctx context.Context, envkeyHost string, envkeyIdPart string, options FetchOptions, validator string) (body []byte, r *http.Response, numEndpoint int, err error) {
+	numEndpoints := NumFailovers + 1
+	delay := time.Duration(options.HedgeDelaySeconds * float64(time.Second))
+
+	// buffered so requests that lose the race never block
+	results := make(chan hedgedResult, numEndpoints)
+	var cancels []context.CancelFunc
+	launched, finished := 0, 0
+	var lastErr error
+	client := requestClient(options)
+
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		// close the bodies of any requests still in flight
+		go func(remaining int) {
+			for i := 0; i < remaining; i++ {
+				res := <-results
+				res.span.End()
+				if res.response != nil {
+					res.response.Body.Close()
+				}
+			}
+		}(launched - finished)
+	}()
+
+	launch := func() {
+		n := launched
+		launched++
+
+		url := getJsonUrl(envkeyHost, envkeyIdPart, options, n)
+		if options.VerboseOutput {
+			fmt.Fprintf(os.Stderr, "Attempting to load encrypted config from url: %s\n", url)
+		}
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+
+		attemptCtx, span := tracing.Start(attemptCtx, "fetch.endpoint",
+			tracing.Int("fetch.endpoint", n),
+			tracing.String("http.host", strings.TrimPrefix(getFetchHost(envkeyHost, n), "https://")),
+			tracing.Bool("fetch.hedged", true),
+		)
+
+		go func() {
+			resp, err := httpGet(attemptCtx, client, url, n == 1, validator)
+			results <- hedgedResult{numEndpoint: n, response: resp, err: err, span: span}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for finished < numEndpoints {
+		select {
+		case <-timer.C:
+			if launched < numEndpoints {
+				launch()
+				timer.Reset(delay)
+			}
+
+		case res := <-results:
+			finished++
+			numEndpoint, r, err = res.numEndpoint, res.response, res.err
+			logRequestIfVerbose(getJsonUrl(envkeyHost, envkeyIdPart, options, numEndpoint), options, err, r)
+
+			if err == nil && (r.StatusCode == 200 || r.StatusCode == http.StatusNotModified) {
+				body, err = ioutil.ReadAll(r.Body)
+				r.Body.Close()
+				endRequestSpan(res.span, r, err)
+				if err == nil {
+					return body, r, numEndpoint, nil
+				}
+				lastErr = err
+			} else {
+				if r != nil {
+					r.Body.Close()
+				}
+				endRequestSpan(res.span, r, err)
+				if err != nil {
+					lastErr = err
+				}
+				if r != nil && (r.StatusCode == 404 || r.StatusCode == 426 || r.StatusCode == 429) {
+					return nil, r, numEndpoint, nil
+				}
+			}
+
+			// don't wait out the delay once a request has failed
+			if launched < numEndpoints {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				launch()
+				timer.Reset(delay)
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("response status: " + strconv.Itoa(r.StatusCode))
+	}
+	return nil, r, numEndpoints - 1, lastErr
+}
@@ -0,0 +1,123 @@
+package fetch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/cache"
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func startMockServer(t *testing.T, opts mockserver.Options) *mockserver.Server {
+	server, err := mockserver.New(opts)
+	assert.Nil(t, err)
+	restore := server.Install()
+	t.Cleanup(func() {
+		restore()
+		server.Close()
+	})
+	return server
+}
+
+func testIfNoneMatch(t *testing.T, server *mockserver.Server) {
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	res, meta, err := fetch.FetchMapWithMeta(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it"}, res)
+	assert.NotEqual(t, "", meta.Validator)
+	assert.False(t, meta.NotModified)
+
+	// unchanged
+	res, meta2, err := fetch.FetchMapWithMeta(envkey, fetch.FetchOptions{IfNoneMatch: meta.Validator})
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.True(t, meta2.NotModified)
+	assert.Equal(t, meta.Validator, meta2.Validator)
+
+	// changed
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"GO_TEST": "updated"}))
+	res, meta2, err = fetch.FetchMapWithMeta(envkey, fetch.FetchOptions{IfNoneMatch: meta.Validator})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "updated"}, res)
+	assert.False(t, meta2.NotModified)
+	assert.NotEqual(t, meta.Validator, meta2.Validator)
+
+	// through failover
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 503})
+	res, meta, err = fetch.FetchMapWithMeta(envkey, fetch.FetchOptions{IfNoneMatch: meta2.Validator})
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.True(t, meta.NotModified)
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, nil)
+
+	// bundles always get the full response
+	b, err := fetch.FetchBundle(context.Background(), envkey, fetch.FetchOptions{IfNoneMatch: meta2.Validator}, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, b)
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	testIfNoneMatch(t, server)
+}
+
+// with no ETags, unchanged payloads are still detected by their content hash
+func TestIfNoneMatchWithoutETags(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{NoETags: true})
+	testIfNoneMatch(t, server)
+}
+
+func TestCacheValidator(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+	idPart := strings.Split(envkey, "-")[0]
+
+	dir, _ := ioutil.TempDir("", "envkey-cache")
+	defer os.RemoveAll(dir)
+	c, _ := cache.NewCache(dir)
+	options := fetch.FetchOptions{ShouldCache: true, CacheDir: dir}
+
+	waitForValidator := func(validator string) {
+		assert.Eventually(t, func() bool {
+			cached, _ := c.ReadValidator(idPart)
+			return cached == validator
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	// the validator is cached with the body
+	_, meta, err := fetch.FetchMapWithMeta(envkey, options)
+	assert.Nil(t, err)
+	waitForValidator(meta.Validator)
+	oldBody, err := ioutil.ReadFile(filepath.Join(dir, idPart))
+	assert.Nil(t, err)
+
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"GO_TEST": "updated"}))
+	res, meta, err := fetch.FetchMapWithMeta(envkey, options)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "updated"}, res)
+	waitForValidator(meta.Validator)
+
+	// the server's validator matches the cache's, so the cached body is used
+	// (swapped out here to show it)
+	c.WriteWithValidator(idPart, oldBody, meta.Validator)
+	res, meta2, err := fetch.FetchMapWithMeta(envkey, options)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it"}, res)
+	assert.False(t, meta2.NotModified)
+	assert.False(t, meta2.FromCache)
+
+	// a validator without its body falls back to a full fetch
+	os.Remove(filepath.Join(dir, idPart))
+	res, _, err = fetch.FetchMapWithMeta(envkey, options)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "updated"}, res)
+}
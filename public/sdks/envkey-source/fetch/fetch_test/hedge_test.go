@@ -0,0 +1,103 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// records the context of each request to the primary endpoint, so a test
+// can check that it was cancelled
+type primaryRecorder struct {
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	contexts []context.Context
+}
+
+func (rec *primaryRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/fetch" && strings.HasPrefix(req.URL.Hostname(), "envkey.") && req.Header.Get("Failover") == "" {
+		rec.mu.Lock()
+		rec.contexts = append(rec.contexts, req.Context())
+		rec.mu.Unlock()
+	}
+	return rec.transport.RoundTrip(req)
+}
+
+func (rec *primaryRecorder) cancelled() bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.contexts) == 1 && rec.contexts[0].Err() == context.Canceled
+}
+
+func hedgedOptions() fetch.FetchOptions {
+	return fetch.FetchOptions{
+		HedgeDelaySeconds: 0.1,
+		RetryPolicy:       &fetch.RetryPolicy{},
+	}
+}
+
+func TestHedgedSlowPrimary(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	rec := &primaryRecorder{transport: fetch.Client.Transport}
+	client := *fetch.Client
+	client.Transport = rec
+	fetch.Client = &client
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Delay: 5 * time.Second})
+
+	start := time.Now()
+	res, err := fetch.FetchMap(envkey, hedgedOptions())
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it"}, res)
+
+	// the in-region failover responded first
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_IN_REGION_FAILOVER))
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_SIGNED_URL))
+
+	// the primary request lost the race and was cancelled
+	assert.Eventually(t, rec.cancelled, time.Second, 10*time.Millisecond)
+}
+
+func TestHedgedAllFail(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	setFetchFaults(server, &mockserver.Fault{Status: 503})
+
+	_, err := fetch.FetchMap(envkey, hedgedOptions())
+
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_SERVER, fetchErr.Kind)
+	assert.Equal(t, 503, fetchErr.StatusCode)
+	assert.Contains(t, err.Error(), "response status: 503")
+	assert.NotContains(t, err.Error(), "failover response")
+
+	for _, endpoint := range fetchEndpoints {
+		assert.Equal(t, 1, server.Requests(endpoint))
+	}
+
+	// the last fetch error is returned when connections fail
+	setFetchFaults(server, &mockserver.Fault{Drop: true})
+
+	_, err = fetch.FetchMap(envkey, hedgedOptions())
+
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_NETWORK, fetchErr.Kind)
+	assert.Contains(t, err.Error(), "fetch error: ")
+	assert.NotContains(t, err.Error(), "failover response")
+	assert.Equal(t, 0, server.Requests(mockserver.ENDPOINT_SIGNED_URL))
+}
@@ -0,0 +1,151 @@
+package fetch_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var fetchEndpoints = []int{mockserver.ENDPOINT_PRIMARY, mockserver.ENDPOINT_IN_REGION_FAILOVER, mockserver.ENDPOINT_FAILOVER}
+
+func setFetchFaults(server *mockserver.Server, fault *mockserver.Fault) {
+	for _, endpoint := range fetchEndpoints {
+		server.SetFault(endpoint, fault)
+	}
+}
+
+func fetchRequests(server *mockserver.Server) int {
+	n := 0
+	for _, endpoint := range fetchEndpoints {
+		n += server.Requests(endpoint)
+	}
+	return n
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := fetch.RetryPolicy{Retries: 3, BackoffSeconds: 1}
+
+	assert.Equal(t, time.Second, policy.Wait(0, nil))
+	assert.Equal(t, 2*time.Second, policy.Wait(1, nil))
+	assert.Equal(t, 4*time.Second, policy.Wait(2, nil))
+
+	rateLimited := &fetch.FetchError{Kind: fetch.ERROR_RATE_LIMITED, RetryAfter: 10 * time.Second}
+	assert.Equal(t, 10*time.Second, policy.Wait(0, rateLimited))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		wait := policy.Wait(0, nil)
+		assert.True(t, wait >= 500*time.Millisecond && wait <= 1500*time.Millisecond)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, fetch.Retryable(errors.New("connection reset")))
+	assert.True(t, fetch.Retryable(&fetch.FetchError{Kind: fetch.ERROR_SERVER}))
+	assert.False(t, fetch.Retryable(&fetch.FetchError{Kind: fetch.ERROR_UPGRADE_REQUIRED}))
+	assert.False(t, fetch.Retryable(&fetch.FetchError{Kind: fetch.ERROR_DECRYPT}))
+	assert.False(t, fetch.Retryable(&fetch.FetchError{Kind: fetch.ERROR_CLIENT}))
+	assert.False(t, fetch.Retryable(nil))
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	// rate limit the first request only
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 429, RetryAfter: "1"})
+	go func() {
+		for server.Requests(mockserver.ENDPOINT_PRIMARY) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		server.SetFault(mockserver.ENDPOINT_PRIMARY, nil)
+	}()
+
+	start := time.Now()
+	res, err := fetch.FetchMap(envkey, fetch.FetchOptions{
+		RetryPolicy: &fetch.RetryPolicy{Retries: 3, BackoffSeconds: 0.01},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it"}, res)
+	assert.Equal(t, 2, server.Requests(mockserver.ENDPOINT_PRIMARY))
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestNoRetryOnUpgradeRequired(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 426})
+
+	_, err := fetch.FetchMap(envkey, fetch.FetchOptions{
+		RetryPolicy: &fetch.RetryPolicy{Retries: 3, BackoffSeconds: 0.01},
+	})
+
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_UPGRADE_REQUIRED, fetchErr.Kind)
+	assert.Equal(t, 1, fetchRequests(server))
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	setFetchFaults(server, &mockserver.Fault{Status: 403})
+
+	_, err := fetch.FetchMap(envkey, fetch.FetchOptions{
+		RetryPolicy: &fetch.RetryPolicy{Retries: 3, BackoffSeconds: 0.01},
+	})
+
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_CLIENT, fetchErr.Kind)
+	assert.Equal(t, 403, fetchErr.StatusCode)
+	assert.False(t, fetch.Retryable(err))
+
+	// each endpoint is tried once, with no retries
+	assert.Equal(t, 3, fetchRequests(server))
+}
+
+func TestRetryDeadline(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	setFetchFaults(server, &mockserver.Fault{Status: 503})
+
+	start := time.Now()
+	_, err := fetch.FetchMap(envkey, fetch.FetchOptions{
+		RetryPolicy: &fetch.RetryPolicy{Retries: 5, BackoffSeconds: 0.2, DeadlineSeconds: 0.5},
+	})
+
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_SERVER, fetchErr.Kind)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// 3 endpoints per attempt: the first attempt and one retry fit in the deadline
+	assert.Equal(t, 6, fetchRequests(server))
+}
+
+func TestTimeoutSeconds(t *testing.T) {
+	server := startMockServer(t, mockserver.Options{})
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	// fetch.Client was already created, so the timeout is applied per request
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Delay: 5 * time.Second})
+
+	start := time.Now()
+	res, err := fetch.FetchMap(envkey, fetch.FetchOptions{TimeoutSeconds: 0.2, RetryPolicy: &fetch.RetryPolicy{}})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it"}, res)
+
+	// the primary timed out and the in-region failover responded
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_IN_REGION_FAILOVER))
+}
@@ -0,0 +1,138 @@
+package fetch
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const DEFAULT_RETRY_JITTER = 0.2
+
+type ErrorKind int
+
+const (
+	// couldn't connect, timed out, or the response couldn't be read
+	ERROR_NETWORK ErrorKind = iota
+	// 5xx from every endpoint
+	ERROR_SERVER
+	// 429
+	ERROR_RATE_LIMITED
+	// 426--the org requires a newer client
+	ERROR_UPGRADE_REQUIRED
+	// 404, or a malformed ENVKEY
+	ERROR_INVALID
+	// the response couldn't be verified or decrypted with the ENVKEY
+	ERROR_DECRYPT
+	// another 4xx from every endpoint
+	ERROR_CLIENT
+)
+
+func (kind ErrorKind) Retryable() bool {
+	return kind == ERROR_NETWORK || kind == ERROR_SERVER || kind == ERROR_RATE_LIMITED
+}
+
+// FetchError classifies a fetch error for retries. Error() returns the same
+// messages as earlier versions, so checks like err.Error() == "ENVKEY invalid"
+// still work.
+type FetchError struct {
+	Kind       ErrorKind
+	StatusCode int
+
+	// from a 429 response's Retry-After header, if it had one
+	RetryAfter time.Duration
+
+	msg string
+}
+
+func (err *FetchError) Error() string {
+	return err.msg
+}
+
+func newFetchError(kind ErrorKind, statusCode int, msg string) *FetchError {
+	return &FetchError{Kind: kind, StatusCode: statusCode, msg: msg}
+}
+
+// Retryable returns false for errors that won't go away by retrying.
+// unclassified errors are retried.
+func Retryable(err error) bool {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Kind.Retryable()
+	}
+	return err != nil
+}
+
+type RetryPolicy struct {
+	// retries after the first attempt
+	Retries uint8
+
+	// seconds to wait before the first retry, doubling on each retry after that
+	BackoffSeconds float64
+
+	// fraction of each wait that's randomized, e.g. 0.2 for +/- 20%
+	Jitter float64
+
+	// if > 0, the max seconds to spend on all attempts, including waits
+	DeadlineSeconds float64
+}
+
+// DefaultRetryPolicy is used when FetchOptions has no RetryPolicy
+func DefaultRetryPolicy(retries uint8, backoffSeconds float64) RetryPolicy {
+	return RetryPolicy{
+		Retries:        retries,
+		BackoffSeconds: backoffSeconds,
+		Jitter:         DEFAULT_RETRY_JITTER,
+	}
+}
+
+// Wait returns how long to wait before a retry (starting from 0), honoring
+// the Retry-After of a rate limited err if it's longer than the backoff
+func (policy RetryPolicy) Wait(retry int, err error) time.Duration {
+	backoff := policy.BackoffSeconds * math.Pow(2, float64(retry))
+
+	if policy.Jitter > 0 {
+		backoff = backoff * (1 + policy.Jitter*(2*rand.Float64()-1))
+	}
+
+	wait := time.Duration(backoff * float64(time.Second))
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) && fetchErr.RetryAfter > wait {
+		wait = fetchErr.RetryAfter
+	}
+
+	return wait
+}
+
+func (policy RetryPolicy) deadline() time.Duration {
+	return time.Duration(policy.DeadlineSeconds * float64(time.Second))
+}
+
+func (options FetchOptions) retryPolicy() RetryPolicy {
+	if options.RetryPolicy != nil {
+		return *options.RetryPolicy
+	}
+	return DefaultRetryPolicy(options.Retries, options.RetryBackoff)
+}
+
+// parseRetryAfter handles both forms of the header: seconds, or an http date
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
 )
 
 type FetchOptions struct {
@@ -15,6 +16,44 @@ type FetchOptions struct {
 	TimeoutSeconds float64
 	Retries        uint8
 	RetryBackoff   float64
+
+	// if > 0, failover endpoints are requested in parallel with the primary
+	// after this many seconds without a response, rather than only after
+	// the primary fails
+	HedgeDelaySeconds float64
+
+	// if nil, DefaultRetryPolicy(Retries, RetryBackoff) is used
+	RetryPolicy *RetryPolicy
+
+	// if set, unchanged keys, trust chains, and blobs are reused across
+	// fetches rather than verified and decrypted again
+	VerifyCache *parser.VerifyCache
+
+	// the Validator from the last fetch's FetchMeta. if the payload hasn't
+	// changed since, the fetch returns a nil env with NotModified set,
+	// without parsing or decrypting anything. when empty and ShouldCache is
+	// set, the on-disk cache's validator is sent instead, and an unchanged
+	// payload is loaded from the cache.
+	IfNoneMatch string
+}
+
+type FetchMeta struct {
+	// true if the server couldn't be reached and the env was loaded from the on-disk cache
+	FromCache bool
+
+	// identifies the payload: its ETag, or a hash of its content if the
+	// server didn't send one. pass it as IfNoneMatch on the next fetch.
+	Validator string
+
+	// true if the payload matched IfNoneMatch, in which case no env is returned
+	NotModified bool
+}
+
+// conditional is the validator sent with a fetch, and whether it came from
+// the on-disk cache rather than the caller
+type conditional struct {
+	validator string
+	fromCache bool
 }
 
 type FailoverResponse struct {
@@ -0,0 +1,41 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// returned by getJson when the server says the cached body is current, but
+// it can't be read, so the payload needs to be fetched unconditionally
+var errCachedBodyMissing = errors.New("cached body missing")
+
+// ContentValidator is the validator for a payload that was served without an
+// ETag: a strong entity tag of its sha256 hash
+func ContentValidator(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"sha256-` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func responseValidator(r *http.Response, body []byte) string {
+	if r != nil {
+		if etag := r.Header.Get("ETag"); etag != "" {
+			return etag
+		}
+	}
+	return ContentValidator(body)
+}
+
+// unchanged reports whether a 200 response is the payload validator
+// identified. the content hash is checked as well as the ETag, so servers
+// that ignore If-None-Match--or a failover that sends different ETags than
+// the primary--still skip parsing an unchanged payload.
+func unchanged(validator string, r *http.Response, body []byte) bool {
+	validator = strings.TrimPrefix(validator, "W/")
+	if etag := r.Header.Get("ETag"); etag != "" && strings.TrimPrefix(etag, "W/") == validator {
+		return true
+	}
+	return ContentValidator(body) == validator
+}
@@ -0,0 +1,136 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"gopkg.in/yaml.v2"
+)
+
+// hooks run commands when vars matching a set of key globs change.
+// config files are yaml (or json) in the format:
+//
+//   hooks:
+//     - keys: ["FEATURE_*"]
+//       run: ./refresh-flags
+//     - keys: ["DB_*", "REDIS_URL"]
+//       restart: true
+//
+// each command receives a json Payload describing the matching changes on stdin.
+// `restart: true` restarts the command run with --watch.
+
+type Hook struct {
+	Keys    []string `yaml:"keys"`
+	Run     string   `yaml:"run"`
+	Restart bool     `yaml:"restart"`
+}
+
+type Config struct {
+	Hooks []Hook `yaml:"hooks"`
+}
+
+type Change struct {
+	Key      string  `json:"key"`
+	Previous *string `json:"previous"`
+	Current  *string `json:"current"`
+}
+
+type Payload struct {
+	Changes []Change `json:"changes"`
+}
+
+func Load(filePath string) ([]Hook, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = yaml.UnmarshalStrict(b, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, hook := range config.Hooks {
+		err = hook.validate()
+		if err != nil {
+			return nil, errors.New("hook " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+
+	return config.Hooks, nil
+}
+
+// Changes lists every key that was added, updated, or removed between
+// previousEnv and updatedEnv, sorted by key
+func Changes(updatedEnv parser.EnvMap, previousEnv parser.EnvMap) []Change {
+	var changes []Change
+
+	for k, v := range updatedEnv {
+		current := v
+		prev, ok := previousEnv[k]
+
+		if !ok {
+			changes = append(changes, Change{Key: k, Current: &current})
+		} else if prev != v {
+			changes = append(changes, Change{Key: k, Previous: &prev, Current: &current})
+		}
+	}
+
+	for k, v := range previousEnv {
+		if _, ok := updatedEnv[k]; !ok {
+			prev := v
+			changes = append(changes, Change{Key: k, Previous: &prev})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// Match returns the changes with keys matching any of the hook's globs
+func (hook Hook) Match(changes []Change) []Change {
+	var res []Change
+
+	for _, change := range changes {
+		for _, pattern := range hook.Keys {
+			// patterns are validated on Load, so ignore errors here
+			if matched, _ := path.Match(pattern, change.Key); matched {
+				res = append(res, change)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+func (payload Payload) ToJson() ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (hook Hook) validate() error {
+	if len(hook.Keys) == 0 {
+		return errors.New("keys are required")
+	}
+
+	if hook.Run == "" && !hook.Restart {
+		return errors.New("one of run or restart is required")
+	}
+
+	for _, pattern := range hook.Keys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("invalid key pattern: " + pattern)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package hooks_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/hooks"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-hooks")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hooks.yml")
+	ioutil.WriteFile(path, []byte(`
+hooks:
+  - keys: ["FEATURE_*"]
+    run: ./refresh-flags
+  - keys: ["DB_*", "REDIS_URL"]
+    restart: true
+`), 0600)
+
+	res, err := hooks.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []hooks.Hook{
+		{Keys: []string{"FEATURE_*"}, Run: "./refresh-flags"},
+		{Keys: []string{"DB_*", "REDIS_URL"}, Restart: true},
+	}, res)
+
+	ioutil.WriteFile(path, []byte(`{"hooks": [{"keys": ["FEATURE_*"]}]}`), 0600)
+	_, err = hooks.Load(path)
+	assert.EqualError(t, err, "hook 1: one of run or restart is required")
+
+	ioutil.WriteFile(path, []byte(`{"hooks": [{"keys": ["[FEATURE"], "run": "./refresh-flags"}]}`), 0600)
+	_, err = hooks.Load(path)
+	assert.EqualError(t, err, "hook 1: invalid key pattern: [FEATURE")
+}
+
+func TestChangesAndMatch(t *testing.T) {
+	previous := parser.EnvMap{"FEATURE_A": "on", "FEATURE_B": "off", "DB_URL": "postgres://a", "REMOVED": "x"}
+	updated := parser.EnvMap{"FEATURE_A": "on", "FEATURE_B": "on", "DB_URL": "postgres://b", "ADDED": "y"}
+
+	changes := hooks.Changes(updated, previous)
+	keys := []string{}
+	for _, change := range changes {
+		keys = append(keys, change.Key)
+	}
+	assert.Equal(t, []string{"ADDED", "DB_URL", "FEATURE_B", "REMOVED"}, keys)
+
+	matched := hooks.Hook{Keys: []string{"FEATURE_*"}, Run: "./refresh-flags"}.Match(changes)
+	payload, err := hooks.Payload{Changes: matched}.ToJson()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"changes":[{"key":"FEATURE_B","previous":"off","current":"on"}]}`, string(payload))
+
+	matched = hooks.Hook{Keys: []string{"ADDED", "REMOVED"}, Restart: true}.Match(changes)
+	payload, _ = hooks.Payload{Changes: matched}.ToJson()
+	assert.Equal(t, `{"changes":[{"key":"ADDED","previous":null,"current":"y"},{"key":"REMOVED","previous":"x","current":null}]}`, string(payload))
+}
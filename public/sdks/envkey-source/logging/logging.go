@@ -0,0 +1,237 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// structured logging shared by cmd, daemon, fetch and ws. nothing is written
+// until Init is called, so packages used as a library stay quiet.
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+type Level int
+
+const (
+	LEVEL_DEBUG Level = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LEVEL_INFO, errors.New("invalid log level: " + s + " (must be debug, info, warn, or error)")
+}
+
+type Options struct {
+	// text (default) or json
+	Format string
+
+	// default is $HOME/.envkey/logs
+	Dir string
+
+	// debug, info (default), warn, or error
+	Level string
+}
+
+func (opts Options) Validate() error {
+	if opts.Format != "" && opts.Format != FORMAT_TEXT && opts.Format != FORMAT_JSON {
+		return errors.New("invalid log format: " + opts.Format + " (must be text or json)")
+	}
+
+	if opts.Level != "" {
+		_, err := ParseLevel(opts.Level)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type Entry struct {
+	Time         string `json:"time"`
+	Level        string `json:"level"`
+	Component    string `json:"component"`
+	EnvkeyIdPart string `json:"envkeyIdPart,omitempty"`
+	Event        string `json:"event"`
+	Msg          string `json:"msg,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+var mutex sync.Mutex
+var out io.Writer
+var format = FORMAT_TEXT
+var minLevel = LEVEL_INFO
+
+// Init sends logs to a rotated file in the log directory. Output from the
+// standard log package is sent there too, wrapped as json entries when the
+// format is json.
+func Init(filename string, opts Options) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	logFormat := opts.Format
+	if logFormat == "" {
+		logFormat = FORMAT_TEXT
+	}
+
+	level := LEVEL_INFO
+	if opts.Level != "" {
+		level, _ = ParseLevel(opts.Level)
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(home, ".envkey", "logs")
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	w := &lumberjack.Logger{
+		Filename:   filepath.Join(dir, filename),
+		MaxSize:    25, // megabytes
+		MaxBackups: 3,
+		MaxAge:     30, //days
+		Compress:   false,
+	}
+
+	mutex.Lock()
+	out = w
+	format = logFormat
+	minLevel = level
+	mutex.Unlock()
+
+	if logFormat == FORMAT_JSON {
+		log.SetFlags(0)
+		log.SetOutput(stdLogWriter{})
+	} else {
+		log.SetOutput(w)
+	}
+
+	return nil
+}
+
+type Logger struct {
+	component    string
+	envkeyIdPart string
+}
+
+func New(component string) Logger {
+	return Logger{component: component}
+}
+
+func (l Logger) WithEnvkeyIdPart(envkeyIdPart string) Logger {
+	l.envkeyIdPart = envkeyIdPart
+	return l
+}
+
+func (l Logger) Debug(event string, format string, args ...interface{}) {
+	l.write(LEVEL_DEBUG, event, fmt.Sprintf(format, args...), nil)
+}
+
+func (l Logger) Info(event string, format string, args ...interface{}) {
+	l.write(LEVEL_INFO, event, fmt.Sprintf(format, args...), nil)
+}
+
+func (l Logger) Warn(event string, err error, format string, args ...interface{}) {
+	l.write(LEVEL_WARN, event, fmt.Sprintf(format, args...), err)
+}
+
+func (l Logger) Error(event string, err error, format string, args ...interface{}) {
+	l.write(LEVEL_ERROR, event, fmt.Sprintf(format, args...), err)
+}
+
+func (l Logger) write(level Level, event string, msg string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if out == nil || level < minLevel {
+		return
+	}
+
+	now := time.Now()
+
+	if format == FORMAT_TEXT {
+		line := now.Format("2006/01/02 15:04:05") + " " + msg
+		if err != nil {
+			line += ": " + err.Error()
+		}
+		io.WriteString(out, line+"\n")
+		return
+	}
+
+	entry := Entry{
+		Time:         now.UTC().Format(time.RFC3339Nano),
+		Level:        level.String(),
+		Component:    l.component,
+		EnvkeyIdPart: l.envkeyIdPart,
+		Event:        event,
+		Msg:          msg,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	writeEntry(entry)
+}
+
+func writeEntry(entry Entry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	out.Write(append(b, '\n'))
+}
+
+// wraps lines from the standard log package as json entries
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if out != nil && minLevel <= LEVEL_INFO {
+		writeEntry(Entry{
+			Time:  time.Now().UTC().Format(time.RFC3339Nano),
+			Level: LEVEL_INFO.String(),
+			Event: "log",
+			Msg:   strings.TrimRight(string(p), "\n"),
+		})
+	}
+
+	return len(p), nil
+}
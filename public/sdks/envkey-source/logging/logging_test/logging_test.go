@@ -0,0 +1,58 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonLogging(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-logging")
+	defer os.RemoveAll(dir)
+
+	err := logging.Init("test.log", logging.Options{Format: logging.FORMAT_JSON, Dir: dir, Level: "info"})
+	assert.Nil(t, err)
+
+	logger := logging.New("fetch").WithEnvkeyIdPart("abc")
+	logger.Debug("request_succeeded", "filtered out by level")
+	logger.Info("fetch_retry", "retrying fetch (retry %d of %d)", 1, 3)
+	logger.Error("fetch_failed", errors.New("timeout"), "fetch failed")
+	log.Println("unstructured")
+
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "test.log"))
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Equal(t, 3, len(lines))
+
+	var entries []logging.Entry
+	for _, line := range lines {
+		var entry logging.Entry
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+
+	assert.Equal(t, "info", entries[0].Level)
+	assert.Equal(t, "fetch", entries[0].Component)
+	assert.Equal(t, "abc", entries[0].EnvkeyIdPart)
+	assert.Equal(t, "fetch_retry", entries[0].Event)
+	assert.Equal(t, "retrying fetch (retry 1 of 3)", entries[0].Msg)
+
+	assert.Equal(t, "error", entries[1].Level)
+	assert.Equal(t, "timeout", entries[1].Error)
+
+	assert.Equal(t, "log", entries[2].Event)
+	assert.Equal(t, "unstructured", entries[2].Msg)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.Nil(t, logging.Options{}.Validate())
+	assert.NotNil(t, logging.Options{Format: "xml"}.Validate())
+	assert.NotNil(t, logging.Options{Level: "verbose"}.Validate())
+}
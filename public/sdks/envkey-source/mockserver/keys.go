@@ -0,0 +1,46 @@
+package mockserver
+
+import (
+	"sync"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parsertest"
+)
+
+// keys for a mock org: an org owner's root device, which signs an admin
+// device's pubkey. the admin device encrypts each env for each ENVKEY and
+// signs the trust chain back to the root, so responses go through the same
+// trust chain verification as real ones.
+
+type org struct {
+	*parsertest.Org
+	admin *parsertest.Device
+}
+
+// a generated ENVKEY and the builder for its responses
+type envkeyKeys struct {
+	idPart string
+
+	mu      sync.Mutex
+	builder *parsertest.Builder
+}
+
+func newOrg() *org {
+	o := parsertest.NewOrg()
+	return &org{Org: o, admin: parsertest.NewDevice(o.RootDevice())}
+}
+
+func (o *org) newEnvkey() *envkeyKeys {
+	return &envkeyKeys{
+		idPart:  parsertest.RandomString(20),
+		builder: o.Root().SignedBy(o.admin),
+	}
+}
+
+// response encrypts env for the ENVKEY, in the same shape as the fetch
+// endpoint's response, and returns it with the ENVKEY's password
+func (keys *envkeyKeys) response(env parser.EnvMap) (*parser.FetchResponse, string, error) {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	return keys.builder.Env(env).Build()
+}
@@ -0,0 +1,561 @@
+package mockserver
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/ws"
+	"github.com/gorilla/websocket"
+	"github.com/joho/godotenv"
+)
+
+// a local fake of the EnvKey fetch api for end-to-end tests. it serves
+// encrypted envs in the same shape as the real fetch endpoint, with real
+// keys and signed trust chains, so the fetch, parser, daemon, and watch
+// code paths all run unchanged against it.
+//
+// failover is simulated the same way the real api does it: the in-region
+// failover endpoint (requested with a Failover: in-region header) and the
+// secondary failover host (envkey-2.localhost for envkey.localhost) respond
+// with a signed url that serves the payload.
+
+const DEFAULT_HOST = "envkey.localhost"
+
+const (
+	ENDPOINT_PRIMARY = iota
+	ENDPOINT_IN_REGION_FAILOVER
+	ENDPOINT_FAILOVER
+	ENDPOINT_SIGNED_URL
+)
+
+// websocket close codes that stop the daemon from reconnecting
+const CLOSE_FORBIDDEN = 4001
+const CLOSE_THROTTLED = 4002
+
+type Options struct {
+	// listen address (default is 127.0.0.1 on a random port)
+	Addr string
+
+	// hostname in generated ENVKEYs (default is envkey.localhost)
+	Host string
+
+	// don't send ETags or respond to If-None-Match, like a server without
+	// conditional request support
+	NoETags bool
+}
+
+// Fault makes an endpoint fail or slow down until it's cleared
+type Fault struct {
+	// respond with this status instead of the payload
+	Status int
+
+	// Retry-After header for the response, e.g. for a 429
+	RetryAfter string
+
+	// close the connection without responding
+	Drop bool
+
+	// wait before responding (or dropping)
+	Delay time.Duration
+}
+
+type Server struct {
+	hostname         string
+	host             string
+	failoverHostname string
+	noETags          bool
+	certPEM          []byte
+	listener         net.Listener
+	httpServer       *http.Server
+	org              *org
+
+	mu       sync.Mutex
+	envs     map[string]*mockEnv
+	faults   map[int]Fault
+	requests map[int]int
+}
+
+type mockEnv struct {
+	keys    *envkeyKeys
+	body    []byte
+	sockets []*socket
+}
+
+type socket struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+var upgrader = websocket.Upgrader{}
+
+// New starts a server with a new org. call Close when done.
+func New(opts Options) (*Server, error) {
+	if opts.Addr == "" {
+		opts.Addr = "127.0.0.1:0"
+	}
+	if opts.Host == "" {
+		opts.Host = DEFAULT_HOST
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	s := &Server{
+		hostname:         opts.Host,
+		host:             net.JoinHostPort(opts.Host, port),
+		failoverHostname: FailoverHostname(opts.Host),
+		noETags:          opts.NoETags,
+		listener:         listener,
+		org:              newOrg(),
+		envs:             map[string]*mockEnv{},
+		faults:           map[int]Fault{},
+		requests:         map[int]int{},
+	}
+
+	cert, certPEM, err := selfSignedCert([]string{opts.Host, s.failoverHostname})
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s.certPEM = certPEM
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fetch", s.handleFetch)
+	mux.HandleFunc("/failover/", s.handleSignedUrl)
+	mux.HandleFunc("/", s.handleSocket)
+
+	s.httpServer = &http.Server{Handler: mux}
+	go s.httpServer.Serve(tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}}))
+
+	return s, nil
+}
+
+// FailoverHostname returns the secondary failover hostname the fetch client
+// derives from an ENVKEY's host, or host itself if it has no subdomain
+func FailoverHostname(host string) string {
+	return regexp.MustCompile(`^(.+?)\.(.+)$`).ReplaceAllString(host, "$1-2.$2")
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for _, env := range s.envs {
+		for _, sock := range env.sockets {
+			sock.conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	return s.httpServer.Close()
+}
+
+// Host returns the host:port used in ENVKEYs
+func (s *Server) Host() string {
+	return s.host
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// CertPEM returns the server's self-signed certificate
+func (s *Server) CertPEM() []byte {
+	return s.certPEM
+}
+
+// Client returns an http client that trusts the server's certificate and
+// connects to it for the server's hostnames
+func (s *Server) Client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: s.clientTLSConfig(),
+			DialContext:     s.dial,
+		},
+	}
+}
+
+// Install points fetch requests and daemon websockets in this process at
+// the server. call the returned func to undo it.
+func (s *Server) Install() func() {
+	prevClient := fetch.Client
+	prevOpts := ws.DefaultOpts
+
+	fetch.Client = s.Client()
+	ws.DefaultOpts = append(append([]ws.WsOpts{}, prevOpts...), func(dl *websocket.Dialer) {
+		dl.TLSClientConfig = s.clientTLSConfig()
+		dl.NetDialContext = s.dial
+	})
+
+	return func() {
+		fetch.Client = prevClient
+		ws.DefaultOpts = prevOpts
+	}
+}
+
+func (s *Server) clientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(s.certPEM)
+	return &tls.Config{RootCAs: pool}
+}
+
+func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	hostname, _, _ := net.SplitHostPort(addr)
+	if s.isOwnHostname(hostname) {
+		addr = s.Addr()
+	}
+
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (s *Server) isOwnHostname(hostname string) bool {
+	return hostname == s.hostname || hostname == s.failoverHostname
+}
+
+// AddEnv generates an ENVKEY that loads env
+func (s *Server) AddEnv(env parser.EnvMap) (string, error) {
+	keys := s.org.newEnvkey()
+
+	body, pw, err := s.encrypt(keys, env)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.envs[keys.idPart] = &mockEnv{keys: keys, body: body}
+	s.mu.Unlock()
+
+	return keys.idPart + "-" + pw + "-" + s.host, nil
+}
+
+// AddEnvFile generates an ENVKEY that loads the vars in a plaintext .env file
+func (s *Server) AddEnvFile(path string) (string, error) {
+	env, err := godotenv.Read(path)
+	if err != nil {
+		return "", err
+	}
+	return s.AddEnv(env)
+}
+
+// UpdateEnv replaces the ENVKEY's env and notifies its websockets
+func (s *Server) UpdateEnv(envkey string, env parser.EnvMap) error {
+	s.mu.Lock()
+	mockEnv, ok := s.envs[idPart(envkey)]
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("unknown ENVKEY")
+	}
+
+	body, _, err := s.encrypt(mockEnv.keys, env)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	mockEnv.body = body
+	s.mu.Unlock()
+
+	return s.Notify(envkey)
+}
+
+// RemoveEnv makes the ENVKEY invalid: fetches 404 and its websockets are
+// closed as forbidden
+func (s *Server) RemoveEnv(envkey string) {
+	s.CloseSockets(envkey, CLOSE_FORBIDDEN)
+
+	s.mu.Lock()
+	delete(s.envs, idPart(envkey))
+	s.mu.Unlock()
+}
+
+// Notify sends each of the ENVKEY's websockets a change notification in
+// the rolling reload format: "connectionNum|totalConnections"
+func (s *Server) Notify(envkey string) error {
+	s.mu.Lock()
+	mockEnv, ok := s.envs[idPart(envkey)]
+	var sockets []*socket
+	if ok {
+		sockets = append(sockets, mockEnv.sockets...)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("unknown ENVKEY")
+	}
+
+	var err error
+	for i, sock := range sockets {
+		sock.mu.Lock()
+		writeErr := sock.conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d|%d", i, len(sockets))))
+		sock.mu.Unlock()
+		if writeErr != nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+// CloseSockets closes the ENVKEY's websockets with a close code, like
+// CLOSE_FORBIDDEN or CLOSE_THROTTLED
+func (s *Server) CloseSockets(envkey string, code int) {
+	s.mu.Lock()
+	var sockets []*socket
+	if mockEnv, ok := s.envs[idPart(envkey)]; ok {
+		sockets = mockEnv.sockets
+		mockEnv.sockets = nil
+	}
+	s.mu.Unlock()
+
+	for _, sock := range sockets {
+		msg := websocket.FormatCloseMessage(code, closeText(code))
+		sock.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		sock.conn.Close()
+	}
+}
+
+// Connections returns the number of websockets connected for the ENVKEY
+func (s *Server) Connections(envkey string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mockEnv, ok := s.envs[idPart(envkey)]; ok {
+		return len(mockEnv.sockets)
+	}
+	return 0
+}
+
+// SetFault makes an endpoint fail or slow down. a nil fault clears it.
+func (s *Server) SetFault(endpoint int, fault *Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fault == nil {
+		delete(s.faults, endpoint)
+	} else {
+		s.faults[endpoint] = *fault
+	}
+}
+
+// Requests returns how many requests an endpoint has received
+func (s *Server) Requests(endpoint int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+func (s *Server) encrypt(keys *envkeyKeys, env parser.EnvMap) ([]byte, string, error) {
+	response, pw, err := keys.response(env)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := json.Marshal(response)
+	return body, pw, err
+}
+
+func (s *Server) body(idPart string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mockEnv, ok := s.envs[idPart]; ok {
+		return mockEnv.body, true
+	}
+	return nil, false
+}
+
+func (s *Server) handleFetch(w http.ResponseWriter, r *http.Request) {
+	endpoint := ENDPOINT_PRIMARY
+	if r.Header.Get("Failover") == "in-region" {
+		endpoint = ENDPOINT_IN_REGION_FAILOVER
+	} else if hostname, _, _ := net.SplitHostPort(r.Host); hostname == s.failoverHostname && hostname != s.hostname {
+		endpoint = ENDPOINT_FAILOVER
+	}
+
+	if s.applyFault(w, r, endpoint) {
+		return
+	}
+
+	idPart := r.URL.Query().Get("envkeyIdPart")
+	body, ok := s.body(idPart)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if endpoint == ENDPOINT_PRIMARY {
+		s.writeBody(w, r, body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(fetch.FailoverResponse{
+		SignedUrl: "https://" + s.host + "/failover/" + idPart,
+	})
+}
+
+func (s *Server) handleSignedUrl(w http.ResponseWriter, r *http.Request) {
+	if s.applyFault(w, r, ENDPOINT_SIGNED_URL) {
+		return
+	}
+
+	body, ok := s.body(strings.TrimPrefix(r.URL.Path, "/failover/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.writeBody(w, r, body)
+}
+
+// writeBody writes the payload with an ETag, or a 304 if it matches the
+// request's If-None-Match. ETags are md5 hashes, as s3's are, so they differ
+// from the client's own content hashes.
+func (s *Server) writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	if !s.noETags {
+		etag := fmt.Sprintf(`"%x"`, md5.Sum(body))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// the daemon connects to wss://{host} with its ENVKEY id in an
+// authorization header
+func (s *Server) handleSocket(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var auth struct {
+		EnvkeyIdPart string `json:"envkeyIdPart"`
+	}
+	json.Unmarshal([]byte(r.Header.Get("authorization")), &auth)
+
+	if _, ok := s.body(auth.EnvkeyIdPart); !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	sock := &socket{conn: conn}
+
+	s.mu.Lock()
+	mockEnv, ok := s.envs[auth.EnvkeyIdPart]
+	if ok {
+		mockEnv.sockets = append(mockEnv.sockets, sock)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	// reading handles pings from the daemon until the connection closes
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+
+	s.removeSocket(auth.EnvkeyIdPart, sock)
+	conn.Close()
+}
+
+func (s *Server) removeSocket(idPart string, sock *socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mockEnv, ok := s.envs[idPart]
+	if !ok {
+		return
+	}
+
+	for i, current := range mockEnv.sockets {
+		if current == sock {
+			mockEnv.sockets = append(mockEnv.sockets[:i], mockEnv.sockets[i+1:]...)
+			return
+		}
+	}
+}
+
+// applyFault counts the request, then responds per the endpoint's fault if
+// it has one. returns true if the request was handled.
+func (s *Server) applyFault(w http.ResponseWriter, r *http.Request, endpoint int) bool {
+	s.mu.Lock()
+	s.requests[endpoint]++
+	fault, ok := s.faults[endpoint]
+	s.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	if fault.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			conn, _, err := hijacker.Hijack()
+			if err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if fault.Status == 0 {
+		return false
+	}
+
+	if fault.RetryAfter != "" {
+		w.Header().Set("Retry-After", fault.RetryAfter)
+	}
+	w.WriteHeader(fault.Status)
+	return true
+}
+
+func closeText(code int) string {
+	switch code {
+	case CLOSE_FORBIDDEN:
+		return "forbidden"
+	case CLOSE_THROTTLED:
+		return "throttled"
+	}
+	return ""
+}
+
+func idPart(envkey string) string {
+	return strings.Split(envkey, "-")[0]
+}
@@ -0,0 +1,158 @@
+package mockserver_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func start(t *testing.T) *mockserver.Server {
+	server, err := mockserver.New(mockserver.Options{})
+	assert.Nil(t, err)
+	restore := server.Install()
+	t.Cleanup(func() {
+		restore()
+		server.Close()
+	})
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	server := start(t)
+
+	envkey, err := server.AddEnv(parser.EnvMap{"GO_TEST": "it", "GO_TEST_2": "works!", "EMPTY": ""})
+	assert.Nil(t, err)
+
+	res, err := fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it", "GO_TEST_2": "works!", "EMPTY": ""}, res)
+
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"GO_TEST": "updated"}))
+	res, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "updated"}, res)
+
+	// the ENVKEY's key is the only one that decrypts it
+	otherEnvkey, _ := server.AddEnv(parser.EnvMap{})
+	_, err = fetch.FetchMap(envkey[:21]+otherEnvkey[21:], fetch.FetchOptions{})
+	assert.EqualError(t, err, "ENVKEY invalid")
+}
+
+func TestAddEnvFile(t *testing.T) {
+	server := start(t)
+
+	dir, _ := ioutil.TempDir("", "envkey-mock-server")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".env")
+	ioutil.WriteFile(path, []byte("GO_TEST=it\nGO_TEST_2='works!'\n"), 0600)
+
+	envkey, err := server.AddEnvFile(path)
+	assert.Nil(t, err)
+
+	res, err := fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"GO_TEST": "it", "GO_TEST_2": "works!"}, res)
+}
+
+func TestFailover(t *testing.T) {
+	server := start(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 503})
+	res, err := fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "it", res["GO_TEST"])
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_IN_REGION_FAILOVER))
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_SIGNED_URL))
+	assert.Equal(t, 0, server.Requests(mockserver.ENDPOINT_FAILOVER))
+
+	server.SetFault(mockserver.ENDPOINT_IN_REGION_FAILOVER, &mockserver.Fault{Drop: true})
+	res, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "it", res["GO_TEST"])
+	assert.Equal(t, 1, server.Requests(mockserver.ENDPOINT_FAILOVER))
+
+	server.SetFault(mockserver.ENDPOINT_FAILOVER, &mockserver.Fault{Status: 500})
+	_, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_SERVER, fetchErr.Kind)
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, nil)
+	_, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.Nil(t, err)
+}
+
+func TestErrorResponses(t *testing.T) {
+	server := start(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 426})
+	_, err := fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.EqualError(t, err, "organization requires a newer version of envkey-source client")
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, &mockserver.Fault{Status: 429, RetryAfter: "7"})
+	_, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_RATE_LIMITED, fetchErr.Kind)
+	assert.Equal(t, 7*time.Second, fetchErr.RetryAfter)
+
+	server.SetFault(mockserver.ENDPOINT_PRIMARY, nil)
+	server.RemoveEnv(envkey)
+	_, err = fetch.FetchMap(envkey, fetch.FetchOptions{})
+	assert.EqualError(t, err, "ENVKEY invalid")
+}
+
+func dialSocket(t *testing.T, server *mockserver.Server, envkey string) *websocket.Conn {
+	dialer := &websocket.Dialer{}
+	for _, opt := range ws.DefaultOpts {
+		opt(dialer)
+	}
+
+	idPart, _, host := fetch.SplitEnvkey(envkey)
+	conn, _, err := dialer.Dial("wss://"+host, map[string][]string{
+		"authorization": {`{"type":"fetchEnvkeySocketAuthParams","envkeyIdPart":"` + idPart + `"}`},
+	})
+	assert.Nil(t, err)
+	return conn
+}
+
+func TestSockets(t *testing.T) {
+	server := start(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"GO_TEST": "it"})
+
+	conn1 := dialSocket(t, server, envkey)
+	defer conn1.Close()
+	conn2 := dialSocket(t, server, envkey)
+	defer conn2.Close()
+
+	for server.Connections(envkey) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"GO_TEST": "updated"}))
+
+	_, msg, err := conn1.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "0|2", string(msg))
+
+	_, msg, err = conn2.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "1|2", string(msg))
+
+	server.RemoveEnv(envkey)
+	_, _, err = conn1.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, mockserver.CLOSE_FORBIDDEN))
+	assert.Contains(t, err.Error(), "4001: forbidden")
+}
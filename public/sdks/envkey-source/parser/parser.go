@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -8,11 +9,27 @@ import (
 
 	// "github.com/davecgh/go-spew/spew"
 	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/envkey/envkey/public/sdks/envkey-source/trust"
 	"github.com/mitchellh/mapstructure"
 )
 
 func (response *FetchResponse) Parse(encryptionKey string, forceV2Only bool) (EnvMap, *crypto.Privkey, *crypto.SignedData, []string, bool, error) {
+	return response.ParseContext(context.Background(), encryptionKey, forceV2Only)
+}
+
+// ParseContext is like Parse, with tracing spans for each step as children of the span in ctx
+func (response *FetchResponse) ParseContext(ctx context.Context, encryptionKey string, forceV2Only bool) (EnvMap, *crypto.Privkey, *crypto.SignedData, []string, bool, error) {
+	return response.ParseWithCache(ctx, encryptionKey, forceV2Only, nil)
+}
+
+// ParseWithCache is like ParseContext, reusing verified keys and trust chains
+// and decrypted blobs from cache when their content hasn't changed. cache
+// may be nil.
+func (response *FetchResponse) ParseWithCache(ctx context.Context, encryptionKey string, forceV2Only bool, cache *VerifyCache) (EnvMap, *crypto.Privkey, *crypto.SignedData, []string, bool, error) {
+	ctx, span := tracing.Start(ctx, "parser.parse")
+	defer span.End()
+
 	var err error
 	var responseWithKeys *ResponseWithKeys
 	var responseWithTrustChains *ResponseWithTrustChains
@@ -23,8 +40,10 @@ func (response *FetchResponse) Parse(encryptionKey string, forceV2Only bool) (En
 	if response.V1Payload != nil && !forceV2Only {
 		var v1Map EnvMap
 		v1Map, err = response.V1Payload.LegacyV1Parse(encryptionKey)
+		span.SetAttributes(tracing.Bool("v1", true))
 
 		if err != nil {
+			span.SetError(err)
 			return nil, nil, nil, []string{}, true, err
 		}
 
@@ -36,28 +55,51 @@ func (response *FetchResponse) Parse(encryptionKey string, forceV2Only bool) (En
 		return nil, nil, nil, []string{}, false, err
 	}
 
-	responseWithKeys, err = response.parseKeys(encryptionKey)
+	_, keysSpan := tracing.Start(ctx, "parser.parse_keys")
+	responseWithKeys, err = response.parseKeys(encryptionKey, cache)
+	keysSpan.SetError(err)
+	keysSpan.End()
 	if err != nil {
-		return nil, nil, nil, []string{}, false, err
+		span.SetError(err)
+		return nil, nil, nil, []string{}, false, &KeyError{err}
 	}
 
-	responseWithTrustChains, newSignedTrustedRoot, replacementIds, err = responseWithKeys.parseTrustChain()
+	_, trustChainSpan := tracing.Start(ctx, "parser.parse_trust_chain")
+	responseWithTrustChains, newSignedTrustedRoot, replacementIds, err = responseWithKeys.parseTrustChain(cache)
+	trustChainSpan.SetError(err)
+	trustChainSpan.End()
 
 	if err != nil {
+		span.SetError(err)
 		return nil, nil, nil, []string{}, false, err
 	}
 
-	decrypted, err = responseWithTrustChains.verifyAndDecrypt()
+	decrypted, err = responseWithTrustChains.verifyAndDecrypt(ctx)
 
 	if err != nil {
+		span.SetError(err)
 		return nil, nil, nil, []string{}, false, err
 	}
 
 	res, err := decrypted.toMap()
+	span.SetError(err)
 
 	return res, responseWithKeys.DecryptedPrivkey, newSignedTrustedRoot, replacementIds, false, err
 }
 
+// ParseWithV1Upgrade parses the response, then for a v1 ENVKEY that's been
+// upgraded, parses the v2 payload with the key from the v1 payload. cache
+// may be nil.
+func (response *FetchResponse) ParseWithV1Upgrade(ctx context.Context, encryptionKey string, cache *VerifyCache) (EnvMap, *crypto.Privkey, *crypto.SignedData, []string, error) {
+	res, privkey, newSignedTrustedRoot, replacementIds, isV1UpgradedEnvkey, err := response.ParseWithCache(ctx, encryptionKey, false, cache)
+
+	if err == nil && isV1UpgradedEnvkey {
+		res, privkey, newSignedTrustedRoot, replacementIds, _, err = response.ParseWithCache(ctx, res["KEY"], true, cache)
+	}
+
+	return res, privkey, newSignedTrustedRoot, replacementIds, err
+}
+
 func (env EnvMap) ToJson() (string, error) {
 	envJson, err := json.Marshal(env)
 	if err != nil {
@@ -66,28 +108,49 @@ func (env EnvMap) ToJson() (string, error) {
 	return string(envJson), nil
 }
 
-func (response *FetchResponse) parseKeys(encryptionKey string) (*ResponseWithKeys, error) {
-	var decryptedPrivkey crypto.Privkey
-	var err error
+// KeyError is returned when the response's private key can't be decrypted
+// with the encryption key or doesn't match its public key, which usually
+// means the ENVKEY is wrong
+type KeyError struct {
+	Err error
+}
 
-	decryptedPrivkeyBytes, err := crypto.DecryptSymmetric(response.EncryptedPrivkey, []byte(encryptionKey))
-	if err != nil {
-		return nil, err
-	}
+func (e *KeyError) Error() string {
+	return e.Err.Error()
+}
 
-	err = json.Unmarshal(decryptedPrivkeyBytes, &decryptedPrivkey)
-	if err != nil {
-		return nil, err
-	}
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
 
-	err = crypto.VerifyPubkeyWithPrivkey(response.Pubkey, &decryptedPrivkey)
+func (response *FetchResponse) parseKeys(encryptionKey string, cache *VerifyCache) (*ResponseWithKeys, error) {
+	decryptedPrivkey, err := cache.privkey(response, encryptionKey, func() (*crypto.Privkey, error) {
+		var decryptedPrivkey crypto.Privkey
+
+		decryptedPrivkeyBytes, err := crypto.DecryptSymmetric(response.EncryptedPrivkey, []byte(encryptionKey))
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(decryptedPrivkeyBytes, &decryptedPrivkey)
+		if err != nil {
+			return nil, err
+		}
+
+		err = crypto.VerifyPubkeyWithPrivkey(response.Pubkey, &decryptedPrivkey)
+		if err != nil {
+			return nil, err
+		}
+
+		return &decryptedPrivkey, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	responseWithKeys := ResponseWithKeys{
 		RootKeys{
-			DecryptedPrivkey: &decryptedPrivkey,
+			DecryptedPrivkey: decryptedPrivkey,
 			VerifiedPubkey:   response.Pubkey,
 		},
 		response,
@@ -201,10 +264,10 @@ func (replacement *RootPubkeyReplacement) signer() *trust.Signer {
 	}
 }
 
-func (responseWithKeys *ResponseWithKeys) parseTrustChain() (*ResponseWithTrustChains, *crypto.SignedData, []string, error) {
+func (responseWithKeys *ResponseWithKeys) parseTrustChain(cache *VerifyCache) (*ResponseWithTrustChains, *crypto.SignedData, []string, error) {
 	var newSignedTrustedRoot *crypto.SignedData
 
-	trustedRoot, err := parseTrustedKeys(responseWithKeys.Response.SignedTrustedRoot, responseWithKeys.Response.Pubkey)
+	trustedRoot, err := cache.trustedKeys(responseWithKeys.Response.SignedTrustedRoot, responseWithKeys.Response.Pubkey)
 	if err != nil {
 		return nil, nil, []string{}, err
 	}
@@ -214,11 +277,23 @@ func (responseWithKeys *ResponseWithKeys) parseTrustChain() (*ResponseWithTrustC
 		trustedRoot,
 		responseWithKeys.Response.RootPubkeyReplacements,
 		responseWithKeys.DecryptedPrivkey,
+		cache,
 	)
 	if err != nil {
 		return nil, nil, []string{}, err
 	}
 
+	// signers verified against the same trusted root can skip verification
+	var rootKey string
+	if cache != nil {
+		trustedRootJson, err := json.Marshal(trustedRoot)
+		if err != nil {
+			return nil, nil, []string{}, err
+		}
+		rootKey = cacheKey(string(trustedRootJson))
+	}
+	trusted := trustedRootWithCache{root: trustedRoot, rootKey: rootKey, cache: cache}
+
 	var keyableBlobWithTrustChains *KeyableBlobWithTrustChains
 	var blocksWithTrustChain []*KeyableBlobWithTrustChains
 
@@ -229,7 +304,7 @@ func (responseWithKeys *ResponseWithKeys) parseTrustChain() (*ResponseWithTrustC
 	if responseWithKeys.Response.KeyableBlob != nil {
 		numQueued++
 		go func() {
-			keyableBlobWithTrustChains, err = responseWithKeys.Response.KeyableBlob.parseTrustChain(responseWithKeys.DecryptedPrivkey, trustedRoot)
+			keyableBlobWithTrustChains, err = responseWithKeys.Response.KeyableBlob.parseTrustChain(responseWithKeys.DecryptedPrivkey, trusted)
 			resChan <- err
 		}()
 	}
@@ -241,7 +316,7 @@ func (responseWithKeys *ResponseWithKeys) parseTrustChain() (*ResponseWithTrustC
 		for i, block := range responseWithKeys.Response.Blocks {
 			numQueued++
 			go func(i int, block *KeyableBlob) {
-				blockWithTrustChain, err := block.parseTrustChain(responseWithKeys.DecryptedPrivkey, trustedRoot)
+				blockWithTrustChain, err := block.parseTrustChain(responseWithKeys.DecryptedPrivkey, trusted)
 				if err == nil {
 					lock.Lock()
 					blocksWithTrustChain[i] = blockWithTrustChain
@@ -275,26 +350,28 @@ func (responseWithKeys *ResponseWithKeys) parseTrustChain() (*ResponseWithTrustC
 	return &responseWithTrustChains, newSignedTrustedRoot, replacementIds, nil
 }
 
-func (blobFields *KeyableBlobFields) parseTrustChain(decryptedPrivkey *crypto.Privkey, trustedRoot trust.TrustedKeyablesMap) (*KeyableBlobFieldsWithTrustChain, error) {
-	trustChain, err := parseTrustedKeys(blobFields.EncryptedByTrustChain, blobFields.EncryptedByPubkey)
+func (blobFields *KeyableBlobFields) parseTrustChain(decryptedPrivkey *crypto.Privkey, trusted trustedRootWithCache) (*KeyableBlobFieldsWithTrustChain, error) {
+	trustChain, err := trusted.cache.trustedKeys(blobFields.EncryptedByTrustChain, blobFields.EncryptedByPubkey)
 
 	if err != nil {
 		return nil, err
 	}
 
-	trustedChain := trust.TrustedKeyablesChain{TrustedRoot: trustedRoot, TrustChain: trustChain}
+	trustedChain := trust.TrustedKeyablesChain{TrustedRoot: trusted.root, TrustChain: trustChain}
 
 	withTrustChain := KeyableBlobFieldsWithTrustChain{
 		KeyableBlobFields:    blobFields,
 		DecryptedPrivkey:     decryptedPrivkey,
 		TrustedKeyablesChain: &trustedChain,
 		Signer:               blobFields.signer(),
+		rootKey:              trusted.rootKey,
+		cache:                trusted.cache,
 	}
 
 	return &withTrustChain, nil
 }
 
-func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trustedRoot trust.TrustedKeyablesMap) (*KeyableBlobWithTrustChains, error) {
+func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trusted trustedRootWithCache) (*KeyableBlobWithTrustChains, error) {
 	blobWithTrustChains := KeyableBlobWithTrustChains{}
 	lock := sync.RWMutex{}
 
@@ -305,7 +382,7 @@ func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trust
 	if blob.Env != nil {
 		numQueued++
 		go func() {
-			envWithTrustChain, err := blob.Env.parseTrustChain(decryptedPrivkey, trustedRoot)
+			envWithTrustChain, err := blob.Env.parseTrustChain(decryptedPrivkey, trusted)
 			lock.Lock()
 			blobWithTrustChains.Env = envWithTrustChain
 			lock.Unlock()
@@ -316,7 +393,7 @@ func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trust
 	if blob.SubEnv != nil {
 		numQueued++
 		go func() {
-			subEnvWithTrustChain, err := blob.SubEnv.parseTrustChain(decryptedPrivkey, trustedRoot)
+			subEnvWithTrustChain, err := blob.SubEnv.parseTrustChain(decryptedPrivkey, trusted)
 			lock.Lock()
 			blobWithTrustChains.SubEnv = subEnvWithTrustChain
 			lock.Unlock()
@@ -327,7 +404,7 @@ func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trust
 	if blob.Locals != nil {
 		numQueued++
 		go func() {
-			localsWithTrustChain, err := blob.Locals.parseTrustChain(decryptedPrivkey, trustedRoot)
+			localsWithTrustChain, err := blob.Locals.parseTrustChain(decryptedPrivkey, trusted)
 			lock.Lock()
 			blobWithTrustChains.Locals = localsWithTrustChain
 			lock.Unlock()
@@ -340,7 +417,7 @@ func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trust
 		for environmentId, blobFields := range blob.InheritanceOverrides {
 			numQueued++
 			go func(environmentId string, blobFields KeyableBlobFields) {
-				blobFieldWithTrustChain, err := blobFields.parseTrustChain(decryptedPrivkey, trustedRoot)
+				blobFieldWithTrustChain, err := blobFields.parseTrustChain(decryptedPrivkey, trusted)
 
 				lock.Lock()
 				blobWithTrustChains.InheritanceOverrides[environmentId] = blobFieldWithTrustChain
@@ -368,7 +445,7 @@ func (blob *KeyableBlob) parseTrustChain(decryptedPrivkey *crypto.Privkey, trust
 	return &blobWithTrustChains, nil
 }
 
-func (response *ResponseWithTrustChains) verify() error {
+func (response *ResponseWithTrustChains) verify(ctx context.Context) error {
 	resChan := make(chan error)
 	var numQueued uint16
 	var numProcessed uint16
@@ -376,17 +453,25 @@ func (response *ResponseWithTrustChains) verify() error {
 	if response.KeyableBlobWithTrustChains != nil {
 		numQueued++
 		go func() {
-			resChan <- response.KeyableBlobWithTrustChains.verify()
+			_, span := tracing.Start(ctx, "parser.verify_blob", tracing.String("blob", "env"))
+			err := response.KeyableBlobWithTrustChains.verify()
+			span.SetError(err)
+			span.End()
+			resChan <- err
 		}()
 	}
 
 	if len(response.BlocksWithTrustChain) > 0 {
 
-		for _, block := range response.BlocksWithTrustChain {
+		for i, block := range response.BlocksWithTrustChain {
 			numQueued++
-			go func(block *KeyableBlobWithTrustChains) {
-				resChan <- block.verify()
-			}(block)
+			go func(i int, block *KeyableBlobWithTrustChains) {
+				_, span := tracing.Start(ctx, "parser.verify_blob", tracing.String("blob", "block"), tracing.Int("block", i))
+				err := block.verify()
+				span.SetError(err)
+				span.End()
+				resChan <- err
+			}(i, block)
 		}
 	}
 
@@ -461,8 +546,24 @@ func (blob *KeyableBlobWithTrustChains) verify() error {
 }
 
 func (blobFields *KeyableBlobFieldsWithTrustChain) verify() error {
-	err := blobFields.TrustedKeyablesChain.Verify(blobFields.Signer)
-	return err
+	return blobFields.cache.verified(blobFields, blobFields.rootKey, func() error {
+		return blobFields.TrustedKeyablesChain.Verify(blobFields.Signer)
+	})
+}
+
+func (blobFields *KeyableBlobFieldsWithTrustChain) decryptEnv() ([]byte, error) {
+	return blobFields.cache.decrypted(blobFields, func() ([]byte, error) {
+		decryptedKey, err := crypto.Decrypt(
+			blobFields.EncryptedKey,
+			blobFields.Signer.Pubkey,
+			blobFields.DecryptedPrivkey,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.DecryptSymmetric(blobFields.EncryptedEnv, decryptedKey)
+	})
 }
 
 func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error) {
@@ -478,18 +579,11 @@ func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error)
 		numQueued++
 		go func() {
 			var decrypted []byte
-			var decryptedKey []byte
 			var err error
 			if blob.Env.EncryptedEnv.Data == "{}" {
 				decrypted = []byte(blob.Env.EncryptedEnv.Data)
 			} else {
-				decryptedKey, err = crypto.Decrypt(
-					blob.Env.EncryptedKey,
-					blob.Env.Signer.Pubkey,
-					blob.Env.DecryptedPrivkey,
-				)
-
-				decrypted, err = crypto.DecryptSymmetric(blob.Env.EncryptedEnv, decryptedKey)
+				decrypted, err = blob.Env.decryptEnv()
 			}
 
 			if err == nil {
@@ -507,18 +601,11 @@ func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error)
 		numQueued++
 		go func() {
 			var decrypted []byte
-			var decryptedKey []byte
 			var err error
 			if blob.SubEnv.EncryptedEnv.Data == "{}" {
 				decrypted = []byte(blob.SubEnv.EncryptedEnv.Data)
 			} else {
-				decryptedKey, err = crypto.Decrypt(
-					blob.SubEnv.EncryptedKey,
-					blob.SubEnv.Signer.Pubkey,
-					blob.SubEnv.DecryptedPrivkey,
-				)
-
-				decrypted, err = crypto.DecryptSymmetric(blob.SubEnv.EncryptedEnv, decryptedKey)
+				decrypted, err = blob.SubEnv.decryptEnv()
 			}
 
 			if err == nil {
@@ -535,18 +622,11 @@ func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error)
 		numQueued++
 		go func() {
 			var decrypted []byte
-			var decryptedKey []byte
 			var err error
 			if blob.Locals.EncryptedEnv.Data == "{}" {
 				decrypted = []byte(blob.Locals.EncryptedEnv.Data)
 			} else {
-				decryptedKey, err = crypto.Decrypt(
-					blob.Locals.EncryptedKey,
-					blob.Locals.Signer.Pubkey,
-					blob.Locals.DecryptedPrivkey,
-				)
-
-				decrypted, err = crypto.DecryptSymmetric(blob.Locals.EncryptedEnv, decryptedKey)
+				decrypted, err = blob.Locals.decryptEnv()
 			}
 
 			if err == nil {
@@ -566,20 +646,12 @@ func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error)
 			numQueued++
 			go func(inheritsEnvironmentId string, blobFields *KeyableBlobFieldsWithTrustChain) {
 				var decrypted []byte
-				var decryptedKey []byte
 				var err error
 
 				if blobFields.EncryptedEnv.Data == "{}" {
 					decrypted = []byte(blobFields.EncryptedEnv.Data)
 				} else {
-
-					decryptedKey, err = crypto.Decrypt(
-						blobFields.EncryptedKey,
-						blobFields.Signer.Pubkey,
-						blobFields.DecryptedPrivkey,
-					)
-
-					decrypted, err = crypto.DecryptSymmetric(blobFields.EncryptedEnv, decryptedKey)
+					decrypted, err = blobFields.decryptEnv()
 				}
 				var overrides KeyableEnv
 
@@ -616,7 +688,7 @@ func (blob *KeyableBlobWithTrustChains) decrypt() (*DecryptedKeyableBlob, error)
 	return decryptedKeyableBlob, nil
 }
 
-func (response *ResponseWithTrustChains) decrypt() (*DecryptedResponse, error) {
+func (response *ResponseWithTrustChains) decrypt(ctx context.Context) (*DecryptedResponse, error) {
 	decryptedResponse := new(DecryptedResponse)
 	lock := sync.RWMutex{}
 
@@ -627,7 +699,10 @@ func (response *ResponseWithTrustChains) decrypt() (*DecryptedResponse, error) {
 	if response.KeyableBlobWithTrustChains != nil {
 		numQueued++
 		go func() {
+			_, span := tracing.Start(ctx, "parser.decrypt_blob", tracing.String("blob", "env"))
 			decryptedKeyableBlob, err := response.KeyableBlobWithTrustChains.decrypt()
+			span.SetError(err)
+			span.End()
 			lock.Lock()
 			decryptedResponse.DecryptedKeyableBlob = decryptedKeyableBlob
 			lock.Unlock()
@@ -640,7 +715,10 @@ func (response *ResponseWithTrustChains) decrypt() (*DecryptedResponse, error) {
 		for i, block := range response.BlocksWithTrustChain {
 			numQueued++
 			go func(i int, block *KeyableBlobWithTrustChains) {
+				_, span := tracing.Start(ctx, "parser.decrypt_blob", tracing.String("blob", "block"), tracing.Int("block", i))
 				decryptedKeyableBlob, err := block.decrypt()
+				span.SetError(err)
+				span.End()
 
 				if err == nil {
 					lock.Lock()
@@ -670,13 +748,13 @@ func (response *ResponseWithTrustChains) decrypt() (*DecryptedResponse, error) {
 	return decryptedResponse, nil
 }
 
-func (response *ResponseWithTrustChains) verifyAndDecrypt() (*DecryptedResponse, error) {
-	verifyErr := response.verify()
+func (response *ResponseWithTrustChains) verifyAndDecrypt(ctx context.Context) (*DecryptedResponse, error) {
+	verifyErr := response.verify(ctx)
 	if verifyErr != nil {
 		return nil, verifyErr
 	}
 
-	return response.decrypt()
+	return response.decrypt(ctx)
 }
 
 func (response *DecryptedResponse) toMap() (EnvMap, error) {
@@ -829,7 +907,7 @@ func parseTrustedKeys(rawTrusted *crypto.SignedData, signerPubkey *crypto.Pubkey
 	return trustedMap, nil
 }
 
-func parseRootPubkeyReplacements(trustedRoot trust.TrustedKeyablesMap, replacements []*RootPubkeyReplacement, privkey *crypto.Privkey) (trust.TrustedKeyablesMap, *crypto.SignedData, []string, error) {
+func parseRootPubkeyReplacements(trustedRoot trust.TrustedKeyablesMap, replacements []*RootPubkeyReplacement, privkey *crypto.Privkey, cache *VerifyCache) (trust.TrustedKeyablesMap, *crypto.SignedData, []string, error) {
 
 	if len(replacements) == 0 {
 		return trustedRoot, nil, []string{}, nil
@@ -842,7 +920,7 @@ func parseRootPubkeyReplacements(trustedRoot trust.TrustedKeyablesMap, replaceme
 
 	for _, replacement := range replacements {
 
-		trustChain, err := parseTrustedKeys(replacement.SignedReplacingTrustChain, replacement.ReplacingPubkey)
+		trustChain, err := cache.trustedKeys(replacement.SignedReplacingTrustChain, replacement.ReplacingPubkey)
 
 		if err != nil {
 			return nil, nil, []string{}, err
@@ -0,0 +1,131 @@
+package parser_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parsertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWithCache(t *testing.T) {
+	cache := parser.NewVerifyCache(0)
+	ctx := context.Background()
+
+	org := parsertest.NewOrg()
+	admin := parsertest.NewDevice(org.RootDevice())
+	dev := parsertest.NewInvitedDevice(admin)
+
+	b := org.Root().
+		SignedBy(admin).
+		Env(parser.EnvMap{"A": "1"}).
+		Blocks(parsertest.NewBlock().SignedBy(dev).Env(parser.EnvMap{"B": "2"}))
+	response, pw, err := b.Build()
+	assert.Nil(t, err)
+
+	envMap, _, _, _, _, err := response.ParseWithCache(ctx, pw, false, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1", "B": "2"}, envMap)
+
+	hits, _ := cache.Stats()
+	assert.Equal(t, uint64(0), hits)
+
+	// reparsing the same response is all hits
+	_, total := cache.Stats()
+	envMap, _, _, _, _, err = response.ParseWithCache(ctx, pw, false, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1", "B": "2"}, envMap)
+	hits, total2 := cache.Stats()
+	assert.Equal(t, total2-total, hits)
+
+	// changed blobs aren't stale
+	response, _, err = b.Env(parser.EnvMap{"A": "1-changed"}).Build()
+	assert.Nil(t, err)
+	envMap, _, _, _, _, err = response.ParseWithCache(ctx, pw, false, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1-changed", "B": "2"}, envMap)
+
+	// a cached privkey doesn't skip checking the password
+	_, _, _, _, _, err = response.ParseWithCache(ctx, parsertest.RandomString(24), false, cache)
+	assert.NotNil(t, err)
+
+	// a cached trust chain doesn't make an untrusted signer trusted
+	response, _, err = b.Blocks(parsertest.NewBlock().SignedBy(parsertest.NewDevice(nil)).Env(parser.EnvMap{"B": "2"})).Build()
+	assert.Nil(t, err)
+	_, _, _, _, _, err = response.ParseWithCache(ctx, pw, false, cache)
+	assert.NotNil(t, err)
+
+	// nor does one verified against a root that's since been replaced
+	response, _, err = b.Blocks().ReplaceRoot(dev).Build()
+	assert.Nil(t, err)
+	_, _, _, _, _, err = response.ParseWithCache(ctx, pw, false, cache)
+	assert.NotNil(t, err)
+}
+
+func TestVerifyCacheEviction(t *testing.T) {
+	cache := parser.NewVerifyCache(2)
+	ctx := context.Background()
+
+	// responses keep parsing correctly while entries are evicted
+	org := parsertest.NewOrg()
+	for i := 0; i < 5; i++ {
+		val := strconv.Itoa(i)
+		response, pw, err := org.Root().Env(parser.EnvMap{"A": val}).Build()
+		assert.Nil(t, err)
+
+		envMap, _, _, _, _, err := response.ParseWithCache(ctx, pw, false, cache)
+		assert.Nil(t, err)
+		assert.Equal(t, parser.EnvMap{"A": val}, envMap)
+	}
+}
+
+// a response with many blocks, each signed through a chain of invites
+func benchmarkResponse(b *testing.B, numBlocks int) (*parser.FetchResponse, string) {
+	org := parsertest.NewOrg()
+	signer := org.RootDevice()
+	for i := 0; i < 4; i++ {
+		signer = parsertest.NewInvitedDevice(signer)
+	}
+
+	blocks := make([]*parsertest.Block, numBlocks)
+	for i := range blocks {
+		blocks[i] = parsertest.NewBlock().Env(parser.EnvMap{"BLOCK_" + strconv.Itoa(i): "val"})
+	}
+
+	response, pw, err := org.Root().SignedBy(signer).Env(parser.EnvMap{"A": "1"}).Blocks(blocks...).Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return response, pw
+}
+
+func benchmarkParse(b *testing.B, numBlocks int, cache *parser.VerifyCache) {
+	response, pw := benchmarkResponse(b, numBlocks)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, _, _, err := response.ParseWithCache(ctx, pw, false, cache)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	benchmarkParse(b, 1, nil)
+}
+
+func BenchmarkParseWithCache(b *testing.B) {
+	benchmarkParse(b, 1, parser.NewVerifyCache(0))
+}
+
+func BenchmarkParse50Blocks(b *testing.B) {
+	benchmarkParse(b, 50, nil)
+}
+
+func BenchmarkParse50BlocksWithCache(b *testing.B) {
+	benchmarkParse(b, 50, parser.NewVerifyCache(0))
+}
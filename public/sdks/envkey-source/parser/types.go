@@ -68,6 +68,16 @@ type KeyableBlobFieldsWithTrustChain struct {
 	DecryptedPrivkey     *crypto.Privkey
 	TrustedKeyablesChain *trust.TrustedKeyablesChain
 	Signer               *trust.Signer
+
+	rootKey string
+	cache   *VerifyCache
+}
+
+// the trusted root, after any replacements, with its cache key
+type trustedRootWithCache struct {
+	root    trust.TrustedKeyablesMap
+	rootKey string
+	cache   *VerifyCache
 }
 
 type KeyableBlobWithTrustChains struct {
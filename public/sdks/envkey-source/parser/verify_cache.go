@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/trust"
+)
+
+const DEFAULT_VERIFY_CACHE_SIZE = 10000
+
+// VerifyCache memoizes the expensive steps of parsing a response--decrypting
+// and verifying the ENVKEY's privkey, verifying signed trust chains, verifying
+// each signer's trust back to the root, and decrypting blobs--so reparsing a
+// response where most chains and blobs haven't changed only does work for
+// the parts that have. entries are keyed by a hash of everything that
+// determines their result, so changed content is always a miss.
+//
+// it's safe to share between goroutines and between ENVKEYs.
+type VerifyCache struct {
+	mu          sync.Mutex
+	maxEntries  int
+	current     map[string]interface{}
+	previous    map[string]interface{}
+	hits, total uint64
+}
+
+// NewVerifyCache holds up to around 2*maxEntries entries: when maxEntries is
+// reached, the oldest generation of entries that haven't been used since the
+// last time it was reached are dropped
+func NewVerifyCache(maxEntries int) *VerifyCache {
+	if maxEntries < 1 {
+		maxEntries = DEFAULT_VERIFY_CACHE_SIZE
+	}
+	return &VerifyCache{
+		maxEntries: maxEntries,
+		current:    map[string]interface{}{},
+		previous:   map[string]interface{}{},
+	}
+}
+
+// Stats returns the number of lookups that hit and the total number of
+// lookups
+func (cache *VerifyCache) Stats() (hits, total uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.hits, cache.total
+}
+
+func (cache *VerifyCache) get(key string) (interface{}, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.total++
+
+	if val, ok := cache.current[key]; ok {
+		cache.hits++
+		return val, true
+	}
+
+	if val, ok := cache.previous[key]; ok {
+		cache.hits++
+		cache.setLocked(key, val)
+		return val, true
+	}
+
+	return nil, false
+}
+
+func (cache *VerifyCache) set(key string, val interface{}) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.setLocked(key, val)
+}
+
+func (cache *VerifyCache) setLocked(key string, val interface{}) {
+	if len(cache.current) >= cache.maxEntries {
+		cache.previous = cache.current
+		cache.current = map[string]interface{}{}
+	}
+	cache.current[key] = val
+}
+
+// privkey returns the decrypted privkey, decrypting and verifying it against
+// the response's pubkey on a miss
+func (cache *VerifyCache) privkey(response *FetchResponse, encryptionKey string, parse func() (*crypto.Privkey, error)) (*crypto.Privkey, error) {
+	if cache == nil {
+		return parse()
+	}
+
+	key := cacheKey("privkey",
+		response.EncryptedPrivkey.Data,
+		response.EncryptedPrivkey.Nonce,
+		encryptionKey,
+		response.Pubkey.Keys.SigningKey,
+		response.Pubkey.Keys.EncryptionKey,
+	)
+
+	if val, ok := cache.get(key); ok {
+		return val.(*crypto.Privkey), nil
+	}
+
+	privkey, err := parse()
+	if err == nil {
+		cache.set(key, privkey)
+	}
+	return privkey, err
+}
+
+// trustedKeys returns the verified trusted keys map, verifying rawTrusted
+// with signerPubkey on a miss. the returned map must not be modified.
+func (cache *VerifyCache) trustedKeys(rawTrusted *crypto.SignedData, signerPubkey *crypto.Pubkey) (trust.TrustedKeyablesMap, error) {
+	if cache == nil {
+		return parseTrustedKeys(rawTrusted, signerPubkey)
+	}
+
+	key := cacheKey("trusted",
+		rawTrusted.Data,
+		signerPubkey.Keys.SigningKey,
+		signerPubkey.Keys.EncryptionKey,
+	)
+
+	if val, ok := cache.get(key); ok {
+		return val.(trust.TrustedKeyablesMap), nil
+	}
+
+	trusted, err := parseTrustedKeys(rawTrusted, signerPubkey)
+	if err == nil {
+		cache.set(key, trusted)
+	}
+	return trusted, err
+}
+
+// verified calls verify on a miss, caching only success. rootKey
+// identifies the trusted root the signer is verified against.
+func (cache *VerifyCache) verified(blobFields *KeyableBlobFieldsWithTrustChain, rootKey string, verify func() error) error {
+	if cache == nil {
+		return verify()
+	}
+
+	key := cacheKey("verified",
+		rootKey,
+		blobFields.EncryptedByTrustChain.Data,
+		blobFields.Signer.Id,
+		blobFields.Signer.Pubkey.Keys.SigningKey,
+		blobFields.Signer.Pubkey.Keys.EncryptionKey,
+	)
+
+	if _, ok := cache.get(key); ok {
+		return nil
+	}
+
+	err := verify()
+	if err == nil {
+		cache.set(key, true)
+	}
+	return err
+}
+
+// decrypted returns the blob's decrypted json, decrypting it on a miss
+func (cache *VerifyCache) decrypted(blobFields *KeyableBlobFieldsWithTrustChain, decrypt func() ([]byte, error)) ([]byte, error) {
+	if cache == nil {
+		return decrypt()
+	}
+
+	key := cacheKey("decrypted",
+		blobFields.EncryptedEnv.Data,
+		blobFields.EncryptedEnv.Nonce,
+		blobFields.EncryptedKey.Data,
+		blobFields.EncryptedKey.Nonce,
+		blobFields.Signer.Pubkey.Keys.EncryptionKey,
+		blobFields.DecryptedPrivkey.Keys.EncryptionKey,
+	)
+
+	if val, ok := cache.get(key); ok {
+		return val.([]byte), nil
+	}
+
+	decrypted, err := decrypt()
+	if err == nil {
+		cache.set(key, decrypted)
+	}
+	return decrypted, err
+}
+
+// cacheKey hashes length-prefixed parts, so parts can't run together
+func cacheKey(parts ...string) string {
+	h := sha256.New()
+	var length [8]byte
+	for _, part := range parts {
+		binary.BigEndian.PutUint64(length[:], uint64(len(part)))
+		h.Write(length[:])
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
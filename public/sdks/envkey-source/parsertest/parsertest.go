@@ -0,0 +1,512 @@
+// Package parsertest builds correctly encrypted and signed FetchResponses,
+// with the matching ENVKEY password, for testing parser.FetchResponse.Parse
+// and anything that loads an env from a response:
+//
+//	org := parsertest.NewOrg()
+//	admin := parsertest.NewDevice(org.RootDevice())
+//	dev := parsertest.NewInvitedDevice(admin)
+//
+//	response, pw, err := org.Root().
+//		SignedBy(admin).
+//		Env(parser.EnvMap{"A": "1"}).
+//		InheritsFrom("staging-id", parser.EnvMap{"B": "2"}).
+//		SignedBy(dev).
+//		Locals(parser.EnvMap{"A": "local"}).
+//		Blocks(parsertest.NewBlock().Env(parser.EnvMap{"C": "3"})).
+//		Build()
+//
+// each layer is encrypted by, and has a trust chain for, the device passed to
+// the latest SignedBy call, so signers outside the org, or outside the root
+// after a root replacement, fail verification just like they would in a real
+// response.
+package parsertest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/crypto"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/sign"
+)
+
+// Device is a keypair that can sign other devices and encrypt envs. a device
+// with no signer is self-signed, like an org's root device.
+type Device struct {
+	id           string
+	pubkey       *crypto.Pubkey
+	privkey      *crypto.Privkey
+	invitePubkey *crypto.Pubkey
+	signer       *Device
+
+	// raw signing key, for signing pubkeys and trust chains
+	signingPrivkey *[64]byte
+}
+
+// NewDevice generates a device whose pubkey is signed directly by signer, or
+// a self-signed device that no org trusts if signer is nil
+func NewDevice(signer *Device) *Device {
+	d := &Device{id: newId(), signer: signer}
+	d.pubkey, d.privkey, d.signingPrivkey = newKeys(true, signer)
+	return d
+}
+
+// NewInvitedDevice generates a device that was invited by inviter: inviter
+// signs an invite key, which signs the device's pubkey
+func NewInvitedDevice(inviter *Device) *Device {
+	d := &Device{id: newId(), signer: inviter}
+
+	// invite keys only sign
+	var inviteSigningPrivkey *[64]byte
+	d.invitePubkey, _, inviteSigningPrivkey = newKeys(false, inviter)
+
+	d.pubkey, d.privkey, d.signingPrivkey = newKeys(true, &Device{signingPrivkey: inviteSigningPrivkey})
+	return d
+}
+
+func (d *Device) Id() string {
+	return d.id
+}
+
+func (d *Device) Pubkey() *crypto.Pubkey {
+	return d.pubkey
+}
+
+func (d *Device) Privkey() *crypto.Privkey {
+	return d.privkey
+}
+
+// Org has a root device that ENVKEYs trust
+type Org struct {
+	id   string
+	root *Device
+}
+
+func NewOrg() *Org {
+	return &Org{id: newId(), root: NewDevice(nil)}
+}
+
+func (o *Org) Id() string {
+	return o.id
+}
+
+func (o *Org) RootDevice() *Device {
+	return o.root
+}
+
+// Root starts a response for a new ENVKEY that trusts the org's root device
+func (o *Org) Root() *Builder {
+	return &Builder{
+		org:         o,
+		envkey:      NewDevice(o.root),
+		pw:          RandomString(24),
+		trustedRoot: o.root,
+		top:         NewBlock(),
+	}
+}
+
+type layer struct {
+	vals   parser.EnvMap
+	signer *Device
+}
+
+// Block is a set of layers--env, sub env, locals, and inheritance
+// overrides--either at the top level of a response or in its blocks
+type Block struct {
+	signer         *Device
+	env            *layer
+	subEnv         *layer
+	locals         *layer
+	envInherits    map[string]string
+	subEnvInherits map[string]string
+	overrides      map[string]*layer
+}
+
+func NewBlock() *Block {
+	return &Block{
+		envInherits:    map[string]string{},
+		subEnvInherits: map[string]string{},
+		overrides:      map[string]*layer{},
+	}
+}
+
+// SignedBy sets the device that encrypts layers set after it. layers set
+// before any call to SignedBy are encrypted by the response's latest signer.
+func (b *Block) SignedBy(signer *Device) *Block {
+	b.signer = signer
+	return b
+}
+
+// Env sets the env's values, replacing any set by an earlier call. empty
+// values are sent as empty rather than as vals.
+func (b *Block) Env(vals parser.EnvMap) *Block {
+	b.env = &layer{vals: vals, signer: b.signer}
+	return b
+}
+
+// SubEnv sets the sub env's values, which override the env's
+func (b *Block) SubEnv(vals parser.EnvMap) *Block {
+	b.subEnv = &layer{vals: vals, signer: b.signer}
+	return b
+}
+
+// Locals sets local overrides, which override the env's
+func (b *Block) Locals(vals parser.EnvMap) *Block {
+	b.locals = &layer{vals: vals, signer: b.signer}
+	return b
+}
+
+// InheritsFrom makes each key in vals inherit its value in the env from
+// environment envId, with vals sent as envId's inheritance overrides
+func (b *Block) InheritsFrom(envId string, vals parser.EnvMap) *Block {
+	b.inheritFrom(b.envInherits, envId, vals)
+	return b
+}
+
+// SubEnvInheritsFrom is like InheritsFrom for the sub env
+func (b *Block) SubEnvInheritsFrom(envId string, vals parser.EnvMap) *Block {
+	b.inheritFrom(b.subEnvInherits, envId, vals)
+	return b
+}
+
+func (b *Block) inheritFrom(inherits map[string]string, envId string, vals parser.EnvMap) {
+	overrides := b.overrides[envId]
+	if overrides == nil {
+		overrides = &layer{vals: parser.EnvMap{}}
+		b.overrides[envId] = overrides
+	}
+	overrides.signer = b.signer
+
+	for k, v := range vals {
+		inherits[k] = envId
+		overrides.vals[k] = v
+	}
+}
+
+// Builder builds a response for one ENVKEY. Build can be called repeatedly,
+// e.g. after changing the env, and always uses the same ENVKEY keys.
+type Builder struct {
+	org          *Org
+	envkey       *Device
+	pw           string
+	trustedRoot  *Device
+	replacements []*Device
+	top          *Block
+	blocks       []*Block
+	v1           *v1Keys
+}
+
+func (b *Builder) SignedBy(signer *Device) *Builder {
+	b.top.SignedBy(signer)
+	return b
+}
+
+func (b *Builder) Env(vals parser.EnvMap) *Builder {
+	b.top.Env(vals)
+	return b
+}
+
+func (b *Builder) SubEnv(vals parser.EnvMap) *Builder {
+	b.top.SubEnv(vals)
+	return b
+}
+
+func (b *Builder) Locals(vals parser.EnvMap) *Builder {
+	b.top.Locals(vals)
+	return b
+}
+
+func (b *Builder) InheritsFrom(envId string, vals parser.EnvMap) *Builder {
+	b.top.InheritsFrom(envId, vals)
+	return b
+}
+
+func (b *Builder) SubEnvInheritsFrom(envId string, vals parser.EnvMap) *Builder {
+	b.top.SubEnvInheritsFrom(envId, vals)
+	return b
+}
+
+// Blocks sets the response's blocks, replacing any set by an earlier call
+func (b *Builder) Blocks(blocks ...*Block) *Builder {
+	b.blocks = blocks
+	return b
+}
+
+// ReplaceRoot adds a root pubkey replacement from the current trusted root
+// to newRoot, which should be signed by a device the current root trusts
+func (b *Builder) ReplaceRoot(newRoot *Device) *Builder {
+	b.replacements = append(b.replacements, newRoot)
+	return b
+}
+
+// V1Upgraded wraps the response in a v1 payload, like the response for a v1
+// ENVKEY that's been upgraded to v2. Build then returns the v1 password.
+func (b *Builder) V1Upgraded() *Builder {
+	if b.v1 == nil {
+		b.v1 = &v1Keys{pw: RandomString(24)}
+	}
+	return b
+}
+
+// Build encrypts and signs the response, returning it with the ENVKEY
+// password that decrypts it
+func (b *Builder) Build() (*parser.FetchResponse, string, error) {
+	privkeyJson, err := json.Marshal(b.envkey.privkey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the ENVKEY's trusted root is signed by the ENVKEY's own key
+	signedTrustedRoot, err := signTrusted(map[string][]interface{}{
+		b.trustedRoot.id: {"root", b.trustedRoot.pubkey},
+	}, b.envkey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	response := &parser.FetchResponse{
+		OrgId:             b.org.id,
+		EncryptedPrivkey:  crypto.EncryptSymmetric(privkeyJson, []byte(b.pw)),
+		Pubkey:            b.envkey.pubkey,
+		SignedTrustedRoot: signedTrustedRoot,
+	}
+
+	// each replacement's trust chain leads back to the root it replaces
+	root := b.trustedRoot
+	for _, newRoot := range b.replacements {
+		signedTrustChain, err := signTrusted(trustChain(newRoot, root), newRoot)
+		if err != nil {
+			return nil, "", err
+		}
+
+		response.RootPubkeyReplacements = append(response.RootPubkeyReplacements, &parser.RootPubkeyReplacement{
+			Id:                        newId(),
+			ReplacingPubkeyId:         newRoot.id,
+			ReplacingPubkey:           newRoot.pubkey,
+			SignedReplacingTrustChain: signedTrustChain,
+		})
+		root = newRoot
+	}
+
+	// unsigned layers default to the builder's latest signer
+	defaultSigner := b.top.signer
+	if defaultSigner == nil {
+		defaultSigner = b.trustedRoot
+	}
+
+	response.KeyableBlob, err = b.top.build(b.envkey, root, defaultSigner)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, block := range b.blocks {
+		keyableBlob, err := block.build(b.envkey, root, defaultSigner)
+		if err != nil {
+			return nil, "", err
+		}
+		response.Blocks = append(response.Blocks, keyableBlob)
+	}
+
+	if b.v1 == nil {
+		return response, b.pw, nil
+	}
+
+	response.V1Payload, err = b.v1.payload(b.pw)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return response, b.v1.pw, nil
+}
+
+func (b *Block) build(envkey, root, defaultSigner *Device) (*parser.KeyableBlob, error) {
+	signerFor := func(l *layer) *Device {
+		if l.signer != nil {
+			return l.signer
+		}
+		return defaultSigner
+	}
+
+	encrypt := func(l *layer, inherits map[string]string) (*parser.KeyableBlobFields, error) {
+		keyableEnv := parser.KeyableEnv{}
+		if l != nil {
+			for k, v := range l.vals {
+				if v == "" {
+					keyableEnv[k] = &parser.KeyableEnvVal{IsEmpty: true}
+				} else {
+					keyableEnv[k] = &parser.KeyableEnvVal{Val: v}
+				}
+			}
+		}
+		for k, envId := range inherits {
+			keyableEnv[k] = &parser.KeyableEnvVal{InheritsEnvironmentId: envId}
+		}
+
+		// a layer that only inherits is encrypted by the block's latest
+		// signer
+		signer := signerFor(&layer{signer: b.signer})
+		if l != nil {
+			signer = signerFor(l)
+		}
+
+		return encryptKeyableEnv(keyableEnv, envkey, signer, root)
+	}
+
+	var err error
+	blob := &parser.KeyableBlob{}
+
+	if b.env != nil || len(b.envInherits) > 0 {
+		blob.Env, err = encrypt(b.env, b.envInherits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.subEnv != nil || len(b.subEnvInherits) > 0 {
+		blob.SubEnv, err = encrypt(b.subEnv, b.subEnvInherits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.locals != nil {
+		blob.Locals, err = encrypt(b.locals, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(b.overrides) > 0 {
+		blob.InheritanceOverrides = parser.InheritanceOverridesBlobs{}
+		for envId, overrides := range b.overrides {
+			blobFields, err := encrypt(overrides, nil)
+			if err != nil {
+				return nil, err
+			}
+			blob.InheritanceOverrides[envId] = *blobFields
+		}
+	}
+
+	return blob, nil
+}
+
+func encryptKeyableEnv(keyableEnv parser.KeyableEnv, envkey, signer, root *Device) (*parser.KeyableBlobFields, error) {
+	envJson, err := json.Marshal(keyableEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey := RandomString(32)
+	encryptedKey, err := crypto.Encrypt([]byte(symmetricKey), envkey.pubkey, signer.privkey)
+	if err != nil {
+		return nil, err
+	}
+
+	signedTrustChain, err := signTrusted(trustChain(signer, root), signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser.KeyableBlobFields{
+		EncryptedEnv:          crypto.EncryptSymmetric(envJson, []byte(symmetricKey)),
+		EncryptedKey:          encryptedKey,
+		EncryptedByPubkeyId:   signer.id,
+		EncryptedByPubkey:     signer.pubkey,
+		EncryptedByTrustChain: signedTrustChain,
+	}, nil
+}
+
+// trustChain has an entry for d and each device that signed it, up to root
+// or a self-signed device
+func trustChain(d, root *Device) map[string][]interface{} {
+	trusted := map[string][]interface{}{}
+	for ; d != nil && d != root && d.signer != nil; d = d.signer {
+		// [type, pubkey, (invitePubkey,) signerId]
+		if d.invitePubkey == nil {
+			trusted[d.id] = []interface{}{"orgUserDevice", d.pubkey, d.signer.id}
+		} else {
+			trusted[d.id] = []interface{}{"orgUserDevice", d.pubkey, d.invitePubkey, d.signer.id}
+		}
+	}
+	return trusted
+}
+
+func signTrusted(trusted map[string][]interface{}, signer *Device) (*crypto.SignedData, error) {
+	trustedJson, err := json.Marshal(trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto.SignedData{
+		Data: base64.StdEncoding.EncodeToString(sign.Sign([]byte{}, trustedJson, signer.signingPrivkey)),
+	}, nil
+}
+
+// newKeys generates a pubkey signed by signer, or self-signed if signer is
+// nil, and its privkey
+func newKeys(withEncryption bool, signer *Device) (*crypto.Pubkey, *crypto.Privkey, *[64]byte) {
+	signingPubkey, signingPrivkey, err := sign.GenerateKey(rand.Reader)
+	must(err)
+
+	keys := crypto.EncryptionAndSigningKeys{
+		SigningKey: base64.StdEncoding.EncodeToString(signingPubkey[:]),
+	}
+	privkey := &crypto.Privkey{
+		Keys: crypto.EncryptionAndSigningKeys{
+			SigningKey: base64.StdEncoding.EncodeToString(signingPrivkey[:]),
+		},
+	}
+
+	if withEncryption {
+		encPubkey, encPrivkey, err := box.GenerateKey(rand.Reader)
+		must(err)
+		keys.EncryptionKey = base64.StdEncoding.EncodeToString(encPubkey[:])
+		privkey.Keys.EncryptionKey = base64.StdEncoding.EncodeToString(encPrivkey[:])
+	}
+
+	signedBy := signingPrivkey
+	if signer != nil {
+		signedBy = signer.signingPrivkey
+	}
+
+	keysJson, err := json.Marshal(keys)
+	must(err)
+	sig := ed25519.Sign(signedBy[:], keysJson)
+
+	return &crypto.Pubkey{
+		Keys:      keys,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, privkey, signingPrivkey
+}
+
+func newId() string {
+	return uuid.New().String()
+}
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// RandomString generates an alphanumeric string, like an ENVKEY's id part or
+// password, which are split on '-'
+func RandomString(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphanumeric)))
+	for i := range b {
+		j, err := rand.Int(rand.Reader, max)
+		must(err)
+		b[i] = alphanumeric[j.Int64()]
+	}
+	return string(b)
+}
+
+// a fixture can't be built without randomness, so there's no sensible error
+// to return
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
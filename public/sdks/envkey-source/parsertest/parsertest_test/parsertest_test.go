@@ -0,0 +1,137 @@
+package parsertest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parsertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, b *parsertest.Builder) (parser.EnvMap, error) {
+	response, pw, err := b.Build()
+	assert.Nil(t, err)
+	envMap, _, _, _, err := response.ParseWithV1Upgrade(context.Background(), pw, nil)
+	return envMap, err
+}
+
+func TestBuild(t *testing.T) {
+	org := parsertest.NewOrg()
+	admin := parsertest.NewDevice(org.RootDevice())
+	dev := parsertest.NewInvitedDevice(admin)
+
+	// basic env, signed by the root
+	envMap, err := parse(t, org.Root().Env(parser.EnvMap{"A": "1", "B": ""}))
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1", "B": ""}, envMap)
+
+	// inheritance, sub env, and locals, signed through a chain with an invite
+	envMap, err = parse(t, org.Root().
+		SignedBy(admin).
+		Env(parser.EnvMap{"A": "1"}).
+		InheritsFrom("staging", parser.EnvMap{"B": "2-inherits"}).
+		SignedBy(dev).
+		SubEnv(parser.EnvMap{"C": "3-sub"}).
+		SubEnvInheritsFrom("staging", parser.EnvMap{"D": "4-inherits"}).
+		Locals(parser.EnvMap{"A": "1-locals"}))
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1-locals", "B": "2-inherits", "C": "3-sub", "D": "4-inherits"}, envMap)
+
+	// blocks are overridden by the top level env
+	envMap, err = parse(t, org.Root().
+		SignedBy(admin).
+		Env(parser.EnvMap{"A": "1"}).
+		Blocks(
+			parsertest.NewBlock().Env(parser.EnvMap{"A": "1-block", "B": "2-block"}),
+			parsertest.NewBlock().SignedBy(dev).Env(parser.EnvMap{"C": "3-block"}).Locals(parser.EnvMap{"A": "1-block-locals"}),
+		))
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1-block-locals", "B": "2-block", "C": "3-block"}, envMap)
+
+	// Build can be called again after changing the env
+	b := org.Root().Env(parser.EnvMap{"A": "1"})
+	_, pw, err := b.Build()
+	assert.Nil(t, err)
+	response, pw2, err := b.Env(parser.EnvMap{"A": "2"}).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, pw, pw2)
+	envMap, _, _, _, _, err = response.Parse(pw, false)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "2"}, envMap)
+}
+
+func TestBuildUntrusted(t *testing.T) {
+	org := parsertest.NewOrg()
+	otherOrg := parsertest.NewOrg()
+
+	// signed by another org's device
+	_, err := parse(t, org.Root().SignedBy(parsertest.NewDevice(otherOrg.RootDevice())).Env(parser.EnvMap{"A": "1"}))
+	assert.NotNil(t, err)
+
+	// signed by a self-signed device
+	_, err = parse(t, org.Root().SignedBy(parsertest.NewDevice(nil)).Env(parser.EnvMap{"A": "1"}))
+	assert.NotNil(t, err)
+
+	// trusted env with an untrusted block
+	_, err = parse(t, org.Root().
+		Env(parser.EnvMap{"A": "1"}).
+		Blocks(parsertest.NewBlock().SignedBy(parsertest.NewDevice(nil)).Env(parser.EnvMap{"B": "2"})))
+	assert.NotNil(t, err)
+
+	// wrong password
+	response, _, err := org.Root().Env(parser.EnvMap{"A": "1"}).Build()
+	assert.Nil(t, err)
+	_, _, _, _, _, err = response.Parse(parsertest.RandomString(24), false)
+	assert.NotNil(t, err)
+}
+
+func TestBuildRootReplacements(t *testing.T) {
+	org := parsertest.NewOrg()
+	admin := parsertest.NewDevice(org.RootDevice())
+	admin2 := parsertest.NewInvitedDevice(admin)
+
+	response, pw, err := org.Root().
+		SignedBy(admin2).
+		Env(parser.EnvMap{"A": "1"}).
+		ReplaceRoot(admin).
+		ReplaceRoot(admin2).
+		Build()
+	assert.Nil(t, err)
+
+	envMap, _, newSignedTrustedRoot, replacementIds, _, err := response.Parse(pw, false)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1"}, envMap)
+	assert.NotNil(t, newSignedTrustedRoot)
+	assert.Equal(t, 2, len(replacementIds))
+
+	// the replaced root is no longer trusted
+	_, err = parse(t, org.Root().Env(parser.EnvMap{"A": "1"}).ReplaceRoot(admin))
+	assert.NotNil(t, err)
+
+	// a replacement the current root doesn't trust
+	_, err = parse(t, org.Root().SignedBy(admin).Env(parser.EnvMap{"A": "1"}).ReplaceRoot(parsertest.NewDevice(nil)))
+	assert.NotNil(t, err)
+}
+
+func TestBuildV1Upgraded(t *testing.T) {
+	org := parsertest.NewOrg()
+
+	b := org.Root().Env(parser.EnvMap{"A": "1"}).V1Upgraded()
+	response, pw, err := b.Build()
+	assert.Nil(t, err)
+	assert.NotNil(t, response.V1Payload)
+
+	envMap, _, _, _, err := response.ParseWithV1Upgrade(context.Background(), pw, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"A": "1"}, envMap)
+
+	// the v1 password is checked
+	_, _, _, _, err = response.ParseWithV1Upgrade(context.Background(), parsertest.RandomString(24), nil)
+	assert.NotNil(t, err)
+
+	// the v1 keys are kept across builds
+	_, pw2, err := b.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, pw, pw2)
+}
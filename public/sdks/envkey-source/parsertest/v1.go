@@ -0,0 +1,336 @@
+package parsertest
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/trust"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// v1 keys are openpgp keys: the ENVKEY's, encrypted with the v1 password, and
+// the device that encrypted the v2 password for it
+type v1Keys struct {
+	pw       string
+	envkey   *openpgp.Entity
+	signerId string
+	signer   *openpgp.Entity
+}
+
+// small keys keep fixtures fast--they're never used outside tests. the
+// preferred hash and cipher are set since openpgp's defaults for keys with
+// no preferences aren't compiled in.
+var v1Config = &packet.Config{
+	RSABits:       1024,
+	DefaultHash:   stdcrypto.SHA256,
+	DefaultCipher: packet.CipherAES128,
+}
+
+// payload is a v1 response whose env is {"KEY": v2pw}, which
+// ParseWithV1Upgrade uses to parse the v2 response
+func (keys *v1Keys) payload(v2pw string) (*parser.V1EnvServiceResponse, error) {
+	var err error
+
+	if keys.envkey == nil {
+		keys.envkey, err = newV1Entity("envkey")
+		if err != nil {
+			return nil, err
+		}
+
+		keys.signer, err = newV1Entity("signer")
+		if err != nil {
+			return nil, err
+		}
+		keys.signerId = newId()
+	}
+
+	encryptedPrivkey, err := v1ArmoredEncryptedPrivkey(keys.envkey, keys.pw)
+	if err != nil {
+		return nil, err
+	}
+
+	pubkeyArmored, err := v1ArmoredPubkey(keys.envkey)
+	if err != nil {
+		return nil, err
+	}
+
+	signerPubkeyArmored, err := v1ArmoredPubkey(keys.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signer is trusted directly by the ENVKEY, so the signer's own
+	// trusted keys aren't needed
+	signedTrustedPubkeys, err := v1ClearsignJson(trust.V1TrustedKeyablesMap{
+		keys.signerId: {PubkeyArmored: signerPubkeyArmored},
+	}, keys.envkey)
+	if err != nil {
+		return nil, err
+	}
+
+	signedBySignedTrustedPubkeys, err := v1ClearsignJson(trust.V1TrustedKeyablesMap{}, keys.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedV2Key, err := v1EncryptJson(parser.EnvMap{"KEY": v2pw}, keys.envkey, keys.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser.V1EnvServiceResponse{
+		EncryptedV2Key:         encryptedV2Key,
+		EncryptedPrivkey:       encryptedPrivkey,
+		PubkeyArmored:          pubkeyArmored,
+		SignedTrustedPubkeys:   signedTrustedPubkeys,
+		SignedById:             keys.signerId,
+		SignedByPubkeyArmored:  signerPubkeyArmored,
+		SignedByTrustedPubkeys: signedBySignedTrustedPubkeys,
+	}, nil
+}
+
+func newV1Entity(name string) (*openpgp.Entity, error) {
+	entity, err := openpgp.NewEntity(name, "", "", v1Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// NewEntity sets the preferred hash and cipher after signing the
+	// identity, so they're only serialized after re-signing it
+	for _, ident := range entity.Identities {
+		err = ident.SelfSignature.SignUserId(ident.UserId.Id, entity.PrimaryKey, entity.PrivateKey, v1Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entity, nil
+}
+
+func v1ArmoredPubkey(entity *openpgp.Entity) (string, error) {
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+
+	err = entity.Serialize(w)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.Close()
+	return buf.String(), err
+}
+
+func v1ClearsignJson(obj interface{}, signer *openpgp.Entity) (string, error) {
+	objJson, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := clearsign.Encode(buf, signer.PrivateKey, v1Config)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = w.Write(objJson)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.Close()
+	return buf.String(), err
+}
+
+func v1EncryptJson(obj interface{}, to, signer *openpgp.Entity) (string, error) {
+	objJson, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	armorWriter, err := armor.Encode(buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := openpgp.Encrypt(armorWriter, []*openpgp.Entity{to}, signer, nil, v1Config)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = w.Write(objJson)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = armorWriter.Close()
+	return buf.String(), err
+}
+
+// openpgp can't serialize encrypted private keys (Entity.SerializePrivate
+// only writes them unencrypted), so this writes the same packets with each
+// secret key encrypted under pw, the way v1 ENVKEY privkeys were
+func v1ArmoredEncryptedPrivkey(entity *openpgp.Entity, pw string) (string, error) {
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+
+	err = v1SerializeEncryptedPrivkey(w, entity.PrivateKey, pw)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ident := range entity.Identities {
+		err = ident.UserId.Serialize(w)
+		if err != nil {
+			return "", err
+		}
+		err = ident.SelfSignature.Serialize(w)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		err = v1SerializeEncryptedPrivkey(w, subkey.PrivateKey, pw)
+		if err != nil {
+			return "", err
+		}
+		err = subkey.Sig.Serialize(w)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = w.Close()
+	return buf.String(), err
+}
+
+const (
+	packetTypePrivateKey    = 5
+	packetTypePrivateSubkey = 7
+)
+
+// v1SerializeEncryptedPrivkey writes an RSA secret key packet (RFC 4880,
+// section 5.5.3) encrypted with AES-128, an iterated and salted SHA-256 s2k,
+// and a SHA-1 checksum
+func v1SerializeEncryptedPrivkey(w io.Writer, privkey *packet.PrivateKey, pw string) error {
+	// the public key packet's body, without its header
+	pubBuf := new(bytes.Buffer)
+	err := privkey.PublicKey.Serialize(pubBuf)
+	if err != nil {
+		return err
+	}
+	pubBody, err := packetBody(pubBuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	body := bytes.NewBuffer(pubBody)
+	// s2k usage 254: encrypted, with a SHA-1 checksum
+	body.Write([]byte{254, byte(packet.CipherAES128)})
+
+	key := make([]byte, 16)
+	err = s2k.Serialize(body, key, rand.Reader, []byte(pw), &s2k.Config{Hash: stdcrypto.SHA256})
+	if err != nil {
+		return err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	_, err = io.ReadFull(rand.Reader, iv)
+	if err != nil {
+		return err
+	}
+	body.Write(iv)
+
+	// same order as packet.PrivateKey.Serialize
+	rsaPrivkey, ok := privkey.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("v1 keys must be RSA")
+	}
+	secret := new(bytes.Buffer)
+	for _, n := range []*big.Int{rsaPrivkey.D, rsaPrivkey.Primes[1], rsaPrivkey.Primes[0], rsaPrivkey.Precomputed.Qinv} {
+		writeMPI(secret, n)
+	}
+	checksum := sha1.Sum(secret.Bytes())
+	secret.Write(checksum[:])
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	encrypted := make([]byte, secret.Len())
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, secret.Bytes())
+	body.Write(encrypted)
+
+	packetType := byte(packetTypePrivateKey)
+	if privkey.IsSubkey {
+		packetType = packetTypePrivateSubkey
+	}
+
+	_, err = w.Write(packetHeader(packetType, body.Len()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+// packetHeader is a new format packet header (RFC 4880, section 4.2.2)
+func packetHeader(packetType byte, length int) []byte {
+	header := []byte{0xc0 | packetType}
+	switch {
+	case length < 192:
+		return append(header, byte(length))
+	case length < 8384:
+		length -= 192
+		return append(header, 192+byte(length>>8), byte(length))
+	default:
+		return append(header, 255, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+}
+
+// packetBody strips the header that packet.PublicKey.Serialize writes
+func packetBody(p []byte) ([]byte, error) {
+	if len(p) < 2 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch {
+	case p[1] < 192:
+		return p[2:], nil
+	case p[1] < 224:
+		return p[3:], nil
+	default:
+		return p[6:], nil
+	}
+}
+
+func writeMPI(w *bytes.Buffer, n *big.Int) {
+	bitLength := n.BitLen()
+	w.Write([]byte{byte(bitLength >> 8), byte(bitLength)})
+	w.Write(n.Bytes())
+}
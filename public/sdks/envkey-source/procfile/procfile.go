@@ -0,0 +1,73 @@
+package procfile
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parses Procfiles in the format used by heroku/foreman:
+//   web: ./start-server
+//   worker: ./start-worker --concurrency 5
+// blank lines and lines starting with # are ignored
+
+type Entry struct {
+	Name    string
+	Command string
+}
+
+var lineRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := lineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.New("invalid Procfile entry on line " + strconv.Itoa(lineNum) + ": " + line)
+		}
+
+		name, command := match[1], strings.TrimSpace(match[2])
+
+		if seen[name] {
+			return nil, errors.New("duplicate Procfile process name: " + name)
+		}
+		seen[name] = true
+
+		entries = append(entries, Entry{Name: name, Command: command})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("Procfile has no processes")
+	}
+
+	return entries, nil
+}
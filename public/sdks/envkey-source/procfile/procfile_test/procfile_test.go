@@ -0,0 +1,39 @@
+package procfile_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/procfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := procfile.Parse(strings.NewReader(`
+# comment
+web: ./start-server --port 3000
+worker:./start-worker
+
+scheduler:   echo '$SOME_VAR'
+`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []procfile.Entry{
+		{Name: "web", Command: "./start-server --port 3000"},
+		{Name: "worker", Command: "./start-worker"},
+		{Name: "scheduler", Command: "echo '$SOME_VAR'"},
+	}, entries)
+}
+
+func TestParseErrors(t *testing.T) {
+	var err error
+
+	_, err = procfile.Parse(strings.NewReader("web: ./start-server\nweb: ./start-other"))
+	assert.EqualError(t, err, "duplicate Procfile process name: web")
+
+	_, err = procfile.Parse(strings.NewReader("web ./start-server"))
+	assert.EqualError(t, err, "invalid Procfile entry on line 1: web ./start-server")
+
+	_, err = procfile.Parse(strings.NewReader("# only a comment\n"))
+	assert.EqualError(t, err, "Procfile has no processes")
+}
@@ -0,0 +1,58 @@
+package procfile_test
+
+import (
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/procfile"
+	"github.com/stretchr/testify/assert"
+)
+
+var watchEntries = []procfile.Entry{
+	{Name: "web", Command: "./start-server"},
+	{Name: "worker", Command: "./start-worker"},
+}
+
+func TestParseWatchVars(t *testing.T) {
+	only, err := procfile.ParseWatchVars([]string{"LOG_LEVEL", " web:DATABASE_URL", "worker: QUEUE_URL", "web:PORT"}, watchEntries)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"LOG_LEVEL"}, only.Global)
+	assert.Equal(t, map[string][]string{
+		"web":    {"DATABASE_URL", "PORT"},
+		"worker": {"QUEUE_URL"},
+	}, only.ByProcess)
+
+	_, err = procfile.ParseWatchVars([]string{"scheduler:CRON"}, watchEntries)
+	assert.EqualError(t, err, "--only references unknown Procfile process: scheduler")
+}
+
+func TestShouldRestart(t *testing.T) {
+	previous := parser.EnvMap{"DATABASE_URL": "db1", "QUEUE_URL": "q1", "LOG_LEVEL": "info"}
+	changed := func(k, v string) parser.EnvMap {
+		res := parser.EnvMap{}
+		for pk, pv := range previous {
+			res[pk] = pv
+		}
+		res[k] = v
+		return res
+	}
+
+	// without --only, any change restarts every process
+	only, _ := procfile.ParseWatchVars(nil, watchEntries)
+	assert.True(t, only.ShouldRestart("web", changed("OTHER", "1"), previous))
+	assert.True(t, only.ShouldRestart("worker", changed("OTHER", "1"), previous))
+
+	// a process with no vars of its own doesn't restart for another
+	// process's vars
+	only, _ = procfile.ParseWatchVars([]string{"web:DATABASE_URL"}, watchEntries)
+	assert.True(t, only.ShouldRestart("web", changed("DATABASE_URL", "db2"), previous))
+	assert.False(t, only.ShouldRestart("worker", changed("DATABASE_URL", "db2"), previous))
+	assert.False(t, only.ShouldRestart("web", changed("QUEUE_URL", "q2"), previous))
+	assert.False(t, only.ShouldRestart("worker", changed("QUEUE_URL", "q2"), previous))
+
+	// global vars restart every process
+	only, _ = procfile.ParseWatchVars([]string{"LOG_LEVEL", "web:DATABASE_URL"}, watchEntries)
+	assert.True(t, only.ShouldRestart("web", changed("LOG_LEVEL", "debug"), previous))
+	assert.True(t, only.ShouldRestart("worker", changed("LOG_LEVEL", "debug"), previous))
+	assert.False(t, only.ShouldRestart("worker", changed("DATABASE_URL", "db2"), previous))
+}
@@ -0,0 +1,64 @@
+package procfile
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// WatchVars is an --only list for a Procfile: vars that restart every
+// process, and vars prefixed with a process name (web:DATABASE_URL) that
+// restart only that process
+type WatchVars struct {
+	Global    []string
+	ByProcess map[string][]string
+}
+
+func ParseWatchVars(vars []string, entries []Entry) (WatchVars, error) {
+	res := WatchVars{ByProcess: map[string][]string{}}
+
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name] = true
+	}
+
+	for _, v := range vars {
+		trimmed := strings.TrimSpace(v)
+		split := strings.SplitN(trimmed, ":", 2)
+
+		if len(split) == 1 {
+			res.Global = append(res.Global, trimmed)
+			continue
+		}
+
+		name, k := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+		if !names[name] {
+			return WatchVars{}, errors.New("--only references unknown Procfile process: " + name)
+		}
+
+		res.ByProcess[name] = append(res.ByProcess[name], k)
+	}
+
+	return res, nil
+}
+
+// ShouldRestart returns whether the named process restarts after an update.
+// with no vars, every change restarts every process. otherwise a process
+// only restarts when a global var or one of its own vars changed, so a
+// process with no vars of its own ignores changes to other processes' vars.
+func (w WatchVars) ShouldRestart(name string, updatedEnv parser.EnvMap, previousEnv parser.EnvMap) bool {
+	if len(w.Global) == 0 && len(w.ByProcess) == 0 {
+		return true
+	}
+
+	for _, vars := range [][]string{w.Global, w.ByProcess[name]} {
+		for _, k := range vars {
+			if updatedEnv[k] != previousEnv[k] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
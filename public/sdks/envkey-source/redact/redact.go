@@ -0,0 +1,183 @@
+package redact
+
+import (
+	"encoding/base64"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// masks secret values in command output, replacing each value (and its
+// base64 and url-encoded forms) with ***KEY_NAME***
+
+const DEFAULT_MIN_LENGTH = 8
+
+type Redactor struct {
+	minLength int
+
+	mu       sync.RWMutex
+	replacer *strings.Replacer
+	patterns []string
+}
+
+func New(minLength int) *Redactor {
+	return &Redactor{minLength: minLength}
+}
+
+// Update replaces the values being redacted with the values in env
+func (r *Redactor) Update(env parser.EnvMap) {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// if the same value appears under several names, the first name wins
+	replacements := map[string]string{}
+	for _, k := range keys {
+		v := env[k]
+		if len(v) < r.minLength {
+			continue
+		}
+
+		for _, pattern := range encodings(v) {
+			if _, exists := replacements[pattern]; !exists {
+				replacements[pattern] = "***" + k + "***"
+			}
+		}
+	}
+
+	patterns := make([]string, 0, len(replacements))
+	for pattern := range replacements {
+		patterns = append(patterns, pattern)
+	}
+
+	// longest first, so a value containing another value is fully masked
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	oldnew := make([]string, 0, len(patterns)*2)
+	for _, pattern := range patterns {
+		oldnew = append(oldnew, pattern, replacements[pattern])
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.patterns = patterns
+	if len(oldnew) > 0 {
+		r.replacer = strings.NewReplacer(oldnew...)
+	} else {
+		r.replacer = nil
+	}
+}
+
+func (r *Redactor) Redact(s string) string {
+	replacer, _ := r.get()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+func (r *Redactor) get() (*strings.Replacer, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replacer, r.patterns
+}
+
+func encodings(v string) []string {
+	res := []string{v}
+
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString([]byte(v)),
+		base64.RawStdEncoding.EncodeToString([]byte(v)),
+		base64.URLEncoding.EncodeToString([]byte(v)),
+		base64.RawURLEncoding.EncodeToString([]byte(v)),
+		url.QueryEscape(v),
+		url.PathEscape(v),
+	} {
+		if encoded != v {
+			res = append(res, encoded)
+		}
+	}
+
+	return res
+}
+
+// Writer redacts output in a streaming fashion. Output that could be the
+// start of a secret is held back until the next write shows whether it is,
+// so Flush must be called once the stream ends.
+type Writer struct {
+	redactor *Redactor
+	w        io.Writer
+
+	mu  sync.Mutex
+	buf string
+}
+
+func (r *Redactor) NewWriter(w io.Writer) *Writer {
+	return &Writer{redactor: r, w: w}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	replacer, patterns := w.redactor.get()
+
+	s := w.buf + string(p)
+	if replacer != nil {
+		s = replacer.Replace(s)
+	}
+
+	hold := partialMatchLen(s, patterns)
+	w.buf = s[len(s)-hold:]
+
+	_, err := io.WriteString(w.w, s[:len(s)-hold])
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf == "" {
+		return nil
+	}
+
+	// a held back partial match can't be completed now
+	_, err := io.WriteString(w.w, w.buf)
+	w.buf = ""
+	return err
+}
+
+// partialMatchLen returns the length of the longest suffix of s that is a
+// prefix of one of the patterns
+func partialMatchLen(s string, patterns []string) int {
+	res := 0
+	for _, pattern := range patterns {
+		max := len(pattern) - 1
+		if max > len(s) {
+			max = len(s)
+		}
+		for n := max; n > res; n-- {
+			if strings.HasPrefix(pattern, s[len(s)-n:]) {
+				res = n
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package redact_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+var env = parser.EnvMap{
+	"DB_PASSWORD": "hunter2hunter2",
+	"API_KEY":     "key/with+chars=",
+	"PORT":        "3000",
+}
+
+func TestRedact(t *testing.T) {
+	r := redact.New(redact.DEFAULT_MIN_LENGTH)
+	r.Update(env)
+
+	assert.Equal(t, "pw=***DB_PASSWORD*** port=3000", r.Redact("pw=hunter2hunter2 port=3000"))
+	assert.Equal(t, "***DB_PASSWORD***", r.Redact(base64.StdEncoding.EncodeToString([]byte("hunter2hunter2"))))
+	assert.Equal(t, "?k=***API_KEY***", r.Redact("?k="+url.QueryEscape("key/with+chars=")))
+
+	// values update on reload
+	r.Update(parser.EnvMap{"DB_PASSWORD": "rotated-password"})
+	assert.Equal(t, "hunter2hunter2 ***DB_PASSWORD***", r.Redact("hunter2hunter2 rotated-password"))
+}
+
+func TestWriter(t *testing.T) {
+	r := redact.New(redact.DEFAULT_MIN_LENGTH)
+	r.Update(env)
+
+	var out bytes.Buffer
+	w := r.NewWriter(&out)
+
+	// secret split across writes
+	w.Write([]byte("connecting with hunter2"))
+	assert.Equal(t, "connecting with ", out.String())
+
+	w.Write([]byte("hunter2 ok\nhunt"))
+	assert.Equal(t, "connecting with ***DB_PASSWORD*** ok\n", out.String())
+
+	// partial match that never completes is written on flush
+	w.Flush()
+	assert.Equal(t, "connecting with ***DB_PASSWORD*** ok\nhunt", out.String())
+}
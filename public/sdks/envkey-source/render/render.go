@@ -0,0 +1,119 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// renders go text/template config files with an ENVKEY's env as data:
+//
+//   listen {{ .PORT | default "8080" }};
+//   password {{ required "DB_PASSWORD" | json }};
+//   {{ fileMode "0640" }}
+
+type Result struct {
+	Output []byte
+
+	// set by fileMode in the template--zero if the template didn't set one
+	Mode os.FileMode
+}
+
+func RenderFile(path string, env parser.EnvMap) (Result, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Render(filepath.Base(path), string(text), env)
+}
+
+func Render(name string, text string, env parser.EnvMap) (Result, error) {
+	var res Result
+
+	tmpl, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(funcs(env, &res)).
+		Parse(text)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, env)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res.Output = buf.Bytes()
+	return res, nil
+}
+
+func funcs(env parser.EnvMap, res *Result) template.FuncMap {
+	return template.FuncMap{
+		"env": func(k string) string {
+			return env[k]
+		},
+
+		"required": func(k string) (string, error) {
+			v := env[k]
+			if v == "" {
+				return "", errors.New("required var " + k + " is missing or empty")
+			}
+			return v, nil
+		},
+
+		"default": func(fallback string, v string) string {
+			if v == "" {
+				return fallback
+			}
+			return v
+		},
+
+		"b64enc": func(v string) string {
+			return base64.StdEncoding.EncodeToString([]byte(v))
+		},
+
+		"b64dec": func(v string) (string, error) {
+			res, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return "", err
+			}
+			return string(res), nil
+		},
+
+		"json": func(v interface{}) (string, error) {
+			res, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(res), nil
+		},
+
+		"fileMode": func(mode string) (string, error) {
+			parsed, err := ParseMode(mode)
+			if err != nil {
+				return "", err
+			}
+			res.Mode = parsed
+			return "", nil
+		},
+	}
+}
+
+// ParseMode parses an octal permission string like "0640"
+func ParseMode(mode string) (os.FileMode, error) {
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || parsed > 0777 {
+		return 0, errors.New("invalid file mode: " + mode + " (must be octal permissions, e.g. 0640)")
+	}
+	return os.FileMode(parsed), nil
+}
@@ -0,0 +1,43 @@
+package render_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/render"
+	"github.com/stretchr/testify/assert"
+)
+
+var env = parser.EnvMap{
+	"HOST":     "localhost",
+	"PASSWORD": `pa"ss`,
+	"CERT":     "aGVsbG8=",
+}
+
+func TestRender(t *testing.T) {
+	res, err := render.Render("test", `host={{ .HOST }} port={{ .PORT | default "8080" }} pw={{ required "PASSWORD" | json }} cert={{ .CERT | b64dec }}`, env)
+	assert.Nil(t, err)
+	assert.Equal(t, `host=localhost port=8080 pw="pa\"ss" cert=hello`, string(res.Output))
+	assert.Equal(t, os.FileMode(0), res.Mode)
+
+	res, err = render.Render("test", `{{ fileMode "0640" }}{{ env "HOST" | b64enc }}`, env)
+	assert.Nil(t, err)
+	assert.Equal(t, "bG9jYWxob3N0", string(res.Output))
+	assert.Equal(t, os.FileMode(0640), res.Mode)
+}
+
+func TestRenderErrors(t *testing.T) {
+	_, err := render.Render("test", `{{ required "MISSING" }}`, env)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "required var MISSING is missing or empty")
+
+	_, err = render.Render("test", `{{ .HOST | b64dec }}`, env)
+	assert.NotNil(t, err)
+
+	_, err = render.Render("test", `{{ fileMode "999" }}`, env)
+	assert.NotNil(t, err)
+
+	_, err = render.Render("test", `{{ .HOST `, env)
+	assert.NotNil(t, err)
+}
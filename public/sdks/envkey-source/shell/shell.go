@@ -3,6 +3,7 @@ package shell
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -114,6 +115,20 @@ func ToPairs(
 	previousEnv parser.EnvMap,
 	includeEnviron,
 	force bool,	
+) []string {
+	return ToPairsWithFiles(env, previousEnv, includeEnviron, force, "")
+}
+
+// ToPairsWithFiles works like ToPairs, but if filesDir is set, each var is
+// passed as a path to a file in filesDir using the _FILE suffix convention
+// (DB_PASSWORD_FILE=/run/secrets/DB_PASSWORD) instead of its value. previous
+// values aren't included with __PREV_ since they would expose secrets.
+func ToPairsWithFiles(
+	env parser.EnvMap,
+	previousEnv parser.EnvMap,
+	includeEnviron,
+	force bool,
+	filesDir string,
 ) []string {
 	pairs := []string{}
 	var loaded []string	
@@ -127,7 +142,11 @@ func ToPairs(
 
 	for k, v := range env {
 		if !includeEnviron || force || os.Getenv(k) == "" {
-			pairs = append(pairs, k+"="+v)
+			if filesDir == "" {
+				pairs = append(pairs, k+"="+v)
+			} else {
+				pairs = append(pairs, k+"_FILE="+filepath.Join(filesDir, k))
+			}
 			loaded = append(loaded, k)
 			loadedByVar[k] = true
 		}
@@ -144,7 +163,9 @@ func ToPairs(
 
 			if val != prev {
 				updated = append(updated, k)
-				pairs = append(pairs, "__PREV_" + k + "=" + prev)
+				if filesDir == "" {
+					pairs = append(pairs, "__PREV_" + k + "=" + prev)
+				}
 			}
 		}
 
@@ -152,7 +173,9 @@ func ToPairs(
 		for k, prev := range previousEnv {
 			if !loadedByVar[k] && (!includeEnviron || force || os.Getenv(k) == "") {
 				updated = append(updated, k)
-				pairs = append(pairs, "__PREV_" + k + "=" + prev)
+				if filesDir == "" {
+					pairs = append(pairs, "__PREV_" + k + "=" + prev)
+				}
 			}
 		}
 
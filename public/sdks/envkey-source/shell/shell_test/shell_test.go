@@ -29,6 +29,26 @@ func TestSource(t *testing.T) {
 	assert.Equal(t, correctDotEnv, validRes3)
 }
 
+func TestToPairsWithFiles(t *testing.T) {
+	env := parser.EnvMap{"ENVKEY_SHELL_TEST_DB_PASSWORD": "secret"}
+	previous := parser.EnvMap{"ENVKEY_SHELL_TEST_DB_PASSWORD": "old-secret"}
+
+	pairs := shell.ToPairsWithFiles(env, previous, false, false, "/run/secrets")
+	assert.Equal(t, []string{
+		"ENVKEY_SHELL_TEST_DB_PASSWORD_FILE=/run/secrets/ENVKEY_SHELL_TEST_DB_PASSWORD",
+		"__ENVKEY_LOADED=ENVKEY_SHELL_TEST_DB_PASSWORD",
+		"__ENVKEY_UPDATED=ENVKEY_SHELL_TEST_DB_PASSWORD",
+	}, pairs)
+
+	pairs = shell.ToPairsWithFiles(env, previous, false, false, "")
+	assert.Equal(t, []string{
+		"ENVKEY_SHELL_TEST_DB_PASSWORD=secret",
+		"__ENVKEY_LOADED=ENVKEY_SHELL_TEST_DB_PASSWORD",
+		"__ENVKEY_UPDATED=ENVKEY_SHELL_TEST_DB_PASSWORD",
+		"__PREV_ENVKEY_SHELL_TEST_DB_PASSWORD=old-secret",
+	}, pairs)
+}
+
 const correctValid = "export 'TEST'='it' 'TEST_2'='works!' 'TEST_INJECTION'=''\"'\"'\"'\"'\"'\"'\"'\"'$(uname)' 'TEST_SINGLE_QUOTES'='this'\"'\"'\"'\"'\"'\"'\"'\"' is ok' 'TEST_SPACES'='it does work!' 'TEST_STRANGE_CHARS'='with quotes ` '\"'\"'\"'\"'\"'\"'\"'\"' \\\" bäh' '__ENVKEY_LOADED'='TEST,TEST_2,TEST_INJECTION,TEST_SINGLE_QUOTES,TEST_SPACES,TEST_STRANGE_CHARS'"
 
 const correctPam = "export TEST='it'\nexport TEST_2='works!'\nexport TEST_INJECTION=''\"'\"'$(uname)'\nexport TEST_SINGLE_QUOTES='this'\"'\"' is ok'\nexport TEST_SPACES='it does work!'\nexport TEST_STRANGE_CHARS='with quotes ` '\"'\"' \\\" bäh'"
@@ -0,0 +1,116 @@
+package sink
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+// directory sinks write each var to its own file (like docker secrets), e.g.
+// /run/secrets/DB_PASSWORD. names of files written are tracked in a manifest
+// so that files for removed vars can be cleaned up, even across restarts,
+// without touching any other files in the directory.
+
+const DIR_MODE = 0700
+const MANIFEST_FILENAME = ".envkey-files"
+
+func FilePath(dir, key string) string {
+	return filepath.Join(dir, key)
+}
+
+func WriteDir(dir string, env parser.EnvMap) error {
+	for k := range env {
+		if !validFilename(k) {
+			return errors.New("can't write var to file: " + k)
+		}
+	}
+
+	err := os.MkdirAll(dir, DIR_MODE)
+	if err != nil {
+		return err
+	}
+
+	previousKeys, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(env))
+	for k, v := range env {
+		keys = append(keys, k)
+		err = WriteFile(FilePath(dir, k), []byte(v))
+		if err != nil {
+			return err
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range previousKeys {
+		if _, ok := env[k]; !ok {
+			err = Remove(FilePath(dir, k))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return WriteFile(filepath.Join(dir, MANIFEST_FILENAME), []byte(strings.Join(keys, "\n")))
+}
+
+// ClearDir removes (or if blank is true, empties) every file previously written
+// by WriteDir
+func ClearDir(dir string, blank bool) error {
+	keys, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if blank {
+			err = Blank(FilePath(dir, k))
+		} else {
+			err = Remove(FilePath(dir, k))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if blank {
+		return nil
+	}
+
+	return Remove(filepath.Join(dir, MANIFEST_FILENAME))
+}
+
+func readManifest(dir string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, MANIFEST_FILENAME))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, k := range strings.Split(string(b), "\n") {
+		if validFilename(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+func validFilename(k string) bool {
+	return k != "" &&
+		k != "." &&
+		k != ".." &&
+		k != MANIFEST_FILENAME &&
+		!strings.ContainsAny(k, `/\`+"\x00")
+}
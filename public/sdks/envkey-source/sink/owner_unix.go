@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package sink
+
+import (
+	"os"
+	"syscall"
+)
+
+func preserveOwner(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if int(stat.Uid) == os.Geteuid() && int(stat.Gid) == os.Getegid() {
+		return nil
+	}
+
+	return os.Chown(path, int(stat.Uid), int(stat.Gid))
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package sink
+
+import "os"
+
+// ownership isn't preserved on windows
+func preserveOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/shell"
+	"gopkg.in/yaml.v2"
+)
+
+// sinks keep files on disk in sync with an ENVKEY's latest env
+
+const FILE_MODE = 0600
+
+func Format(env parser.EnvMap, format string) ([]byte, error) {
+	switch format {
+	case "dotenv", "":
+		if env != nil && len(env) == 0 {
+			return []byte{}, nil
+		}
+		res, err := shell.Source(env, true, false, true)
+		return []byte(res), err
+	case "json":
+		res, err := env.ToJson()
+		return []byte(res), err
+	case "yaml":
+		return yaml.Marshal(&env)
+	}
+
+	return nil, errors.New("unsupported format: " + format + " (must be dotenv, json, or yaml)")
+}
+
+// WriteFile atomically replaces the file at path with contents by writing
+// to a temp file in the same directory and renaming it over path. the file
+// keeps restrictive permissions, and keeps its owner if it already existed.
+func WriteFile(path string, contents []byte) error {
+	return WriteFileWithMode(path, contents, FILE_MODE)
+}
+
+func WriteFileWithMode(path string, contents []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// no-op after successful rename
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpPath, mode)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err == nil {
+		err = preserveOwner(tmpPath, info)
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Blank replaces the file at path with an empty file
+func Blank(path string) error {
+	return WriteFile(path, []byte{})
+}
+
+// Remove deletes the file at path, ignoring it if it doesn't exist
+func Remove(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package sink_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkey/public/sdks/envkey-source/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+var env = parser.EnvMap{"TEST": "it", "TEST_2": "works!"}
+
+func TestFormat(t *testing.T) {
+	var res []byte
+	var err error
+
+	res, err = sink.Format(env, "dotenv")
+	assert.Nil(t, err)
+	assert.Equal(t, "TEST='it'\nTEST_2='works!'\n", string(res))
+
+	res, err = sink.Format(env, "json")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"TEST":"it","TEST_2":"works!"}`, string(res))
+
+	res, err = sink.Format(env, "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "TEST: it\nTEST_2: works!\n", string(res))
+
+	_, err = sink.Format(env, "toml")
+	assert.NotNil(t, err)
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-sink")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".env")
+	ioutil.WriteFile(path, []byte("OLD=1"), 0644)
+
+	err := sink.WriteFile(path, []byte("TEST='it'\n"))
+	assert.Nil(t, err)
+
+	res, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "TEST='it'\n", string(res))
+
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// no temp files left behind
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+
+	err = sink.Blank(path)
+	assert.Nil(t, err)
+	res, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "", string(res))
+
+	err = sink.Remove(path)
+	assert.Nil(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// removing a missing file isn't an error
+	assert.Nil(t, sink.Remove(path))
+}
+
+func TestWriteDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-sink-dir")
+	defer os.RemoveAll(dir)
+
+	secretsDir := filepath.Join(dir, "secrets")
+	os.MkdirAll(secretsDir, 0700)
+	ioutil.WriteFile(filepath.Join(secretsDir, "unmanaged"), []byte("x"), 0600)
+
+	err := sink.WriteDir(secretsDir, parser.EnvMap{"DB_PASSWORD": "secret", "API_KEY": "key"})
+	assert.Nil(t, err)
+
+	res, _ := ioutil.ReadFile(filepath.Join(secretsDir, "DB_PASSWORD"))
+	assert.Equal(t, "secret", string(res))
+
+	info, _ := os.Stat(filepath.Join(secretsDir, "API_KEY"))
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// removed vars are cleaned up
+	err = sink.WriteDir(secretsDir, parser.EnvMap{"DB_PASSWORD": "rotated"})
+	assert.Nil(t, err)
+
+	res, _ = ioutil.ReadFile(filepath.Join(secretsDir, "DB_PASSWORD"))
+	assert.Equal(t, "rotated", string(res))
+
+	_, err = os.Stat(filepath.Join(secretsDir, "API_KEY"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = sink.ClearDir(secretsDir, false)
+	assert.Nil(t, err)
+
+	_, err = os.Stat(filepath.Join(secretsDir, "DB_PASSWORD"))
+	assert.True(t, os.IsNotExist(err))
+
+	// files not written by WriteDir are left alone
+	_, err = os.Stat(filepath.Join(secretsDir, "unmanaged"))
+	assert.Nil(t, err)
+
+	err = sink.WriteDir(secretsDir, parser.EnvMap{"../ESCAPE": "x"})
+	assert.NotNil(t, err)
+}
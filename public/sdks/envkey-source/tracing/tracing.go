@@ -0,0 +1,442 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
+	"github.com/envkey/envkey/public/sdks/envkey-source/version"
+)
+
+// optional tracing spans for profiling fetches, exported in the OTLP/JSON
+// format to a file or to a collector's OTLP/HTTP endpoint. until Init is
+// called with a file or endpoint, Start returns a nil span and every span
+// method is a no-op.
+
+const DEFAULT_SERVICE_NAME = "envkey-source"
+
+const TRACEPARENT_HEADER = "traceparent"
+
+type Options struct {
+	// appends one OTLP/JSON ExportTraceServiceRequest per line
+	File string
+
+	// OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+
+	// default is envkey-source
+	ServiceName string
+}
+
+func (opts Options) Enabled() bool {
+	return opts.File != "" || opts.Endpoint != ""
+}
+
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(k, v string) Attr    { return Attr{k, v} }
+func Int(k string, v int) Attr   { return Attr{k, v} }
+func Bool(k string, v bool) Attr { return Attr{k, v} }
+
+type Span struct {
+	traceId  string
+	spanId   string
+	parentId string
+
+	// the span's furthest ancestor in this process. ending it exports the
+	// trace, and spans that end after it (like async cache writes) are
+	// exported as they end.
+	root *Span
+
+	name  string
+	start time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []Attr
+	err   error
+	ended bool
+}
+
+type spanContext struct {
+	traceId string
+	spanId  string
+
+	// nil for a parent in another process
+	root *Span
+}
+
+type contextKey struct{}
+
+var logger = logging.New("tracing")
+
+var mutex sync.Mutex
+var opts Options
+var enabled bool
+var pending []*Span
+var client = &http.Client{Timeout: 5 * time.Second}
+
+// how long a process waits for background exports with Wait before exiting
+const EXIT_TIMEOUT = time.Duration(1) * time.Second
+
+// exports posted in the background when a root span ends
+var exporting sync.WaitGroup
+
+func Init(optsArg Options) error {
+	if optsArg.File != "" {
+		f, err := os.OpenFile(optsArg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	if optsArg.Endpoint != "" && !strings.HasPrefix(optsArg.Endpoint, "http://") && !strings.HasPrefix(optsArg.Endpoint, "https://") {
+		return errors.New("invalid trace endpoint: " + optsArg.Endpoint + " (must be an http or https url)")
+	}
+
+	if optsArg.ServiceName == "" {
+		optsArg.ServiceName = DEFAULT_SERVICE_NAME
+	}
+
+	mutex.Lock()
+	opts = optsArg
+	enabled = optsArg.Enabled()
+	mutex.Unlock()
+
+	return nil
+}
+
+func Enabled() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return enabled
+}
+
+// Start begins a span that's a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	span := &Span{
+		spanId: randomId(8),
+		name:   name,
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+
+	if parent, ok := ctx.Value(contextKey{}).(spanContext); ok {
+		span.traceId = parent.traceId
+		span.parentId = parent.spanId
+		span.root = parent.root
+	} else {
+		span.traceId = randomId(16)
+	}
+
+	if span.root == nil {
+		span.root = span
+	}
+
+	return context.WithValue(ctx, contextKey{}, spanContext{traceId: span.traceId, spanId: span.spanId, root: span.root}), span
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed. a nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	mutex.Lock()
+	pending = append(pending, s)
+	mutex.Unlock()
+
+	// the collector is posted to in the background so a slow one doesn't
+	// hold up the fetch--see Wait
+	if s.root == s || s.root.isEnded() {
+		flush(true)
+	}
+}
+
+func (s *Span) isEnded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+// Flush exports every ended span that hasn't been exported yet, waiting for
+// the collector to respond. it's called automatically (without waiting for
+// the collector) when a span with no parent in this process ends.
+func Flush() error {
+	return flush(false)
+}
+
+// Wait waits up to timeout for exports started in the background to finish,
+// returning false if they didn't. a process should call it before exiting.
+func Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		exporting.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func flush(background bool) error {
+	mutex.Lock()
+	spans := pending
+	pending = nil
+	currentOpts := opts
+	mutex.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(exportRequest(currentOpts.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+
+	if currentOpts.File != "" {
+		err = appendLine(currentOpts.File, b)
+		if err != nil {
+			logger.Warn("trace_export_failed", err, "couldn't write traces to %s", currentOpts.File)
+		}
+	}
+
+	if currentOpts.Endpoint != "" {
+		if background {
+			exporting.Add(1)
+			go func() {
+				defer exporting.Done()
+				post(currentOpts.Endpoint, b)
+			}()
+		} else if postErr := post(currentOpts.Endpoint, b); postErr != nil {
+			err = postErr
+		}
+	}
+
+	return err
+}
+
+// Inject sets a W3C traceparent header for the span in ctx, so another
+// process can continue the trace
+func Inject(ctx context.Context, header http.Header) {
+	if sc, ok := ctx.Value(contextKey{}).(spanContext); ok {
+		header.Set(TRACEPARENT_HEADER, "00-"+sc.traceId+"-"+sc.spanId+"-01")
+	}
+}
+
+// Extract returns ctx with the remote parent from a W3C traceparent header,
+// if there's a valid one
+func Extract(ctx context.Context, header http.Header) context.Context {
+	parts := strings.Split(header.Get(TRACEPARENT_HEADER), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHex(parts[1]) || !isHex(parts[2]) {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, spanContext{traceId: parts[1], spanId: parts[2]})
+}
+
+func appendLine(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+func post(endpoint string, b []byte) error {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(b))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = errors.New("trace collector responded with status " + strconv.Itoa(resp.StatusCode))
+		}
+	}
+
+	if err != nil {
+		logger.Warn("trace_export_failed", err, "couldn't send traces to %s", endpoint)
+	}
+	return err
+}
+
+func randomId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+/*
+* OTLP/JSON encoding -- see
+* https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+ */
+
+const SPAN_KIND_INTERNAL = 1
+const STATUS_CODE_ERROR = 2
+
+type ExportRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeSpans struct {
+	Scope Scope      `json:"scope"`
+	Spans []SpanData `json:"spans"`
+}
+
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type SpanData struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func exportRequest(serviceName string, spans []*Span) ExportRequest {
+	data := make([]SpanData, 0, len(spans))
+	for _, s := range spans {
+		data = append(data, s.data())
+	}
+
+	return ExportRequest{
+		ResourceSpans: []ResourceSpans{{
+			Resource: Resource{
+				Attributes: []KeyValue{keyValue(String("service.name", serviceName))},
+			},
+			ScopeSpans: []ScopeSpans{{
+				Scope: Scope{Name: DEFAULT_SERVICE_NAME, Version: version.Version},
+				Spans: data,
+			}},
+		}},
+	}
+}
+
+func (s *Span) data() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := SpanData{
+		TraceId:           s.traceId,
+		SpanId:            s.spanId,
+		ParentSpanId:      s.parentId,
+		Name:              s.name,
+		Kind:              SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+
+	for _, attr := range s.attrs {
+		d.Attributes = append(d.Attributes, keyValue(attr))
+	}
+
+	if s.err != nil {
+		d.Status = Status{Code: STATUS_CODE_ERROR, Message: s.err.Error()}
+	}
+
+	return d
+}
+
+func keyValue(attr Attr) KeyValue {
+	var v AnyValue
+	switch val := attr.Value.(type) {
+	case string:
+		v.StringValue = &val
+	case int:
+		s := strconv.Itoa(val)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &val
+	default:
+		s := ""
+		v.StringValue = &s
+	}
+	return KeyValue{Key: attr.Key, Value: v}
+}
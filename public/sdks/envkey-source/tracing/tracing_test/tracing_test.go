@@ -0,0 +1,142 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func readRequests(t *testing.T, path string) []tracing.ExportRequest {
+	contents, _ := ioutil.ReadFile(path)
+
+	var res []tracing.ExportRequest
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		if line == "" {
+			continue
+		}
+		var req tracing.ExportRequest
+		assert.Nil(t, json.Unmarshal([]byte(line), &req))
+		res = append(res, req)
+	}
+	return res
+}
+
+func TestSpans(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-tracing")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traces.json")
+
+	// disabled spans are nil and safe to use
+	assert.Nil(t, tracing.Init(tracing.Options{}))
+	_, span := tracing.Start(context.Background(), "disabled")
+	assert.Nil(t, span)
+	span.SetError(errors.New("ignored"))
+	span.End()
+
+	assert.Nil(t, tracing.Init(tracing.Options{File: path}))
+
+	ctx, root := tracing.Start(context.Background(), "fetch")
+	_, child := tracing.Start(ctx, "fetch.endpoint", tracing.Int("fetch.endpoint", 0))
+	child.SetError(errors.New("timeout"))
+	child.End()
+
+	// nothing is exported until the root ends
+	assert.Equal(t, 0, len(readRequests(t, path)))
+
+	_, late := tracing.Start(ctx, "cache.write")
+	root.End()
+
+	reqs := readRequests(t, path)
+	assert.Equal(t, 1, len(reqs))
+
+	spans := reqs[0].ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "fetch.endpoint", spans[0].Name)
+	assert.Equal(t, spans[1].SpanId, spans[0].ParentSpanId)
+	assert.Equal(t, spans[1].TraceId, spans[0].TraceId)
+	assert.Equal(t, "timeout", spans[0].Status.Message)
+	assert.Equal(t, "0", *spans[0].Attributes[0].Value.IntValue)
+	assert.Equal(t, "", spans[1].ParentSpanId)
+
+	// spans that end after their root are exported as they end
+	late.End()
+	reqs = readRequests(t, path)
+	assert.Equal(t, 2, len(reqs))
+	assert.Equal(t, "cache.write", reqs[1].ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+}
+
+func TestPropagation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "envkey-tracing")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traces.json")
+
+	assert.Nil(t, tracing.Init(tracing.Options{File: path}))
+
+	ctx, clientSpan := tracing.Start(context.Background(), "envkey-source.load_env")
+	header := http.Header{}
+	tracing.Inject(ctx, header)
+
+	// a span continuing a remote parent is the root of this process's part of the trace
+	_, daemonSpan := tracing.Start(tracing.Extract(context.Background(), header), "daemon.fetch_current")
+	daemonSpan.End()
+
+	reqs := readRequests(t, path)
+	assert.Equal(t, 1, len(reqs))
+	exported := reqs[0].ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "daemon.fetch_current", exported.Name)
+	assert.True(t, strings.Contains(header.Get(tracing.TRACEPARENT_HEADER), exported.TraceId+"-"+exported.ParentSpanId))
+
+	clientSpan.End()
+
+	// invalid headers are ignored
+	header.Set(tracing.TRACEPARENT_HEADER, "00-xyz-abc-01")
+	ctx = tracing.Extract(context.Background(), header)
+	assert.Equal(t, context.Background(), ctx)
+}
+
+func TestEndpointExport(t *testing.T) {
+	received := make(chan tracing.ExportRequest, 1)
+	release := make(chan struct{})
+
+	// a slow collector
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var req tracing.ExportRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+	}))
+	defer server.Close()
+
+	assert.Nil(t, tracing.Init(tracing.Options{Endpoint: server.URL}))
+	defer tracing.Init(tracing.Options{})
+
+	// ending the root doesn't wait for the collector
+	_, root := tracing.Start(context.Background(), "fetch")
+	start := time.Now()
+	root.End()
+	assert.True(t, time.Since(start) < time.Second)
+
+	// Wait gives up after its timeout
+	assert.False(t, tracing.Wait(50*time.Millisecond))
+
+	close(release)
+	assert.True(t, tracing.Wait(5*time.Second))
+
+	select {
+	case req := <-received:
+		assert.Equal(t, "fetch", req.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+	default:
+		t.Fatal("collector didn't receive the trace")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
+	"github.com/envkey/envkey/public/sdks/envkey-source/tracing"
 	"github.com/jwalton/go-supportscolor"
 	colors "github.com/logrusorgru/aurora/v3"
 )
@@ -14,13 +16,17 @@ import (
 var stderrLogger = log.New(os.Stderr, "", 0)
 var stdoutLogger = log.New(os.Stdout, "", 0)
 
+var logger = logging.New("envkey-source")
+
 func Fatal(msg string, toStderr bool) {
-	log.Println(msg)
+	logger.Error("fatal", nil, "%s", msg)
 	if toStderr {
 		stderrLogger.Println(msg)
 	} else {
 		stdoutLogger.Println("echo 'error: " + msg + "'; false")
 	}
+	// so a failed fetch's trace is exported
+	tracing.Wait(tracing.EXIT_TIMEOUT)
 	os.Exit(1)
 }
 
@@ -46,6 +52,14 @@ func FormatTerminal(s string, color func(interface{}) colors.Value) string {
 	return colors.Sprintf(colors.Bold(colorFn(msg)))
 }
 
+func FormatPrefix(s string, color func(interface{}) colors.Value) string {
+	if !terminalSupportsColors() || color == nil {
+		return s
+	}
+
+	return colors.Sprintf(color(s))
+}
+
 func IdPart(envkey string) string {
 	return strings.Split(envkey, "-")[0]
 }
@@ -2,13 +2,13 @@ package ws
 
 import (
 	"errors"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/logging"
 	"github.com/gorilla/websocket"
 	"github.com/jpillora/backoff"
 )
@@ -19,8 +19,14 @@ var (
 	ErrUrlWrongScheme = errors.New("websocket uri must start with ws or wss scheme")
 )
 
+var logger = logging.New("ws")
+
 type WsOpts func(dl *websocket.Dialer)
 
+// DefaultOpts are applied to every dialer before the opts passed to Dial,
+// e.g. to point connections at a local mock server in tests
+var DefaultOpts []WsOpts
+
 type ReconnectingWebsocket struct {
 	ReconnectIntervalMin    time.Duration
 	ReconnectIntervalMax    time.Duration
@@ -103,7 +109,7 @@ func (ws *ReconnectingWebsocket) ReadMessage() (messageType int, message []byte,
 		messageType, message, err = ws.Conn.ReadMessage()
 
 		if err != nil {
-			log.Println("WebSocket ReadMessage err:", err)
+			logger.Error("websocket_read_failed", err, "WebSocket ReadMessage err")
 			ws.handleError(err, ws.httpResponse.StatusCode)
 		}
 	}
@@ -153,7 +159,7 @@ func (ws *ReconnectingWebsocket) Dial(urlStr string, reqHeader http.Header, opts
 		Proxy:            http.ProxyFromEnvironment,
 		HandshakeTimeout: ws.HandshakeTimeout,
 	}
-	for _, opt := range opts {
+	for _, opt := range append(append([]WsOpts{}, DefaultOpts...), opts...) {
 		opt(ws.dialer)
 	}
 
@@ -206,7 +212,7 @@ func (ws *ReconnectingWebsocket) Connect(isReconnect bool) {
 		} else {
 			connectFailed = true
 			if !loggedReconnect {
-				log.Printf("Websocket[%s].Dial: can't connect to websocket (err: %s, httpResp: %v), attempting to reconnect...\n", ws.url, err, httpResp == nil)
+				logger.Warn("websocket_reconnecting", err, "Websocket[%s].Dial: can't connect to websocket (httpResp: %v), attempting to reconnect...", ws.url, httpResp == nil)
 				loggedReconnect = true
 
 				ws.dispatchWillReconnect()
@@ -219,7 +225,7 @@ func (ws *ReconnectingWebsocket) Connect(isReconnect bool) {
 		code := httpResp.StatusCode
 
 		if err == nil {
-			log.Printf("Websocket.Dial: connection was successfully established with %s\n", ws.url)
+			logger.Info("websocket_connected", "Websocket.Dial: connection was successfully established with %s", ws.url)
 
 			if isReconnect || connectFailed {
 				ws.dispatchReconnected()
@@ -227,20 +233,20 @@ func (ws *ReconnectingWebsocket) Connect(isReconnect bool) {
 
 			return
 		} else if strings.Contains(err.Error(), "4001: forbidden") || code == 401 || code == 404 {
-			log.Printf("Websocket.Dial: connection to %s failed: %d (invalid ENVKEY)\n", ws.url, code)
+			logger.Error("websocket_invalid", nil, "Websocket.Dial: connection to %s failed: %d (invalid ENVKEY)", ws.url, code)
 			if ws.OnInvalid != nil {
 				ws.OnInvalid()
 			}
 			return
 		} else if strings.Contains(err.Error(), "4002: throttled") || code == 429 {
-			log.Printf("Websocket.Dial: connection to %s failed: %d (throttled)\n", ws.url, code)
+			logger.Warn("websocket_throttled", nil, "Websocket.Dial: connection to %s failed: %d (throttled)", ws.url, code)
 			if ws.OnThrottled != nil {
 				ws.OnThrottled()
 			}
 			return
 		} else {
 			if !loggedReconnect {
-				log.Printf("Websocket[%s].Dial: can't connect to websocket (status: %d) attempting to reconnect...\n", ws.url, code)
+				logger.Warn("websocket_reconnecting", nil, "Websocket[%s].Dial: can't connect to websocket (status: %d) attempting to reconnect...", ws.url, code)
 				ws.dispatchWillReconnect()
 				loggedReconnect = true
 			}
@@ -0,0 +1,19 @@
+package envkeygo
+
+import (
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkeygo/v2/decode"
+	"github.com/envkey/envkeygo/v2/loader"
+)
+
+// Decode sets the fields of the struct cfg points to from the environment,
+// which importing this package has already loaded. see the decode package
+// for supported tags and types.
+func Decode(cfg interface{}) error {
+	return decode.Decode(loader.Environ(), cfg)
+}
+
+// DecodeMap is like Decode, with env from loader.LoadMap or elsewhere
+func DecodeMap(env parser.EnvMap, cfg interface{}) error {
+	return decode.Decode(env, cfg)
+}
@@ -0,0 +1,303 @@
+package decode
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+/*
+* Decode sets struct fields from env vars using tags:
+*
+*		Port    int           `env:"PORT,required"`
+*		Timeout time.Duration `env:"TIMEOUT" default:"30s"`
+*		Hosts   []string      `env:"HOSTS" envSeparator:";"`
+*		DB      DBConfig      `envPrefix:"DB_"`
+*
+*	- vars that are empty are treated the same as vars that aren't set
+*	- slices are split on envSeparator (default ","), and maps are also split
+*		on envSeparator, with each key and value separated by ":"
+*	- structs without an env tag are decoded field by field, with envPrefix
+*		prepended to each of their vars
+*	- fields without an env tag, and fields tagged env:"-", are left alone
+*
+* Supported types are strings, bools, ints, uints, floats, time.Duration,
+* url.URL, anything implementing encoding.TextUnmarshaler, and pointers,
+* slices, and maps of them.
+ */
+
+type FieldError struct {
+	// path to the field in the struct, e.g. DB.Port
+	Field string
+	Var   string
+
+	// true if the field is required and its var isn't set
+	Missing bool
+
+	// why the var's value couldn't be decoded, if it's set
+	Err error
+}
+
+// Error doesn't include the var's value, since it may be secret
+func (e *FieldError) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("%s (%s): required but not set", e.Var, e.Field)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Var, e.Field, e.Err.Error())
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Error lists every field that couldn't be decoded
+type Error struct {
+	Fields []*FieldError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+	return fmt.Sprintf("%d env var(s) couldn't be decoded:\n\t%s", len(e.Fields), strings.Join(msgs, "\n\t"))
+}
+
+// invalidError is a decoding error without the value that failed to
+// decode, wrapping the original error
+type invalidError struct {
+	typ reflect.Type
+	err error
+}
+
+func (e *invalidError) Error() string {
+	return "invalid " + e.typ.String()
+}
+
+func (e *invalidError) Unwrap() error {
+	return e.err
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+var urlType = reflect.TypeOf(url.URL{})
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+type decoder struct {
+	env  parser.EnvMap
+	errs []*FieldError
+}
+
+// Decode sets the fields of the struct v points to from env. every field that
+// can't be decoded is listed in the returned *Error.
+func Decode(env parser.EnvMap, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("decode: v must be a non-nil pointer to a struct")
+	}
+
+	d := decoder{env: env}
+	d.decodeStruct(rv.Elem(), "", "")
+
+	if len(d.errs) > 0 {
+		return &Error{Fields: d.errs}
+	}
+	return nil
+}
+
+func (d *decoder) decodeStruct(v reflect.Value, prefix, path string) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		fieldValue := v.Field(i)
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+
+		tag, hasTag := field.Tag.Lookup("env")
+		if tag == "-" {
+			continue
+		}
+
+		if !hasTag {
+			if isNested(field.Type) {
+				if fieldValue.Kind() == reflect.Ptr {
+					if fieldValue.IsNil() {
+						fieldValue.Set(reflect.New(field.Type.Elem()))
+					}
+					fieldValue = fieldValue.Elem()
+				}
+				d.decodeStruct(fieldValue, prefix+field.Tag.Get("envPrefix"), fieldPath)
+			}
+			continue
+		}
+
+		tagParts := strings.Split(tag, ",")
+		name := prefix + tagParts[0]
+		required := false
+		for _, opt := range tagParts[1:] {
+			if opt == "required" {
+				required = true
+			}
+		}
+
+		val := d.env[name]
+		if val == "" {
+			val = field.Tag.Get("default")
+		}
+
+		if val == "" {
+			if required {
+				d.errs = append(d.errs, &FieldError{Field: fieldPath, Var: name, Missing: true})
+			}
+			continue
+		}
+
+		sep := field.Tag.Get("envSeparator")
+		if sep == "" {
+			sep = ","
+		}
+
+		err := decodeValue(fieldValue, val, sep)
+		if err != nil {
+			d.errs = append(d.errs, &FieldError{Field: fieldPath, Var: name, Err: err})
+		}
+	}
+}
+
+// isNested is true for structs (or pointers to them) that are decoded field
+// by field rather than from a single var
+func isNested(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct &&
+		t != urlType &&
+		!reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func decodeValue(v reflect.Value, s string, sep string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		err := decodeValue(elem.Elem(), s, sep)
+		if err == nil {
+			v.Set(elem)
+		}
+		return err
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		return nil
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.SetInt(int64(d))
+		return nil
+
+	case urlType:
+		u, err := url.Parse(s)
+		if err == nil && u.Scheme == "" {
+			err = errors.New("missing scheme")
+		}
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return &invalidError{v.Type(), err}
+		}
+		v.SetFloat(n)
+
+	case reflect.Slice:
+		parts := strings.Split(s, sep)
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			err := decodeValue(slice.Index(i), strings.TrimSpace(part), sep)
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(s, sep) {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				return &invalidError{v.Type(), errors.New("map entries must be key:value")}
+			}
+
+			key := reflect.New(v.Type().Key()).Elem()
+			err := decodeValue(key, strings.TrimSpace(kv[0]), sep)
+			if err != nil {
+				return err
+			}
+
+			val := reflect.New(v.Type().Elem()).Elem()
+			err = decodeValue(val, strings.TrimSpace(kv[1]), sep)
+			if err != nil {
+				return err
+			}
+
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+
+	return nil
+}
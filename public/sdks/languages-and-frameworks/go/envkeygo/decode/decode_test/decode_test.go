@@ -0,0 +1,134 @@
+package decode_test
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/envkey/envkeygo/v2/decode"
+)
+
+type dbConfig struct {
+	Host string `env:"HOST" default:"localhost"`
+	Port int    `env:"PORT,required"`
+}
+
+type config struct {
+	Name     string            `env:"NAME"`
+	Port     int               `env:"PORT" default:"8080"`
+	Debug    bool              `env:"DEBUG"`
+	Ratio    float64           `env:"RATIO"`
+	MaxConns uint16            `env:"MAX_CONNS"`
+	Timeout  time.Duration     `env:"TIMEOUT" default:"30s"`
+	Endpoint url.URL           `env:"ENDPOINT"`
+	Callback *url.URL          `env:"CALLBACK"`
+	IP       net.IP            `env:"IP"`
+	Hosts    []string          `env:"HOSTS"`
+	Ports    []int             `env:"PORTS" envSeparator:";"`
+	Limits   map[string]int    `env:"LIMITS"`
+	Labels   map[string]string `env:"LABELS"`
+	Optional *int              `env:"OPTIONAL"`
+
+	DB      dbConfig  `envPrefix:"DB_"`
+	Replica *dbConfig `envPrefix:"REPLICA_"`
+
+	Ignored  string `env:"-"`
+	Untagged string
+	private  string `env:"PRIVATE"`
+}
+
+func TestDecode(t *testing.T) {
+	var cfg config
+	err := decode.Decode(parser.EnvMap{
+		"NAME":            "api",
+		"DEBUG":           "true",
+		"RATIO":           "0.5",
+		"MAX_CONNS":       "100",
+		"ENDPOINT":        "https://example.com/api",
+		"CALLBACK":        "https://example.com/callback",
+		"IP":              "10.0.0.1",
+		"HOSTS":           "a.com, b.com",
+		"PORTS":           "1;2;3",
+		"LIMITS":          "free:10,pro:100",
+		"LABELS":          "team:core",
+		"DB_PORT":         "5432",
+		"REPLICA_HOST":    "replica",
+		"REPLICA_PORT":    "5433",
+		"Untagged":        "x",
+		"PRIVATE":         "x",
+		"IGNORED":         "x",
+		"UNRELATED_VAR_1": "x",
+	}, &cfg)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "api", cfg.Name)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, 0.5, cfg.Ratio)
+	assert.Equal(t, uint16(100), cfg.MaxConns)
+	assert.Equal(t, 30*time.Second, cfg.Timeout)
+	assert.Equal(t, "example.com", cfg.Endpoint.Host)
+	assert.Equal(t, "/callback", cfg.Callback.Path)
+	assert.Equal(t, "10.0.0.1", cfg.IP.String())
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Hosts)
+	assert.Equal(t, []int{1, 2, 3}, cfg.Ports)
+	assert.Equal(t, map[string]int{"free": 10, "pro": 100}, cfg.Limits)
+	assert.Equal(t, map[string]string{"team": "core"}, cfg.Labels)
+	assert.Nil(t, cfg.Optional)
+	assert.Equal(t, dbConfig{Host: "localhost", Port: 5432}, cfg.DB)
+	assert.Equal(t, &dbConfig{Host: "replica", Port: 5433}, cfg.Replica)
+	assert.Equal(t, "", cfg.Ignored)
+	assert.Equal(t, "", cfg.Untagged)
+	assert.Equal(t, "", cfg.private)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var cfg config
+	err := decode.Decode(parser.EnvMap{
+		"PORT":      "secret-port",
+		"MAX_CONNS": "100000",
+		"TIMEOUT":   "soon",
+		"ENDPOINT":  "example.com",
+		"IP":        "not-an-ip",
+		"PORTS":     "1;two",
+		"LIMITS":    "free",
+		// empty is the same as unset
+		"DB_PORT":      "",
+		"REPLICA_PORT": "5433",
+	}, &cfg)
+
+	var decodeErr *decode.Error
+	assert.True(t, errors.As(err, &decodeErr))
+
+	vars := []string{}
+	for _, field := range decodeErr.Fields {
+		vars = append(vars, field.Var)
+	}
+	assert.Equal(t, []string{"PORT", "MAX_CONNS", "TIMEOUT", "ENDPOINT", "IP", "PORTS", "LIMITS", "DB_PORT"}, vars)
+
+	assert.True(t, decodeErr.Fields[7].Missing)
+	assert.Equal(t, "DB.Port", decodeErr.Fields[7].Field)
+
+	// underlying errors are kept, but values aren't included in messages
+	assert.True(t, errors.Is(decodeErr.Fields[1].Err, strconv.ErrRange))
+	assert.False(t, strings.Contains(err.Error(), "secret-port"))
+	assert.Contains(t, err.Error(), "8 env var(s)")
+	assert.Contains(t, err.Error(), "PORT (Port): invalid int")
+	assert.Contains(t, err.Error(), "DB_PORT (DB.Port): required but not set")
+}
+
+func TestDecodeInvalidTarget(t *testing.T) {
+	var cfg config
+	assert.NotNil(t, decode.Decode(parser.EnvMap{}, cfg))
+	assert.NotNil(t, decode.Decode(parser.EnvMap{}, (*config)(nil)))
+
+	var s string
+	assert.NotNil(t, decode.Decode(parser.EnvMap{}, &s))
+}
@@ -6,7 +6,12 @@ import (
 	"github.com/envkey/envkeygo/v2/loader"
 )
 
+// importing the package loads the env, panicking on any error. use
+// loader.LoadWithOptions to handle errors or configure loading.
 func init() {
-	shouldCache := os.Getenv("ENVKEY_SHOULD_CACHE") != ""
-	loader.Load(shouldCache, true)
+	loader.Load(options().ShouldCache, true)
+}
+
+func options() loader.Options {
+	return loader.Options{ShouldCache: os.Getenv("ENVKEY_SHOULD_CACHE") != ""}
 }
@@ -1,9 +1,9 @@
 module github.com/envkey/envkeygo/v2
 
-go 1.17
+go 1.18
 
 require (
-	github.com/envkey/envkey/public/sdks/envkey-source v0.0.0-20230831215936-4ae8a99f9565
+	github.com/envkey/envkey/public/sdks/envkey-source v0.0.0-20261018203545-b8f5e8e35611
 	github.com/stretchr/testify v1.8.4
 )
 
@@ -11,9 +11,12 @@ require (
 	github.com/certifi/gocertifi v0.0.0-20210507211836-431795d63e8d // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/google/uuid v1.3.1 // indirect
+	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/jpillora/backoff v1.0.0 // indirect
 	github.com/jwalton/go-supportscolor v1.2.0 // indirect
 	github.com/logrusorgru/aurora/v3 v3.0.0 // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
@@ -22,5 +25,7 @@ require (
 	golang.org/x/crypto v0.12.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 	golang.org/x/term v0.11.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
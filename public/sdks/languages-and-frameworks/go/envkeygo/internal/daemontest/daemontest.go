@@ -0,0 +1,84 @@
+// Package daemontest runs the envkey-source daemon inside a test process,
+// fetching from a mockserver:
+//
+//	server := daemontest.Start(t)
+//	envkey, err := server.AddEnv(parser.EnvMap{"A": "1"})
+//
+// the daemon binds fixed ports and can't be stopped, and it exits the
+// process when the last listener for an ENVKEY closes, so a test should keep
+// one watch open until it ends. test processes take turns with Lock, since
+// go test runs packages in parallel.
+package daemontest
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+)
+
+// listened on by the process using the daemon's ports until it exits
+const LOCK_ADDR = "127.0.0.1:19408"
+
+var lockOnce sync.Once
+var lockListener net.Listener
+
+var startOnce sync.Once
+var server *mockserver.Server
+var startErr error
+
+// Lock blocks until no other test process is using the daemon's ports, then
+// holds them until this process exits
+func Lock() {
+	lockOnce.Do(func() {
+		for {
+			var err error
+			lockListener, err = net.Listen("tcp", LOCK_ADDR)
+			if err == nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+}
+
+// Start starts the daemon if it isn't running, with a mockserver installed
+// for the rest of the process, since the daemon keeps fetching until it
+// exits. HOME is set to a temp dir for the daemon's logs.
+func Start(t *testing.T) *mockserver.Server {
+	Lock()
+
+	startOnce.Do(func() {
+		server, startErr = mockserver.New(mockserver.Options{})
+		if startErr != nil {
+			return
+		}
+		server.Install()
+
+		home, err := os.MkdirTemp("", "envkeygo-daemon")
+		if err != nil {
+			startErr = err
+			return
+		}
+		os.Setenv("HOME", home)
+
+		go daemon.InlineStart(false, true)
+		for i := 0; !daemon.IsAlive(); i++ {
+			if i == 100 {
+				startErr = errors.New("daemon didn't start")
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	if startErr != nil {
+		t.Fatal(startErr)
+	}
+	return server
+}
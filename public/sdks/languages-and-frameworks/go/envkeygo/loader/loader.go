@@ -1,53 +1,189 @@
 package loader
 
 import (
+	"context"
 	"errors"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/envkey/envkey/public/sdks/envkey-source/env"
 	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
 	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
 )
 
+// keep in sync with sdkgo-version.txt
+const Version = "2.4.3"
+
+const DEFAULT_TIMEOUT_SECONDS = 15.0
+
+var ErrMissingEnvkey = errors.New("missing ENVKEY")
+
+// values LoadWithOptions set in os.Environ, so watches can tell them apart
+// from values set in the shell
+var loadedVars = map[string]string{}
+var loadedVarsMutex sync.Mutex
+
+type OverridePolicy int
+
+const (
+	// .env file overrides and non-empty variables already set in the
+	// environment take precedence over the ENVKEY's values
+	OVERRIDES_ALLOWED OverridePolicy = iota
+
+	// only the ENVKEY's values are used, replacing variables already set in
+	// the environment (like envkey-source --force)
+	OVERRIDES_IGNORED
+)
+
+type Options struct {
+	// .env file to load the ENVKEY and overrides from. if empty, the ENVKEY
+	// is looked up the same way envkey-source does it.
+	EnvFilePath string
+
+	// keep an encrypted copy of the env on disk, used when the server
+	// can't be reached
+	ShouldCache bool
+	// default is ~/.envkey/cache
+	CacheDir string
+
+	// applied to each request. default is DEFAULT_TIMEOUT_SECONDS
+	TimeoutSeconds float64
+	// if nil, 3 retries with a 1 second backoff
+	RetryPolicy *fetch.RetryPolicy
+
+	OverridePolicy OverridePolicy
+
+	// defaults are "envkeygo" and Version--set them when wrapping the
+	// loader in another library
+	ClientName    string
+	ClientVersion string
+}
+
+// Load loads the env into os.Environ, panicking on any error. it's what the
+// envkeygo package's init runs. if firstAttempt is false, an invalid ENVKEY
+// from ~/.envkey/apps isn't cleared and retried.
 func Load(shouldCache bool, firstAttempt bool) {
-	var envkey string
-	var appConfig env.AppConfig
-	var overrides parser.EnvMap
-	var err error
+	err := loadEnv(context.Background(), Options{ShouldCache: shouldCache}, firstAttempt)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoadWithOptions loads the env into os.Environ
+func LoadWithOptions(ctx context.Context, opts Options) error {
+	return loadEnv(ctx, opts, true)
+}
+
+func loadEnv(ctx context.Context, opts Options, firstAttempt bool) error {
+	resMap, err := loadMap(ctx, opts, firstAttempt)
+	if err != nil {
+		return err
+	}
+
+	loadedVarsMutex.Lock()
+	defer loadedVarsMutex.Unlock()
+
+	for k, v := range resMap {
+		if os.Getenv(k) == v {
+			continue
+		}
+		err = os.Setenv(k, v)
+		if err != nil {
+			return err
+		}
+		loadedVars[k] = v
+	}
+
+	return nil
+}
 
+// LoadMap returns the env, with overrides applied according to
+// opts.OverridePolicy, without setting anything in os.Environ
+func LoadMap(ctx context.Context, opts Options) (parser.EnvMap, error) {
+	return loadMap(ctx, opts, true)
+}
+
+func loadMap(ctx context.Context, opts Options, firstAttempt bool) (parser.EnvMap, error) {
+	envkey, appConfig, fileLayers, err := lookupEnvkey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resMap, _, err := fetch.FetchMapContext(ctx, envkey, opts.fetchOptions())
+
+	var fetchErr *fetch.FetchError
+	if errors.As(err, &fetchErr) && (fetchErr.Kind == fetch.ERROR_INVALID || fetchErr.Kind == fetch.ERROR_DECRYPT) && appConfig.AppId != "" && firstAttempt {
+		// clear out incorrect ENVKEY and try again
+		env.ClearAppEnvkey(appConfig.AppId)
+		return loadMap(ctx, opts, false)
+	} else if err != nil {
+		return nil, err
+	}
+
+	layers := env.Layers(resMap, fileLayers, opts.OverridePolicy == OVERRIDES_IGNORED)
+	res, _ := env.Resolve(layers)
+
+	return res, nil
+}
+
+// Environ returns os.Environ as an EnvMap
+func Environ() parser.EnvMap {
+	res := parser.EnvMap{}
+	for _, kv := range os.Environ() {
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) == 2 {
+			res[split[0]] = split[1]
+		}
+	}
+	return res
+}
+
+func lookupEnvkey(opts Options) (string, env.AppConfig, []env.Layer, error) {
 	/*
 	* ENVKEY lookup order:
 	*		1 - ENVKEY environment variable is set
-	*		2 - .env file in current directory
-	*		3 - .envkey config file in current directory {appId: string, orgId: string}
+	*		2 - opts.EnvFilePath is set
+	*		3 - .env file in current or parent directory
+	*				-- OR --
+	*				.envkey config file in current or parent directory {appId: string, orgId: string}
 	*				+ file at ~/.envkey/apps/[appId].env (for local keys mainly)
 	*	  4 - .env file at ~/.env
 	 */
 
-	envkey, appConfig, overrides = env.GetEnvkey(false, "", true, false)
-
-	if envkey == "" {
-		panic(errors.New("missing ENVKEY"))
+	envkey, appConfig, fileLayers, err := env.LookupEnvkeyLayers(env.GetEnvkeyOptions{
+		EnvFilePath: opts.EnvFilePath,
+		Profile:     os.Getenv("ENVKEY_PROFILE"),
+		ToStderr:    true,
+	})
+	if err == nil && envkey == "" {
+		err = ErrMissingEnvkey
 	}
 
-	resMap, err := fetch.FetchMap(envkey, fetch.FetchOptions{shouldCache, "", "envkeygo", "2.4.3", false, 15.0, 3, 1})
+	return envkey, appConfig, fileLayers, err
+}
 
-	if err != nil && err.Error() == "ENVKEY invalid" && appConfig.AppId != "" {
-		// clear out incorrect ENVKEY and try again
-		env.ClearAppEnvkey(appConfig.AppId)
-		Load(shouldCache, false)
-		return
-	} else if err != nil {
-		panic(err)
+func (opts Options) fetchOptions() fetch.FetchOptions {
+	fetchOptions := fetch.FetchOptions{
+		ShouldCache:    opts.ShouldCache,
+		CacheDir:       opts.CacheDir,
+		ClientName:     opts.ClientName,
+		ClientVersion:  opts.ClientVersion,
+		TimeoutSeconds: opts.TimeoutSeconds,
+		RetryPolicy:    opts.RetryPolicy,
+		Retries:        3,
+		RetryBackoff:   1,
 	}
 
-	for k, v := range overrides {
-		resMap[k] = v
+	if fetchOptions.ClientName == "" {
+		fetchOptions.ClientName = "envkeygo"
 	}
-
-	for k, v := range resMap {
-		if os.Getenv(k) == "" {
-			os.Setenv(k, v)
-		}
+	if fetchOptions.ClientVersion == "" {
+		fetchOptions.ClientVersion = Version
+	}
+	if fetchOptions.TimeoutSeconds == 0 {
+		fetchOptions.TimeoutSeconds = DEFAULT_TIMEOUT_SECONDS
 	}
+
+	return fetchOptions
 }
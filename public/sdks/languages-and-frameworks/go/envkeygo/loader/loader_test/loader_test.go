@@ -1,9 +1,17 @@
 package loader_test
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/envkey/envkey/public/sdks/envkey-source/fetch"
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/envkey/envkeygo/v2/loader"
@@ -39,3 +47,92 @@ func TestLoadOverrides(t *testing.T) {
 	assert.Equal(t, "it", os.Getenv("TEST"))
 	assert.Equal(t, "override", os.Getenv("TEST_2"))
 }
+
+func startMockServer(t *testing.T) *mockserver.Server {
+	server, err := mockserver.New(mockserver.Options{})
+	assert.Nil(t, err)
+	restore := server.Install()
+	t.Cleanup(func() {
+		restore()
+		server.Close()
+	})
+	return server
+}
+
+func TestLoadWithOptionsMissing(t *testing.T) {
+	os.Clearenv()
+	err := loader.LoadWithOptions(context.Background(), loader.Options{})
+	assert.Equal(t, loader.ErrMissingEnvkey, err)
+}
+
+func TestLoadWithOptionsInvalid(t *testing.T) {
+	server := startMockServer(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"TEST": "it"})
+	server.RemoveEnv(envkey)
+
+	os.Clearenv()
+	os.Setenv("ENVKEY", envkey)
+	err := loader.LoadWithOptions(context.Background(), loader.Options{})
+	var fetchErr *fetch.FetchError
+	assert.True(t, errors.As(err, &fetchErr))
+	assert.Equal(t, fetch.ERROR_INVALID, fetchErr.Kind)
+}
+
+func TestLoadMap(t *testing.T) {
+	server := startMockServer(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"TEST": "it", "TEST_2": "works!"})
+
+	os.Clearenv()
+	os.Setenv("ENVKEY", envkey)
+	os.Setenv("TEST_2", "override")
+
+	res, err := loader.LoadMap(context.Background(), loader.Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"TEST": "it", "TEST_2": "override"}, res)
+	assert.Equal(t, "", os.Getenv("TEST"))
+
+	res, err = loader.LoadMap(context.Background(), loader.Options{OverridePolicy: loader.OVERRIDES_IGNORED})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"TEST": "it", "TEST_2": "works!"}, res)
+}
+
+func TestLoadMapTimeout(t *testing.T) {
+	server := startMockServer(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"TEST": "it"})
+	for _, endpoint := range []int{mockserver.ENDPOINT_PRIMARY, mockserver.ENDPOINT_IN_REGION_FAILOVER, mockserver.ENDPOINT_FAILOVER} {
+		server.SetFault(endpoint, &mockserver.Fault{Delay: 5 * time.Second})
+	}
+
+	os.Clearenv()
+	os.Setenv("ENVKEY", envkey)
+
+	// the timeout applies even though fetch.Client already exists
+	start := time.Now()
+	_, err := loader.LoadMap(context.Background(), loader.Options{TimeoutSeconds: 0.2, RetryPolicy: &fetch.RetryPolicy{}})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
+
+func TestLoadWithOptionsEnvFile(t *testing.T) {
+	server := startMockServer(t)
+	envkey, _ := server.AddEnv(parser.EnvMap{"TEST": "it", "TEST_2": "works!"})
+
+	dir, _ := ioutil.TempDir("", "envkeygo")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".env")
+	ioutil.WriteFile(path, []byte("ENVKEY="+envkey+"\nTEST_2=file-override\n"), 0600)
+
+	os.Clearenv()
+	err := loader.LoadWithOptions(context.Background(), loader.Options{EnvFilePath: path})
+	assert.Nil(t, err)
+	assert.Equal(t, "it", os.Getenv("TEST"))
+	assert.Equal(t, "file-override", os.Getenv("TEST_2"))
+
+	// existing vars are replaced when overrides are ignored
+	err = loader.LoadWithOptions(context.Background(), loader.Options{EnvFilePath: path, OverridePolicy: loader.OVERRIDES_IGNORED})
+	assert.Nil(t, err)
+	assert.Equal(t, "works!", os.Getenv("TEST_2"))
+
+	err = loader.LoadWithOptions(context.Background(), loader.Options{EnvFilePath: filepath.Join(dir, "missing.env")})
+	assert.NotNil(t, err)
+}
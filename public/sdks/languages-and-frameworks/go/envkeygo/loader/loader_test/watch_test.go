@@ -0,0 +1,118 @@
+package loader_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/fakedaemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/envkey/envkeygo/v2/internal/daemontest"
+	"github.com/envkey/envkeygo/v2/loader"
+)
+
+type change struct {
+	previous, current parser.EnvMap
+}
+
+// runs before TestWatch, which starts the real daemon in this process
+func TestWatchDaemonLost(t *testing.T) {
+	daemontest.Lock()
+
+	os.Clearenv()
+	os.Setenv("HOME", t.TempDir())
+	os.Setenv("ENVKEY", "envkey")
+
+	d, err := fakedaemon.New(parser.EnvMap{"TEST": "it"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan change, 10)
+	w, err := loader.StartWatch(ctx, loader.Options{}, func(previous, current parser.EnvMap) {
+		changes <- change{previous, current}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"TEST": "it"}, w.Env())
+	assert.Nil(t, w.Err())
+
+	// the daemon can't be started again without envkey-source on PATH
+	d.Stop()
+	assert.Eventually(t, func() bool {
+		return w.Err() != nil && strings.Contains(w.Err().Error(), "couldn't be found on PATH")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// changes made while it was gone are picked up once it's back
+	d.SetEnv(parser.EnvMap{"TEST": "changed"})
+	assert.Nil(t, d.Start())
+	select {
+	case c := <-changes:
+		assert.Equal(t, "changed", c.current["TEST"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not received")
+	}
+	assert.Nil(t, w.Err())
+
+	cancel()
+	assert.Equal(t, context.Canceled, w.Wait())
+}
+
+func TestWatch(t *testing.T) {
+	server := daemontest.Start(t)
+
+	envkey, err := server.AddEnv(parser.EnvMap{"TEST": "it"})
+	assert.Nil(t, err)
+
+	// other tests clear the environment, and the daemon logs under $HOME
+	home := os.Getenv("HOME")
+
+	// the daemon exits the process when its last listener closes, so one
+	// watch is kept open
+	os.Clearenv()
+	os.Setenv("HOME", home)
+	os.Setenv("ENVKEY", envkey)
+	os.Setenv("TEST_2", "override")
+
+	changes := make(chan change, 10)
+	w, err := loader.StartWatch(context.Background(), loader.Options{}, func(previous, current parser.EnvMap) {
+		changes <- change{previous, current}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, parser.EnvMap{"TEST": "it"}, w.Env())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped, err := loader.StartWatch(ctx, loader.Options{}, func(previous, current parser.EnvMap) {})
+	assert.Nil(t, err)
+
+	// updates until one arrives, since the watch may not be listening yet
+	var c change
+	for i := 0; c.current == nil; i++ {
+		if i == 50 {
+			t.Fatal("change not received")
+		}
+		assert.Nil(t, server.UpdateEnv(envkey, parser.EnvMap{"TEST": "it-" + strconv.Itoa(i), "TEST_2": "changed"}))
+		select {
+		case c = <-changes:
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	assert.Equal(t, "it", c.previous["TEST"])
+	assert.Contains(t, c.current["TEST"], "it-")
+	// overrides from the shell are still applied
+	assert.Equal(t, "override", c.current["TEST_2"])
+
+	// and changes aren't set in os.Environ
+	assert.Equal(t, "", os.Getenv("TEST"))
+
+	cancel()
+	assert.Equal(t, context.Canceled, stopped.Wait())
+}
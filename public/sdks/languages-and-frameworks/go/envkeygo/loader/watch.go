@@ -0,0 +1,188 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"sync"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/daemon"
+	"github.com/envkey/envkey/public/sdks/envkey-source/env"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+)
+
+var ErrEnvkeyInvalid = daemon.ErrEnvkeyInvalid
+var ErrThrottled = errors.New("active socket connection limit reached")
+
+// Watcher calls a func each time the env changes, with changes pushed by the
+// envkey-source daemon
+type Watcher struct {
+	env  parser.EnvMap
+	done chan struct{}
+	err  error
+
+	mu           sync.Mutex
+	connectedErr error
+}
+
+// StartWatch loads the env through the envkey-source daemon--starting it
+// with the envkey-source executable on PATH if it isn't running--then calls
+// onChange with the previous and current env each time it changes, until ctx
+// is done or the ENVKEY becomes invalid. onChange is called from a single
+// goroutine. if the connection to the daemon is lost, the daemon is started
+// again if it exited, Err returns the error until the connection is back,
+// and changes made in the meantime are picked up once it is.
+//
+// overrides are applied according to opts.OverridePolicy, the same as
+// LoadMap. changes aren't set in os.Environ.
+func StartWatch(ctx context.Context, opts Options, onChange func(previous, current parser.EnvMap)) (*Watcher, error) {
+	envkey, _, fileLayers, err := lookupEnvkey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = startDaemon(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchOptions := opts.fetchOptions()
+	res, events, err := daemon.SubscribeWithEnv(ctx, envkey, daemon.SubscribeOptions{
+		ClientName:    fetchOptions.ClientName,
+		ClientVersion: fetchOptions.ClientVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shellVars := shellVars()
+	current := resolveWatched(res, fileLayers, shellVars, opts.OverridePolicy)
+	w := &Watcher{env: current, done: make(chan struct{})}
+
+	go func() {
+		defer close(w.done)
+
+		for event := range events {
+			switch event.Type {
+			case daemon.EVENT_UPDATED:
+				next := resolveWatched(event.Env, fileLayers, shellVars, opts.OverridePolicy)
+				if !reflect.DeepEqual(current, next) {
+					previous := current
+					current = next
+					onChange(previous, next)
+				}
+			case daemon.EVENT_DISCONNECTED:
+				// the subscription reconnects once the daemon is back
+				err := startDaemon(opts)
+				if err == nil {
+					err = event.Err
+				}
+				w.setConnectedErr(err)
+			case daemon.EVENT_RECONNECTED:
+				w.setConnectedErr(nil)
+			case daemon.EVENT_INVALID:
+				w.err = ErrEnvkeyInvalid
+			case daemon.EVENT_THROTTLED:
+				w.err = ErrThrottled
+			}
+		}
+
+		if w.err == nil {
+			w.err = ctx.Err()
+		}
+	}()
+
+	return w, nil
+}
+
+// Watch is StartWatch, blocking until watching stops
+func Watch(ctx context.Context, opts Options, onChange func(previous, current parser.EnvMap)) error {
+	w, err := StartWatch(ctx, opts, onChange)
+	if err != nil {
+		return err
+	}
+	return w.Wait()
+}
+
+// Env returns the env as it was when the watch started
+func (w *Watcher) Env() parser.EnvMap {
+	return w.env
+}
+
+// Err returns the error from losing the connection to the daemon, until it's
+// reconnected. changes aren't received while it's set.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.connectedErr
+}
+
+func (w *Watcher) setConnectedErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.connectedErr = err
+}
+
+// Wait blocks until watching stops, returning ctx.Err() if ctx is done, or
+// ErrEnvkeyInvalid or ErrThrottled
+func (w *Watcher) Wait() error {
+	<-w.done
+	return w.err
+}
+
+func startDaemon(opts Options) error {
+	if daemon.IsAlive() {
+		return nil
+	}
+
+	executable, err := exec.LookPath("envkey-source")
+	if err != nil {
+		return errors.New("envkey-source daemon isn't running, and envkey-source couldn't be found on PATH to start it")
+	}
+
+	return daemon.LaunchDetachedIfNeeded(daemon.DaemonOptions{
+		Executable:  executable,
+		ShouldCache: opts.ShouldCache,
+		RetryPolicy: opts.RetryPolicy,
+	})
+}
+
+// shellVars returns the non-empty vars in os.Environ that weren't set by
+// LoadWithOptions
+func shellVars() parser.EnvMap {
+	loadedVarsMutex.Lock()
+	defer loadedVarsMutex.Unlock()
+
+	vars := parser.EnvMap{}
+	for k, v := range Environ() {
+		if loaded, ok := loadedVars[k]; v != "" && !(ok && loaded == v) {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+// resolveWatched applies overrides like env.Layers, but with shell vars from
+// before the env was loaded, since os.Environ may hold stale values set by
+// LoadWithOptions
+func resolveWatched(res parser.EnvMap, fileLayers []env.Layer, shellVars parser.EnvMap, policy OverridePolicy) parser.EnvMap {
+	layers := []env.Layer{{Name: env.LAYER_ENVKEY, Vars: res}}
+
+	if policy != OVERRIDES_IGNORED {
+		layers = append(layers, fileLayers...)
+
+		shellLayer := env.Layer{Name: env.LAYER_SHELL, Vars: parser.EnvMap{}}
+		for _, layer := range layers {
+			for k := range layer.Vars {
+				if v, ok := shellVars[k]; ok {
+					shellLayer.Vars[k] = v
+				}
+			}
+		}
+		layers = append(layers, shellLayer)
+	}
+
+	resolved, _ := env.Resolve(layers)
+	return resolved
+}
@@ -0,0 +1,257 @@
+package sqlconn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkeygo/v2/loader"
+)
+
+/*
+* Connector is a database/sql driver.Connector that builds its DSN from env
+* vars, rebuilding it when they change, so credentials can be rotated in
+* EnvKey without restarting:
+*
+*		connector, err := sqlconn.Watch(ctx, &pq.Driver{}, sqlconn.Options{
+*			Vars: []string{"DB_HOST", "DB_USER", "DB_PASSWORD"},
+*			DSN: func(vars parser.EnvMap) (string, error) {
+*				return fmt.Sprintf("postgres://%s:%s@%s/app", vars["DB_USER"], vars["DB_PASSWORD"], vars["DB_HOST"]), nil
+*			},
+*		}, loader.Options{})
+*		db := sql.OpenDB(connector)
+*
+* new connections use the latest DSN. connections opened with an earlier one
+* keep working until they're next returned to the pool, when database/sql
+* closes them instead of reusing them. the driver's connector for an earlier
+* DSN is closed once its last connection is.
+ */
+
+type Options struct {
+	// the vars the DSN is built from--changes to other vars are ignored
+	Vars []string
+
+	// builds the DSN from Vars, which are passed even if they aren't set
+	DSN func(vars parser.EnvMap) (string, error)
+}
+
+type Connector struct {
+	driver driver.Driver
+	opts   Options
+
+	// incremented each time the DSN changes, so connections opened with an
+	// earlier one can be told apart
+	generation uint64
+
+	mu      sync.Mutex
+	vars    parser.EnvMap
+	current *source
+	err     error
+	cancel  context.CancelFunc
+}
+
+// source is a DSN, with the driver's connector for it if the driver has one
+type source struct {
+	dsn        string
+	connector  driver.Connector
+	generation uint64
+
+	// guarded by Connector.mu. once superseded by a new DSN, the connector
+	// is closed when no connections are open (or being opened) with it.
+	open       int
+	superseded bool
+}
+
+// New returns a Connector for drv with a DSN built from env. it's only
+// updated by calling Update--use Watch to update it whenever the env changes.
+func New(drv driver.Driver, env parser.EnvMap, opts Options) (*Connector, error) {
+	if opts.DSN == nil {
+		return nil, errors.New("sqlconn: Options.DSN is required")
+	}
+
+	c := &Connector{driver: drv, opts: opts}
+	err := c.Update(env)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Watch returns a Connector for drv that's updated each time the env
+// changes, until ctx is done or the Connector is closed. see
+// loader.StartWatch for how the env is watched.
+func Watch(ctx context.Context, drv driver.Driver, opts Options, loaderOpts loader.Options) (*Connector, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var c *Connector
+	var mu sync.Mutex
+	// held until c is set, since onChange may be called first
+	mu.Lock()
+
+	w, err := loader.StartWatch(ctx, loaderOpts, func(previous, current parser.EnvMap) {
+		mu.Lock()
+		defer mu.Unlock()
+		if c != nil {
+			c.Update(current)
+		}
+	})
+	if err != nil {
+		cancel()
+		mu.Unlock()
+		return nil, err
+	}
+
+	c, err = New(drv, w.Env(), opts)
+	mu.Unlock()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.cancel = cancel
+
+	go func() {
+		err := w.Wait()
+		if ctx.Err() == nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+		}
+	}()
+
+	return c, nil
+}
+
+// Update rebuilds the DSN from env if any of Options.Vars changed. if it
+// can't be built, the previous DSN is kept and the error is returned (and
+// returned by Err).
+func (c *Connector) Update(env parser.EnvMap) error {
+	vars := parser.EnvMap{}
+	for _, k := range c.opts.Vars {
+		vars[k] = env[k]
+	}
+
+	c.mu.Lock()
+
+	if c.vars != nil && equalVars(c.vars, vars) {
+		c.mu.Unlock()
+		return nil
+	}
+
+	dsn, err := c.opts.DSN(vars)
+	if err == nil && c.current != nil && dsn == c.current.dsn {
+		c.vars = vars
+		c.mu.Unlock()
+		return nil
+	}
+
+	var connector driver.Connector
+	if err == nil {
+		if driverContext, ok := c.driver.(driver.DriverContext); ok {
+			connector, err = driverContext.OpenConnector(dsn)
+		}
+	}
+	c.err = err
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	previous := c.current
+	c.vars = vars
+	c.current = &source{dsn: dsn, connector: connector, generation: atomic.AddUint64(&c.generation, 1)}
+
+	closePrevious := false
+	if previous != nil {
+		previous.superseded = true
+		closePrevious = previous.open == 0
+	}
+	c.mu.Unlock()
+
+	if closePrevious {
+		closeConnector(previous.connector)
+	}
+	return nil
+}
+
+// Err returns the error from the last update if the DSN couldn't be built,
+// or the error that stopped watching
+func (c *Connector) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Connect opens a connection with the latest DSN
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	s := c.current
+	s.open++
+	c.mu.Unlock()
+
+	var inner driver.Conn
+	var err error
+	if s.connector != nil {
+		inner, err = s.connector.Connect(ctx)
+	} else {
+		inner, err = c.driver.Open(s.dsn)
+	}
+	if err != nil {
+		c.release(s)
+		return nil, err
+	}
+
+	return &conn{Conn: inner, connector: c, source: s}, nil
+}
+
+// release is called when a connection opened with s is closed, or couldn't
+// be opened
+func (c *Connector) release(s *source) {
+	c.mu.Lock()
+	s.open--
+	closeSource := s.superseded && s.open == 0
+	c.mu.Unlock()
+
+	if closeSource {
+		closeConnector(s.connector)
+	}
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close stops watching, and closes the driver's connector if it has one. it's
+// called by sql.DB's Close.
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	cancel, connector := c.cancel, c.current.connector
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return closeConnector(connector)
+}
+
+func closeConnector(connector driver.Connector) error {
+	if closer, ok := connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func equalVars(a, b parser.EnvMap) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,260 @@
+package sqlconn_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/envkey/envkeygo/v2/sqlconn"
+)
+
+// fakeDriver records the DSN each connection was opened with
+type fakeDriver struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+type fakeConn struct {
+	dsn    string
+	closed bool
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := &fakeConn{dsn: dsn}
+	d.conns = append(d.conns, c)
+	return c, nil
+}
+
+func (d *fakeDriver) opened() []*fakeConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*fakeConn{}, d.conns...)
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return nil
+}
+
+// legacyDriver's connections only implement the pre-context Queryer and
+// Execer interfaces
+type legacyDriver struct{}
+
+type legacyConn struct {
+	*fakeConn
+}
+
+type legacyRows struct {
+	query string
+	done  bool
+}
+
+func (d legacyDriver) Open(dsn string) (driver.Conn, error) {
+	return legacyConn{&fakeConn{dsn: dsn}}, nil
+}
+
+func (c legacyConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	return &legacyRows{query: query}, nil
+}
+
+func (c legacyConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (r *legacyRows) Columns() []string {
+	return []string{"query"}
+}
+
+func (r *legacyRows) Close() error {
+	return nil
+}
+
+func (r *legacyRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.query
+	return nil
+}
+
+// connectorDriver opens a closable driver.Connector for each DSN
+type connectorDriver struct {
+	fakeDriver
+	connectors []*fakeConnector
+}
+
+type fakeConnector struct {
+	driver *connectorDriver
+	dsn    string
+	closed bool
+}
+
+func (d *connectorDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	connector := &fakeConnector{driver: d, dsn: dsn}
+	d.connectors = append(d.connectors, connector)
+	return connector, nil
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *fakeConnector) Close() error {
+	c.closed = true
+	return nil
+}
+
+var opts = sqlconn.Options{
+	Vars: []string{"DB_USER", "DB_PASSWORD"},
+	DSN: func(vars parser.EnvMap) (string, error) {
+		if vars["DB_PASSWORD"] == "" {
+			return "", errors.New("DB_PASSWORD not set")
+		}
+		return vars["DB_USER"] + ":" + vars["DB_PASSWORD"], nil
+	},
+}
+
+func TestConnector(t *testing.T) {
+	ctx := context.Background()
+	drv := &fakeDriver{}
+
+	connector, err := sqlconn.New(drv, parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1", "OTHER": "1"}, opts)
+	assert.Nil(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	old, err := db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, old.PingContext(ctx))
+
+	// changes to other vars don't affect connections
+	assert.Nil(t, connector.Update(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1", "OTHER": "2"}))
+	c, err := db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+	c, err = db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Close())
+	assert.Len(t, drv.opened(), 2)
+
+	// rotated credentials are used for new connections
+	assert.Nil(t, connector.Update(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw2"}))
+	c, err = db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, c.PingContext(ctx))
+
+	conns := drv.opened()
+	assert.Len(t, conns, 3)
+	assert.Equal(t, "app:pw2", conns[2].dsn)
+
+	// while existing ones keep working, and are closed when they're released
+	assert.Nil(t, old.PingContext(ctx))
+	assert.False(t, conns[0].closed)
+	assert.Nil(t, old.Close())
+	assert.True(t, conns[0].closed)
+	assert.True(t, conns[1].closed)
+	assert.False(t, conns[2].closed)
+
+	assert.Nil(t, c.Close())
+	assert.False(t, conns[2].closed)
+}
+
+func TestConnectorInvalidDSN(t *testing.T) {
+	drv := &fakeDriver{}
+
+	_, err := sqlconn.New(drv, parser.EnvMap{"DB_USER": "app"}, opts)
+	assert.NotNil(t, err)
+
+	connector, err := sqlconn.New(drv, parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1"}, opts)
+	assert.Nil(t, err)
+
+	// the previous DSN is kept
+	assert.NotNil(t, connector.Update(parser.EnvMap{"DB_USER": "app"}))
+	assert.NotNil(t, connector.Err())
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	assert.Nil(t, db.PingContext(context.Background()))
+	assert.Equal(t, "app:pw1", drv.opened()[0].dsn)
+
+	assert.Nil(t, connector.Update(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw2"}))
+	assert.Nil(t, connector.Err())
+}
+
+func TestConnectorClosesSuperseded(t *testing.T) {
+	ctx := context.Background()
+	drv := &connectorDriver{}
+
+	connector, err := sqlconn.New(drv, parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1"}, opts)
+	assert.Nil(t, err)
+
+	c, err := connector.Connect(ctx)
+	assert.Nil(t, err)
+
+	// kept open while a connection opened with it is
+	assert.Nil(t, connector.Update(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw2"}))
+	assert.Len(t, drv.connectors, 2)
+	assert.False(t, drv.connectors[0].closed)
+
+	assert.Nil(t, c.Close())
+	assert.True(t, drv.connectors[0].closed)
+
+	// closed right away if there are none
+	assert.Nil(t, connector.Update(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw3"}))
+	assert.True(t, drv.connectors[1].closed)
+	assert.False(t, drv.connectors[2].closed)
+
+	assert.Nil(t, connector.Close())
+	assert.True(t, drv.connectors[2].closed)
+}
+
+func TestConnectorLegacyDriver(t *testing.T) {
+	ctx := context.Background()
+
+	connector, err := sqlconn.New(legacyDriver{}, parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1"}, opts)
+	assert.Nil(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// forwarded to Exec and Query rather than preparing a statement, which
+	// the driver doesn't support
+	res, err := db.ExecContext(ctx, "update", 1, 2)
+	assert.Nil(t, err)
+	affected, _ := res.RowsAffected()
+	assert.Equal(t, int64(2), affected)
+
+	var query string
+	assert.Nil(t, db.QueryRowContext(ctx, "select", 1).Scan(&query))
+	assert.Equal(t, "select", query)
+
+	_, err = db.ExecContext(ctx, "update", sql.Named("id", 1))
+	assert.EqualError(t, err, "sqlconn: driver does not support the use of named parameters")
+}
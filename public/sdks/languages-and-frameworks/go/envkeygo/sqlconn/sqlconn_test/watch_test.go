@@ -0,0 +1,99 @@
+package sqlconn_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/mockserver"
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/envkey/envkeygo/v2/internal/daemontest"
+	"github.com/envkey/envkeygo/v2/loader"
+	"github.com/envkey/envkeygo/v2/sqlconn"
+)
+
+// updateUntil updates the env until done returns true, since the watch may
+// not be listening yet, and the daemon may miss a change made while it's
+// fetching an earlier one
+func updateUntil(t *testing.T, server *mockserver.Server, envkey string, env func(i int) parser.EnvMap, done func() bool) {
+	for i := 0; ; i++ {
+		if i == 50 {
+			t.Fatal("change not received")
+		}
+		assert.Nil(t, server.UpdateEnv(envkey, env(i)))
+		time.Sleep(200 * time.Millisecond)
+		if done() {
+			return
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := daemontest.Start(t)
+
+	envkey, err := server.AddEnv(parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw1"})
+	assert.Nil(t, err)
+
+	home := os.Getenv("HOME")
+	os.Clearenv()
+	os.Setenv("HOME", home)
+	os.Setenv("ENVKEY", envkey)
+
+	// the daemon exits the process when its last listener closes, so one
+	// watch is kept open
+	_, err = loader.StartWatch(context.Background(), loader.Options{}, func(previous, current parser.EnvMap) {})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	drv := &fakeDriver{}
+	connector, err := sqlconn.Watch(ctx, drv, opts, loader.Options{})
+	assert.Nil(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	old, err := db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, old.PingContext(ctx))
+	assert.Equal(t, "app:pw1", drv.opened()[0].dsn)
+
+	// new connections use the rotated password
+	var dsn string
+	updateUntil(t, server, envkey, func(i int) parser.EnvMap {
+		return parser.EnvMap{"DB_USER": "app", "DB_PASSWORD": "pw2-" + strconv.Itoa(i)}
+	}, func() bool {
+		c, err := db.Conn(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, c.PingContext(ctx))
+		conns := drv.opened()
+		dsn = conns[len(conns)-1].dsn
+		assert.Nil(t, c.Close())
+		return strings.HasPrefix(dsn, "app:pw2-")
+	})
+	assert.Nil(t, connector.Err())
+
+	// the connection opened before the change is closed once it's released
+	assert.Nil(t, old.Close())
+	assert.True(t, drv.opened()[0].closed)
+
+	// a DSN that can't be built is reported, and the previous one is kept
+	updateUntil(t, server, envkey, func(i int) parser.EnvMap {
+		return parser.EnvMap{"DB_USER": "app", "OTHER": strconv.Itoa(i)}
+	}, func() bool {
+		return connector.Err() != nil
+	})
+
+	c, err := db.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, c.PingContext(ctx))
+	conns := drv.opened()
+	assert.Equal(t, dsn, conns[len(conns)-1].dsn)
+	assert.Nil(t, c.Close())
+}
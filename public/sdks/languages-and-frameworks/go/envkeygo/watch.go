@@ -0,0 +1,99 @@
+package envkeygo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/envkey/envkey/public/sdks/envkey-source/parser"
+	"github.com/envkey/envkeygo/v2/decode"
+	"github.com/envkey/envkeygo/v2/loader"
+)
+
+// Watch calls onChange with the previous and current env each time it
+// changes, until ctx is done or the ENVKEY becomes invalid, returning
+// ctx.Err() or the error that stopped it. see loader.StartWatch for details.
+func Watch(ctx context.Context, onChange func(previous, current parser.EnvMap)) error {
+	return loader.Watch(ctx, options(), onChange)
+}
+
+// Live holds a config struct that's decoded again each time the env changes
+type Live[T any] struct {
+	value   atomic.Value
+	watcher *loader.Watcher
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewLive decodes the env into a T (see Decode), then keeps it updated until
+// ctx is done. if a changed env can't be decoded, the previous value is kept
+// and the error is returned by Err.
+func NewLive[T any](ctx context.Context) (*Live[T], error) {
+	live := &Live[T]{}
+
+	// stops the watcher if the first value can't be decoded
+	ctx, cancel := context.WithCancel(ctx)
+
+	// held until the first value is stored, so it isn't replaced by a stale one
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	w, err := loader.StartWatch(ctx, options(), func(previous, current parser.EnvMap) {
+		live.store(current)
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var value T
+	err = decode.Decode(w.Env(), &value)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	live.value.Store(&value)
+	live.watcher = w
+
+	go func() {
+		defer cancel()
+		err := w.Wait()
+		if ctx.Err() == nil {
+			live.mu.Lock()
+			live.err = err
+			live.mu.Unlock()
+		}
+	}()
+
+	return live, nil
+}
+
+// Load returns the latest value, which is replaced rather than modified on
+// changes--it must not be modified
+func (live *Live[T]) Load() *T {
+	return live.value.Load().(*T)
+}
+
+// Err returns the error from the last change if it couldn't be decoded, the
+// error that stopped watching, or the error from losing the connection to
+// the daemon until it's reconnected (see loader.Watcher.Err)
+func (live *Live[T]) Err() error {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	if live.err != nil {
+		return live.err
+	}
+	return live.watcher.Err()
+}
+
+func (live *Live[T]) store(env parser.EnvMap) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	var value T
+	live.err = decode.Decode(env, &value)
+	if live.err == nil {
+		live.value.Store(&value)
+	}
+}